@@ -0,0 +1,121 @@
+package apikey
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/loginlimit"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/util"
+)
+
+// api key 管理的权限
+const (
+	ApiKeyPermissionId   = "5e8c1a3cfa080a3ac0956dc1"
+	ApiKeyPermissionName = "apiKeyManager"
+)
+
+// 初始化 api key 管理接口的 item 与 permission
+// 需要在 roleapp.InitRoleApp 之后调用
+func InitApiKey(ds *dbandmq.Ds, uriPrefix string) error {
+	curT := util.GetCurTime()
+	items := []*roleapp.Item{
+		roleapp.GenerateItem(curT, "apikey:create", "POST", uriPrefix+"/apikey"),
+		roleapp.GenerateItem(curT, "apikey:rotate", "POST", uriPrefix+"/apikey/:id/rotate"),
+		roleapp.GenerateItem(curT, "apikey:revoke", "POST", uriPrefix+"/apikey/:id/revoke"),
+		roleapp.GenerateItem(curT, "apikey:get", "GET", uriPrefix+"/apikey/:id"),
+		roleapp.GenerateItem(curT, "apikey:query", "GET", uriPrefix+"/apikeys"),
+	}
+
+	var itemIds []string
+	for _, item := range items {
+		dbitem, err := roleapp.AddItem(ds, item, roleapp.KeyQueryName)
+		if err != nil {
+			return err
+		}
+		itemIds = append(itemIds, dbitem.Id)
+	}
+
+	p := &roleapp.Permission{
+		Id:      ApiKeyPermissionId,
+		Name:    ApiKeyPermissionName,
+		ItemIds: itemIds,
+		Deleted: false,
+		Source:  roleapp.RoleDataSourceInternal,
+		CreateT: curT,
+		UpdateT: curT,
+	}
+	return roleapp.AddPermission(ds, p, roleapp.KeyQueryId)
+}
+
+// 按 ip 限制无效 key 的尝试次数，为空时不限制
+var Limiter *loginlimit.Limiter
+
+// 使用 api key 验证请求
+// 请求中没有 key header 时直接跳过，由后续的用户验证处理，所以需要放在用户验证之前
+// 验证成功后使用 key 的 principal 执行 roleapp.AuthUser，并 SetCurUser
+func ApiKeyMiddleware(ds *dbandmq.Ds) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(ApiKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if Limiter != nil && !Limiter.Guard(c, "") {
+			return
+		}
+
+		reqId := middleware.GetReqId(c)
+		k, ar, err := authApiKey(ds, key, c)
+		if err != nil && !isKeyError(err) {
+			middleware.StopExec(err)
+		}
+		if err != nil {
+			Logger.Warnf(reqId, "api key验证失败, %s", err.Error())
+			if Limiter != nil && err == ErrInvalidKey {
+				Limiter.Report(c, "", false)
+			}
+			returnfun.Return401Json(c, err.Error())
+			return
+		}
+
+		if ar.Result != roleapp.AuthResultOK {
+			Logger.Warnf(reqId, "api key[%s]无权调用[%s %s]", k.Id, c.Request.Method, c.Request.URL.Path)
+			returnfun.Return403Json(c, ar.Msg)
+			return
+		}
+
+		roleapp.SetCurUser(c, ar)
+		c.Next()
+	}
+}
+
+// key 本身无效的错误，返回 401，其他错误按内部错误处理
+func isKeyError(err error) bool {
+	return err == ErrInvalidKey || err == ErrKeyRevoked || err == ErrKeyExpired || err == ErrIpNotAllow
+}
+
+func authApiKey(ds *dbandmq.Ds, key string, c *gin.Context) (*ApiKey, *roleapp.AuthResult, error) {
+	db := ds.CopyDs().WithContext(c.Request.Context())
+	defer db.Close()
+
+	k, err := VerifyApiKey(db, key, c.ClientIP())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ar := roleapp.AuthUser(db, k.PrincipalId, c.Request.Method, c.Request.URL.Path)
+	ar.UserName = k.Name
+	return k, ar, nil
+}
+
+// 已经通过 api key 验证的请求，用户验证中间件可以用这个方法跳过
+func AuthedByApiKey(c *gin.Context) bool {
+	if c.GetHeader(ApiKeyHeader) == "" {
+		return false
+	}
+	return roleapp.GetCurUser(c) != nil
+}
@@ -0,0 +1,30 @@
+package apikey
+
+import "testing"
+
+func TestGenerateKey(t *testing.T) {
+	prefix, key, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(key)
+
+	p, ok := parsePrefix(key)
+	if !ok || p != prefix {
+		t.Error("parse prefix failed", p)
+	}
+
+	if _, ok := parsePrefix("abc"); ok {
+		t.Error("invalid key should not be parsed")
+	}
+}
+
+func TestIpAllowed(t *testing.T) {
+	k := &ApiKey{AllowIps: []string{"10.0.0.0/8", "192.168.1.2"}}
+	if !k.IpAllowed("10.1.2.3") || !k.IpAllowed("192.168.1.2") {
+		t.Error("ip should be allowed")
+	}
+	if k.IpAllowed("192.168.1.3") {
+		t.Error("ip should not be allowed")
+	}
+}
@@ -0,0 +1,248 @@
+package apikey
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+func getCurUser(c *gin.Context) *roleapp.AuthResult {
+	curUser := roleapp.GetCurUser(c)
+	if curUser == nil {
+		returnfun.ReturnJson(c, 417, 417, "服务器配置错误，调用本接口需要配置用户授权", "")
+		return nil
+	}
+	return curUser
+}
+
+// 只有 key 的创建者和管理员可以操作
+func canManage(user *roleapp.AuthResult, k *ApiKey) bool {
+	return user.UserId == roleapp.AdminUserId || user.UserId == k.OwnerId
+}
+
+// 新建 api key
+// roleIds 必须是当前用户可以赋予的 subrole
+type CreateApiKeyForm struct {
+	Name     string   `json:"name" binding:"required"`
+	ExpireAt int64    `json:"expireAt"` // unix 秒，0 表示不过期
+	AllowIps []string `json:"allowIps"`
+	RoleIds  []string `json:"roleIds"`
+}
+
+func CreateApiKeyHandler(c *gin.Context, db *dbandmq.Ds) {
+	var form CreateApiKeyForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	curUser := getCurUser(c)
+	if curUser == nil {
+		return
+	}
+
+	if form.ExpireAt > 0 && form.ExpireAt <= util.CurUnixTime() {
+		returnfun.ReturnErrJson(c, "过期时间必须晚于当前时间")
+		return
+	}
+
+	if !roleapp.IdInSubRoles(curUser, form.RoleIds) {
+		returnfun.Return403Json(c, "当前用户无权给api key赋予某些角色")
+		return
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	k, key, err := NewApiKey(ds, strings.TrimSpace(form.Name), curUser.UserId, form.ExpireAt, form.AllowIps, form.RoleIds)
+	middleware.StopExec(err)
+
+	// 明文 key 只在这里返回一次
+	retData := gin.H{
+		"key":    key,
+		"apiKey": k,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
+
+// 轮换 key，旧 key 立即失效
+func RotateApiKeyHandler(c *gin.Context, db *dbandmq.Ds) {
+	id := c.Param("id")
+
+	curUser := getCurUser(c)
+	if curUser == nil {
+		return
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	k, err := GetApiKeyById(ds, id)
+	middleware.StopExec(err)
+	if k == nil || k.Revoked {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	if !canManage(curUser, k) {
+		returnfun.Return403Json(c, "无权操作此api key")
+		return
+	}
+
+	key, err := RotateApiKey(ds, k)
+	middleware.StopExec(err)
+
+	retData := gin.H{
+		"key":    key,
+		"apiKey": k,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
+
+// 吊销 key，不可恢复
+func RevokeApiKeyHandler(c *gin.Context, db *dbandmq.Ds) {
+	id := c.Param("id")
+
+	curUser := getCurUser(c)
+	if curUser == nil {
+		return
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	k, err := GetApiKeyById(ds, id)
+	middleware.StopExec(err)
+	if k == nil {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	if !canManage(curUser, k) {
+		returnfun.Return403Json(c, "无权操作此api key")
+		return
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"revoked": true,
+			"updateT": util.GetCurTime(),
+		},
+	}
+	err = ds.TC(CollectionNameApiKey).UpdateId(k.Id, update)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
+
+// 读取 key 明细，包含绑定的角色
+func GetApiKeyHandler(c *gin.Context, db *dbandmq.Ds) {
+	id := c.Param("id")
+
+	curUser := getCurUser(c)
+	if curUser == nil {
+		return
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	k, err := GetApiKeyById(ds, id)
+	middleware.StopExec(err)
+	if k == nil {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	if !canManage(curUser, k) {
+		returnfun.Return403Json(c, "无权查看此api key")
+		return
+	}
+
+	roles, err := roleapp.GetUserRoles(ds, k.PrincipalId)
+	middleware.StopExec(err)
+
+	var srs []*roleapp.SimpleRole
+	for _, role := range roles {
+		srs = append(srs, &roleapp.SimpleRole{Id: role.Id, Name: role.Name})
+	}
+
+	retData := gin.H{
+		"apiKey": k,
+		"roles":  srs,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
+
+// 搜索当前用户的 key 列表
+// 管理员可以通过 owner 参数查看其他用户的 key
+func QueryApiKeyHandler(c *gin.Context, db *dbandmq.Ds) {
+	curUser := getCurUser(c)
+	if curUser == nil {
+		return
+	}
+
+	var andCondition []bson.M
+
+	owner := curUser.UserId
+	if curUser.UserId == roleapp.AdminUserId {
+		owner = c.Query("owner")
+	}
+	if owner != "" {
+		andCondition = append(andCondition, bson.M{"ownerId": owner})
+	}
+
+	name := c.Query("name")
+	if name != "" {
+		andCondition = append(andCondition, bson.M{"name": bson.M{"$regex": name}})
+	}
+
+	revoked := c.Query("revoked")
+	if revoked != "" {
+		revoked = strings.ToUpper(revoked)
+		if revoked == "TRUE" {
+			andCondition = append(andCondition, bson.M{"revoked": true})
+		} else {
+			andCondition = append(andCondition, bson.M{"revoked": false})
+		}
+	}
+
+	query := bson.M{}
+	if len(andCondition) > 0 {
+		query = bson.M{
+			"$and": andCondition,
+		}
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	Q := ds.TC(CollectionNameApiKey).Find(query)
+	total, err := Q.Count()
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	var ks []*ApiKey
+	page, size, skip := util.GetPageAndSize(c)
+	err = Q.Sort("-_id").Skip(skip).Limit(size).All(&ks)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	ret := returnfun.QueryListData{
+		Total: total,
+		Page:  page,
+		Size:  size,
+		Data:  ks,
+	}
+
+	returnfun.ReturnOKJson(c, ret)
+	return
+}
@@ -0,0 +1,288 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net"
+	"strings"
+)
+
+func init() {
+	dbandmq.AddIndexKey(IKApiKey)
+}
+
+var DbPrefix = "apikey_"
+
+// 请求头中携带 key 的名字
+var ApiKeyHeader = "X-Api-Key"
+
+// 明文 key 的格式为 gbk_<prefix>_<secret>
+// prefix 用于查找记录，secret 只保存 hash
+const keyTag = "gbk"
+
+// key 在 RoleAndUser 中对应的 userId 前缀
+const PrincipalPrefix = "apikey:"
+
+var (
+	ErrInvalidKey = errors.New("invalid api key")
+	ErrKeyRevoked = errors.New("api key has been revoked")
+	ErrKeyExpired = errors.New("api key has expired")
+	ErrIpNotAllow = errors.New("client ip is not allowed for this api key")
+)
+
+var CollectionNameApiKey = DbPrefix + "key"
+
+var IKApiKey = &dbandmq.IndexKey{
+	Collection: CollectionNameApiKey,
+	SingleKey:  []string{"ownerId", "revoked"},
+	UniqueKey:  []string{"prefix"},
+}
+
+type ApiKey struct {
+	Id      string `json:"id" bson:"_id"`
+	Name    string `json:"name" bson:"name"`
+	OwnerId string `json:"ownerId" bson:"ownerId"` // 创建者的 userId
+
+	Prefix string `json:"prefix" bson:"prefix"` // 明文 key 的识别部分，可以展示
+	Hash   string `json:"-" bson:"hash"`        // 完整 key 的 sha256
+
+	// 在 RoleAndUser 中的 userId，角色绑定到这个 id 上
+	PrincipalId string `json:"principalId" bson:"principalId"`
+
+	ExpireAt int64    `json:"expireAt" bson:"expireAt"` // 过期时间，unix 秒，0 表示不过期
+	AllowIps []string `json:"allowIps" bson:"allowIps"` // 允许的 ip 或者 cidr，为空表示不限制
+
+	Revoked bool `json:"revoked" bson:"revoked"`
+
+	LastUsedT *util.CurTime `json:"lastUsedT" bson:"lastUsedT"`
+	CreateT   *util.CurTime `json:"createT" bson:"createT"`
+	UpdateT   *util.CurTime `json:"updateT" bson:"updateT"`
+}
+
+func PrincipalId(keyId string) string {
+	return PrincipalPrefix + keyId
+}
+
+func hashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 生成新的明文 key，返回 prefix 与完整 key
+func generateKey() (string, string, error) {
+	b := make([]byte, 6)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	prefix := hex.EncodeToString(b)
+
+	secret, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := keyTag + "_" + prefix + "_" + secret
+	return prefix, key, nil
+}
+
+// 从明文 key 中解析 prefix
+func parsePrefix(key string) (string, bool) {
+	ks := strings.SplitN(key, "_", 3)
+	if len(ks) != 3 || ks[0] != keyTag || ks[1] == "" || ks[2] == "" {
+		return "", false
+	}
+	return ks[1], true
+}
+
+// 给 key 设置新的明文，返回明文，只在创建和轮换时返回一次
+func (k *ApiKey) resetSecret() (string, error) {
+	prefix, key, err := generateKey()
+	if err != nil {
+		return "", err
+	}
+	k.Prefix = prefix
+	k.Hash = hashKey(key)
+	return key, nil
+}
+
+func (k *ApiKey) IsExpired() bool {
+	return k.ExpireAt > 0 && util.CurUnixTime() > k.ExpireAt
+}
+
+func (k *ApiKey) IpAllowed(ip string) bool {
+	if len(k.AllowIps) == 0 {
+		return true
+	}
+
+	cip := net.ParseIP(ip)
+	for _, allow := range k.AllowIps {
+		if strings.Contains(allow, "/") {
+			_, ipNet, err := net.ParseCIDR(allow)
+			if err == nil && cip != nil && ipNet.Contains(cip) {
+				return true
+			}
+			continue
+		}
+		if allow == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// 新建 key，并把 roleIds 绑定到 key 的 principal 上
+// 返回的明文 key 只此一次，数据库只保存 hash
+func NewApiKey(ds *dbandmq.Ds, name, ownerId string, expireAt int64, allowIps, roleIds []string) (*ApiKey, string, error) {
+	k := &ApiKey{
+		Id:       util.GenerateDataId(),
+		Name:     name,
+		OwnerId:  ownerId,
+		ExpireAt: expireAt,
+		AllowIps: allowIps,
+		Revoked:  false,
+		CreateT:  util.GetCurTime(),
+	}
+	k.UpdateT = k.CreateT
+	k.PrincipalId = PrincipalId(k.Id)
+
+	key, err := k.resetSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 先保存 key，避免 key 保存失败时留下没有 principal 的角色绑定
+	err = ds.TC(CollectionNameApiKey).Insert(k)
+	if err != nil {
+		Logger.Errorf("", "保存api key[%s]失败, %s", name, err.Error())
+		return nil, "", middleware.ErrDbExec.Append(err.Error())
+	}
+
+	if len(roleIds) > 0 {
+		rau := &roleapp.RoleAndUser{
+			Id:       util.GenerateDataId(),
+			UserId:   k.PrincipalId,
+			UserName: name,
+			RoleIds:  util.UniqueStringArray(roleIds),
+			CreateT:  k.CreateT,
+			UpdateT:  k.CreateT,
+		}
+		err = roleapp.SaveRoleAndUser(ds, rau)
+		if err != nil {
+			Logger.Errorf("", "保存api key[%s]的角色失败, %s", name, err.Error())
+			if rerr := ds.TC(CollectionNameApiKey).RemoveId(k.Id); rerr != nil {
+				Logger.Errorf("", "删除api key[%s]失败, %s", name, rerr.Error())
+			}
+			return nil, "", middleware.ErrDbExec.Append(err.Error())
+		}
+	}
+
+	return k, key, nil
+}
+
+// 轮换 key，principal 与角色不变，旧的明文立即失效
+func RotateApiKey(ds *dbandmq.Ds, k *ApiKey) (string, error) {
+	key, err := k.resetSecret()
+	if err != nil {
+		return "", err
+	}
+	k.UpdateT = util.GetCurTime()
+
+	update := bson.M{
+		"$set": bson.M{
+			"prefix":  k.Prefix,
+			"hash":    k.Hash,
+			"updateT": k.UpdateT,
+		},
+	}
+	err = ds.TC(CollectionNameApiKey).UpdateId(k.Id, update)
+	if err != nil {
+		Logger.Errorf("", "轮换api key[%s]失败, %s", k.Id, err.Error())
+		return "", middleware.ErrDbExec.Append(err.Error())
+	}
+	return key, nil
+}
+
+func GetApiKeyById(ds *dbandmq.Ds, id string) (*ApiKey, error) {
+	var k *ApiKey
+	err := ds.TC(CollectionNameApiKey).FindId(id).One(&k)
+	if err != nil && err != mgo.ErrNotFound {
+		Logger.Errorf("", "根据id[%s]读取api key失败, %s", id, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return k, nil
+}
+
+func GetApiKeyByPrefix(ds *dbandmq.Ds, prefix string) (*ApiKey, error) {
+	f := bson.M{
+		"prefix": prefix,
+	}
+
+	var k *ApiKey
+	err := ds.TC(CollectionNameApiKey).Find(f).One(&k)
+	if err != nil && err != mgo.ErrNotFound {
+		Logger.Errorf("", "根据prefix[%s]读取api key失败, %s", prefix, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return k, nil
+}
+
+// 验证明文 key 与客户端 ip，成功后返回 key 记录
+func VerifyApiKey(ds *dbandmq.Ds, key, ip string) (*ApiKey, error) {
+	prefix, ok := parsePrefix(key)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	k, err := GetApiKeyByPrefix(ds, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, ErrInvalidKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashKey(key))) != 1 {
+		return nil, ErrInvalidKey
+	}
+
+	if k.Revoked {
+		return nil, ErrKeyRevoked
+	}
+
+	if k.IsExpired() {
+		return nil, ErrKeyExpired
+	}
+
+	if !k.IpAllowed(ip) {
+		return nil, ErrIpNotAllow
+	}
+
+	// 记录最后使用时间，失败不影响验证结果
+	err = ds.TC(CollectionNameApiKey).UpdateId(k.Id, bson.M{"$set": bson.M{"lastUsedT": util.GetCurTime()}})
+	if err != nil {
+		Logger.Warnf("", "更新api key[%s]使用时间失败, %s", k.Id, err.Error())
+	}
+
+	return k, nil
+}
@@ -0,0 +1,38 @@
+package apikey
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/dbandmq"
+)
+
+// api key 管理
+// 与 roleapp 一样，外部需要先配置用户验证，把当前用户 SetCurUser 到 context 中
+func ApiKeyRouter(g *gin.RouterGroup, ds *dbandmq.Ds) {
+	keyR := g.Group("/apikey")
+	{
+		// 新建 key
+		keyR.POST("", func(c *gin.Context) {
+			CreateApiKeyHandler(c, ds)
+		})
+
+		// 轮换 key
+		keyR.POST("/:id/rotate", func(c *gin.Context) {
+			RotateApiKeyHandler(c, ds)
+		})
+
+		// 吊销 key
+		keyR.POST("/:id/revoke", func(c *gin.Context) {
+			RevokeApiKeyHandler(c, ds)
+		})
+
+		// 读取 key 明细
+		keyR.GET("/:id", func(c *gin.Context) {
+			GetApiKeyHandler(c, ds)
+		})
+
+		// 搜索 key
+		g.GET("/apikeys", func(c *gin.Context) {
+			QueryApiKeyHandler(c, ds)
+		})
+	}
+}
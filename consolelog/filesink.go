@@ -0,0 +1,187 @@
+package consolelog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 备份文件名中的时间格式，file.log -> file.log.20191019-150405
+const backupTimeFormat = "20060102-150405"
+
+type FileSinkOption struct {
+	Path       string        `json:"path" yaml:"path"`
+	MaxSize    int64         `json:"maxSize" yaml:"maxSize"`       // 单个文件最大字节数，超过后切分，0 表示不按大小切分
+	Interval   time.Duration `json:"interval" yaml:"interval"`     // 按时间切分的间隔，比如 24h，0 表示不按时间切分
+	MaxBackups int           `json:"maxBackups" yaml:"maxBackups"` // 最多保留的备份数，0 表示不限制
+	MaxAge     time.Duration `json:"maxAge" yaml:"maxAge"`         // 备份最长保留时间，0 表示不限制
+}
+
+// 按大小与时间切分的文件
+type FileSink struct {
+	opt *FileSinkOption
+
+	lock    sync.Mutex
+	f       *os.File
+	size    int64
+	openT   time.Time
+	nowFunc func() time.Time
+}
+
+func NewFileSink(opt *FileSinkOption) (*FileSink, error) {
+	if opt.Path == "" {
+		return nil, fmt.Errorf("log file path is empty")
+	}
+	err := os.MkdirAll(filepath.Dir(opt.Path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileSink{
+		opt:     opt,
+		nowFunc: time.Now,
+	}
+	err = s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.opt.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f = f
+	s.size = info.Size()
+	s.openT = s.nowFunc()
+	return nil
+}
+
+func (s *FileSink) needRotate(n int) bool {
+	if s.opt.MaxSize > 0 && s.size > 0 && s.size+int64(n) > s.opt.MaxSize {
+		return true
+	}
+	if s.opt.Interval > 0 && s.nowFunc().Sub(s.openT) >= s.opt.Interval {
+		return true
+	}
+	return false
+}
+
+func (s *FileSink) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	if s.needRotate(len(p)) {
+		err := s.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.f.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// 当前文件改名为带时间的备份，重新打开新文件，并清理过期的备份
+func (s *FileSink) rotate() error {
+	err := s.f.Close()
+	if err != nil {
+		return err
+	}
+	s.f = nil
+
+	backup := s.opt.Path + "." + s.nowFunc().Format(backupTimeFormat)
+	// 同一秒内多次切分时追加序号
+	name := backup
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s.%d", backup, i)
+	}
+	err = os.Rename(s.opt.Path, name)
+	if err != nil {
+		return err
+	}
+
+	err = s.open()
+	if err != nil {
+		return err
+	}
+
+	s.cleanup()
+	return nil
+}
+
+func (s *FileSink) backups() []string {
+	matches, err := filepath.Glob(s.opt.Path + ".*")
+	if err != nil {
+		return nil
+	}
+	var ret []string
+	prefix := s.opt.Path + "."
+	for _, m := range matches {
+		ts := strings.TrimPrefix(m, prefix)
+		if idx := strings.Index(ts, "."); idx > 0 {
+			ts = ts[:idx]
+		}
+		if _, err := time.ParseInLocation(backupTimeFormat, ts, time.Local); err == nil {
+			ret = append(ret, m)
+		}
+	}
+	// 文件名中的时间可以直接按字符串排序，旧的在前
+	sort.Strings(ret)
+	return ret
+}
+
+func (s *FileSink) cleanup() {
+	files := s.backups()
+
+	if s.opt.MaxAge > 0 {
+		cutoff := s.nowFunc().Add(-s.opt.MaxAge)
+		var keep []string
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err == nil && info.ModTime().Before(cutoff) {
+				_ = os.Remove(file)
+				continue
+			}
+			keep = append(keep, file)
+		}
+		files = keep
+	}
+
+	if s.opt.MaxBackups > 0 && len(files) > s.opt.MaxBackups {
+		for _, file := range files[:len(files)-s.opt.MaxBackups] {
+			_ = os.Remove(file)
+		}
+	}
+}
+
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
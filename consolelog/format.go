@@ -0,0 +1,121 @@
+package consolelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// json 格式的时间，RFC3339 带毫秒与时区
+const JsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+type entry struct {
+	level  int
+	t      time.Time
+	reqId  string
+	caller string
+	msg    string
+	fields []interface{}
+}
+
+func levelName(level int) string {
+	switch level {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LoglevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARNING"
+	case LogLevelError:
+		return "ERROR"
+	}
+	return "OFF"
+}
+
+func levelColor(level int) string {
+	switch level {
+	case LogLevelDebug:
+		return DebugColor
+	case LoglevelInfo:
+		return InfoColor
+	case LogLevelWarn:
+		return WarnColor
+	case LogLevelError:
+		return ErrorColor
+	}
+	return ""
+}
+
+// 原有的文本格式，With 的字段以 key=value 追加在消息后面
+func (e *entry) text(color bool) []byte {
+	var buf bytes.Buffer
+	if color {
+		buf.WriteString(levelColor(e.level))
+	} else {
+		buf.WriteString("[" + levelName(e.level) + "]")
+	}
+	fmt.Fprintf(&buf, "[%s][%s]|%s", e.reqId, e.t.Format("2006-01-02 15:04:05"), e.msg)
+
+	for i := 0; i < len(e.fields); i += 2 {
+		k, v := fieldKV(e.fields, i)
+		fmt.Fprintf(&buf, " %s=%v", k, v)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// 固定字段在前，With 的字段在后，与固定字段重名时加上 fields. 前缀
+func (e *entry) json() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJsonKV(&buf, "level", levelName(e.level), true)
+	writeJsonKV(&buf, "timestamp", e.t.Format(JsonTimeFormat), false)
+	writeJsonKV(&buf, "reqId", e.reqId, false)
+	writeJsonKV(&buf, "caller", e.caller, false)
+	writeJsonKV(&buf, "message", e.msg, false)
+
+	for i := 0; i < len(e.fields); i += 2 {
+		k, v := fieldKV(e.fields, i)
+		switch k {
+		case "level", "timestamp", "reqId", "caller", "message":
+			k = "fields." + k
+		}
+		writeJsonKV(&buf, k, v, false)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// 奇数个参数时最后一个 value 为空，key 不是字符串时转换为字符串
+func fieldKV(fields []interface{}, i int) (string, interface{}) {
+	k, ok := fields[i].(string)
+	if !ok {
+		k = fmt.Sprint(fields[i])
+	}
+	if i+1 >= len(fields) {
+		return k, nil
+	}
+	return k, fields[i+1]
+}
+
+func writeJsonKV(buf *bytes.Buffer, k string, v interface{}, first bool) {
+	if !first {
+		buf.WriteByte(',')
+	}
+	kb, _ := json.Marshal(k)
+	buf.Write(kb)
+	buf.WriteByte(':')
+
+	switch val := v.(type) {
+	case error:
+		v = val.Error()
+	case fmt.Stringer:
+		v = val.String()
+	}
+	vb, err := json.Marshal(v)
+	if err != nil {
+		vb, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(vb)
+}
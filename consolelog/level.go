@@ -0,0 +1,123 @@
+package consolelog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var levelNames = map[string]int{
+	"debug":   LogLevelDebug,
+	"info":    LoglevelInfo,
+	"warn":    LogLevelWarn,
+	"warning": LogLevelWarn,
+	"error":   LogLevelError,
+	"off":     LogLevelOff,
+}
+
+// 把 debug info warn error off 转换为级别
+func ParseLevel(name string) (int, error) {
+	level, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level: %s", name)
+	}
+	return level, nil
+}
+
+func LevelName(level int) string {
+	return strings.ToLower(levelName(level))
+}
+
+// 模块级别，模块名为 Module 指定的名字，或者调用方所在的目录名（通常就是包名）
+type moduleLevels struct {
+	lock   sync.RWMutex
+	levels map[string]int
+	n      int32 // 配置的数量，为 0 时跳过查找与 caller 计算
+}
+
+var modLevels = &moduleLevels{levels: make(map[string]int)}
+
+func SetModuleLevel(module string, level int) {
+	modLevels.lock.Lock()
+	modLevels.levels[module] = level
+	atomic.StoreInt32(&modLevels.n, int32(len(modLevels.levels)))
+	modLevels.lock.Unlock()
+}
+
+// 删除模块级别，恢复使用全局级别
+func ClearModuleLevel(module string) {
+	modLevels.lock.Lock()
+	delete(modLevels.levels, module)
+	atomic.StoreInt32(&modLevels.n, int32(len(modLevels.levels)))
+	modLevels.lock.Unlock()
+}
+
+func ModuleLevels() map[string]int {
+	modLevels.lock.RLock()
+	defer modLevels.lock.RUnlock()
+	ret := make(map[string]int, len(modLevels.levels))
+	for k, v := range modLevels.levels {
+		ret[k] = v
+	}
+	return ret
+}
+
+func moduleLevel(module string) (int, bool) {
+	if atomic.LoadInt32(&modLevels.n) == 0 || module == "" {
+		return 0, false
+	}
+	modLevels.lock.RLock()
+	level, ok := modLevels.levels[module]
+	modLevels.lock.RUnlock()
+	return level, ok
+}
+
+// 单个请求强制输出 debug 日志，key 为 reqId，value 为过期时间
+var (
+	debugLock  sync.RWMutex
+	debugReqs  = make(map[string]time.Time)
+	debugReqsN int32 // 为 0 时跳过查找
+)
+
+// 对 reqId 开启 debug 日志，ttl 后自动失效，防止忘记关闭
+func EnableReqDebug(reqId string, ttl time.Duration) {
+	debugLock.Lock()
+	debugReqs[reqId] = time.Now().Add(ttl)
+	atomic.StoreInt32(&debugReqsN, int32(len(debugReqs)))
+	debugLock.Unlock()
+}
+
+func DisableReqDebug(reqId string) {
+	debugLock.Lock()
+	delete(debugReqs, reqId)
+	atomic.StoreInt32(&debugReqsN, int32(len(debugReqs)))
+	debugLock.Unlock()
+}
+
+func isReqDebug(reqId string) bool {
+	if atomic.LoadInt32(&debugReqsN) == 0 || reqId == "" {
+		return false
+	}
+	debugLock.RLock()
+	expireT, ok := debugReqs[reqId]
+	debugLock.RUnlock()
+	if !ok {
+		return false
+	}
+	if time.Now().After(expireT) {
+		DisableReqDebug(reqId)
+		return false
+	}
+	return true
+}
+
+// 返回调用方所在的目录名，caller 的格式为 dir/file.go:line
+func callerModule(caller string) string {
+	idx := strings.Index(caller, "/")
+	if idx <= 0 {
+		return ""
+	}
+	return caller[:idx]
+}
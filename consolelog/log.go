@@ -2,6 +2,13 @@ package consolelog
 
 import (
 	"fmt"
+	"github.com/mattn/go-isatty"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,10 +20,16 @@ const (
 	LogLevelOff
 )
 
+// 输出格式
+const (
+	FormatText = iota // [INFO][reqId][time]|msg
+	FormatJson        // 一行一个 json，方便 ELK 等直接解析
+)
+
 var (
 	DebugColor = ""
-	InfoColor = ""
-	WarnColor = ""
+	InfoColor  = ""
+	WarnColor  = ""
 	ErrorColor = ""
 )
 
@@ -25,67 +38,244 @@ func init() {
 	InfoColor = fmt.Sprintf("%c[1;0;32m[INFO]%c[0m", 0x1B, 0x1B)
 	WarnColor = fmt.Sprintf("%c[1;0;33m[WARNING]%c[0m", 0x1B, 0x1B)
 	ErrorColor = fmt.Sprintf("%c[1;0;31m[ERROR]%c[0m", 0x1B, 0x1B)
-}
 
+	// stdout 不是终端时（比如重定向到文件或者管道）不输出颜色
+	Logger.SetColor(isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()))
+}
 
+// Level 与 Format 可以在创建时设置，运行中修改请使用 SetLogLevel 与 SetFormat，与输出并发安全
+// 调用过 SetLogLevel/SetFormat 之后，以其设置的值为准，请使用 GetLogLevel 读取当前级别
 type ConsoleLog struct {
-	Level int
+	Level  int
+	Format int
+	Out    io.Writer // 为空时输出到 stdout
+
+	level  int32 // SetLogLevel 设置的级别 + 1，为 0 时使用 Level
+	format int32 // SetFormat 设置的格式 + 1，为 0 时使用 Format
+	color  int32 // 1 输出颜色
+
+	lock  sync.Mutex
+	async *AsyncWriter // SetSinks 配置的异步输出
+
+	// With 生成的子 logger 指向根 logger，共享级别与输出配置
+	root   *ConsoleLog
+	fields []interface{}
+	module string
 }
 
 var Logger = ConsoleLog{
 	Level: LogLevelDebug,
 }
 
+func (l *ConsoleLog) base() *ConsoleLog {
+	if l.root != nil {
+		return l.root
+	}
+	return l
+}
+
 func (l *ConsoleLog) SetLogLevel(level int) {
-	l.Level = level
+	atomic.StoreInt32(&l.base().level, int32(level)+1)
 }
 
-func (l *ConsoleLog) Debug(reqId string, ps ...interface{}) {
-	if l.Level <= LogLevelDebug {
-		fmt.Printf("%s[%s][%s]|%s\n", DebugColor, reqId, curHumanTime(), fmt.Sprint(ps ...))
+func (l *ConsoleLog) GetLogLevel() int {
+	b := l.base()
+	if v := atomic.LoadInt32(&b.level); v > 0 {
+		return int(v - 1)
 	}
+	return b.Level
 }
 
-func (l *ConsoleLog) Debugf(reqId string, format string, ps ...interface{}) {
-	if l.Level <= LogLevelDebug {
-		fmt.Printf("%s[%s][%s]|%s\n", DebugColor, reqId, curHumanTime(), fmt.Sprintf(format, ps ...))
+func (l *ConsoleLog) SetFormat(format int) {
+	atomic.StoreInt32(&l.base().format, int32(format)+1)
+}
+
+func (l *ConsoleLog) getFormat() int {
+	b := l.base()
+	if v := atomic.LoadInt32(&b.format); v > 0 {
+		return int(v - 1)
 	}
+	return b.Format
 }
 
-func (l *ConsoleLog) Info(reqId string, ps ...interface{}) {
-	if l.Level <= LoglevelInfo {
-		fmt.Printf("%s[%s][%s]|%s\n", InfoColor, reqId, curHumanTime(), fmt.Sprint(ps ...))
+func (l *ConsoleLog) SetColor(color bool) {
+	var v int32
+	if color {
+		v = 1
 	}
+	atomic.StoreInt32(&l.base().color, v)
 }
 
-func (l *ConsoleLog) Infof(reqId string, format string, ps ...interface{}) {
-	if l.Level <= LoglevelInfo {
-		fmt.Printf("%s[%s][%s]|%s\n", InfoColor, reqId, curHumanTime(), fmt.Sprintf(format, ps ...))
+func (l *ConsoleLog) SetOutput(w io.Writer) {
+	b := l.base()
+	b.lock.Lock()
+	b.Out = w
+	b.lock.Unlock()
+}
+
+// 配置多个输出，日志先进入有界的异步缓冲，再由单独的 goroutine 写入各个 sink
+// 重复调用时会先写完并关闭之前的 sink
+func (l *ConsoleLog) SetSinks(opt *AsyncOption, sinks ...Sink) {
+	w := NewAsyncWriter(opt, sinks...)
+
+	b := l.base()
+	b.lock.Lock()
+	old := b.async
+	b.async = w
+	b.Out = w
+	b.lock.Unlock()
+
+	if old != nil {
+		_ = old.Close()
 	}
 }
 
-func (l *ConsoleLog) Warn(reqId string, ps ...interface{}) {
-	if l.Level <= LogLevelWarn {
-		fmt.Printf("%s[%s][%s]|%s\n", WarnColor, reqId, curHumanTime(), fmt.Sprint(ps ...))
+// 等待异步缓冲中的日志全部写出
+func (l *ConsoleLog) Flush() {
+	b := l.base()
+	b.lock.Lock()
+	w := b.async
+	b.lock.Unlock()
+
+	if w != nil {
+		w.Flush()
 	}
 }
 
-func (l *ConsoleLog) Warnf(reqId string, format string, ps ...interface{}) {
-	if l.Level <= LogLevelWarn {
-		fmt.Printf("%s[%s][%s]|%s\n", WarnColor, reqId, curHumanTime(), fmt.Sprintf(format, ps ...))
+// 程序退出前调用，写完缓冲并关闭所有 sink，之后恢复为同步输出到 stdout
+func (l *ConsoleLog) Close() error {
+	b := l.base()
+	b.lock.Lock()
+	w := b.async
+	b.async = nil
+	if b.Out == w {
+		b.Out = nil
+	}
+	b.lock.Unlock()
+
+	if w != nil {
+		return w.Close()
 	}
+	return nil
 }
 
-func (l *ConsoleLog) Error(reqId string, ps ...interface{}) {
-	if l.Level <= LogLevelError {
-		fmt.Printf("%s[%s][%s]|%s\n", ErrorColor, reqId, curHumanTime(), fmt.Sprint(ps ...))
+// 返回带有固定字段的子 logger，kvs 为 key value 交替出现
+// 比如 Logger.With("module", "roleapp", "userId", uid).Infof(reqId, "...")
+func (l *ConsoleLog) With(kvs ...interface{}) *ConsoleLog {
+	fields := make([]interface{}, 0, len(l.fields)+len(kvs))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kvs...)
+	return &ConsoleLog{
+		root:   l.base(),
+		fields: fields,
+		module: l.module,
 	}
 }
 
+// 返回指定模块的子 logger，日志级别可以通过 SetModuleLevel 单独设置
+// 没有指定模块的日志使用调用方所在的目录名作为模块名
+func (l *ConsoleLog) Module(name string) *ConsoleLog {
+	child := l.With("module", name)
+	child.module = name
+	return child
+}
+
+func (l *ConsoleLog) Debug(reqId string, ps ...interface{}) {
+	l.output(LogLevelDebug, reqId, fmt.Sprint(ps...))
+}
+
+func (l *ConsoleLog) Debugf(reqId string, format string, ps ...interface{}) {
+	l.output(LogLevelDebug, reqId, fmt.Sprintf(format, ps...))
+}
+
+func (l *ConsoleLog) Info(reqId string, ps ...interface{}) {
+	l.output(LoglevelInfo, reqId, fmt.Sprint(ps...))
+}
+
+func (l *ConsoleLog) Infof(reqId string, format string, ps ...interface{}) {
+	l.output(LoglevelInfo, reqId, fmt.Sprintf(format, ps...))
+}
+
+func (l *ConsoleLog) Warn(reqId string, ps ...interface{}) {
+	l.output(LogLevelWarn, reqId, fmt.Sprint(ps...))
+}
+
+func (l *ConsoleLog) Warnf(reqId string, format string, ps ...interface{}) {
+	l.output(LogLevelWarn, reqId, fmt.Sprintf(format, ps...))
+}
+
+func (l *ConsoleLog) Error(reqId string, ps ...interface{}) {
+	l.output(LogLevelError, reqId, fmt.Sprint(ps...))
+}
+
 func (l *ConsoleLog) Errorf(reqId string, format string, ps ...interface{}) {
-	if l.Level <= LogLevelError {
-		fmt.Printf("%s[%s][%s]|%s\n", ErrorColor, reqId, curHumanTime(), fmt.Sprintf(format, ps ...))
+	l.output(LogLevelError, reqId, fmt.Sprintf(format, ps...))
+}
+
+// 调用 output 的方法到业务代码之间的栈深度
+const callerDepth = 3
+
+func (l *ConsoleLog) output(level int, reqId, msg string) {
+	b := l.base()
+
+	// 配置了模块级别时才需要提前计算 caller
+	threshold := b.GetLogLevel()
+	callerStr := ""
+	if atomic.LoadInt32(&modLevels.n) > 0 {
+		callerStr = caller(callerDepth)
+		module := l.module
+		if module == "" {
+			module = callerModule(callerStr)
+		}
+		if ml, ok := moduleLevel(module); ok {
+			threshold = ml
+		}
+	}
+	if threshold > level && !isReqDebug(reqId) {
+		return
+	}
+	if callerStr == "" {
+		callerStr = caller(callerDepth)
+	}
+
+	e := &entry{
+		level:  level,
+		t:      time.Now(),
+		reqId:  reqId,
+		caller: callerStr,
+		msg:    msg,
+		fields: l.fields,
+	}
+
+	var line []byte
+	if b.getFormat() == FormatJson {
+		line = e.json()
+	} else {
+		line = e.text(atomic.LoadInt32(&b.color) == 1)
+	}
+
+	b.lock.Lock()
+	out := b.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, _ = out.Write(line)
+	b.lock.Unlock()
+}
+
+// 返回 dir/file.go:line 形式的调用位置
+func caller(skip int) string {
+	_, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	idx := strings.LastIndex(file, "/")
+	if idx > 0 {
+		if j := strings.LastIndex(file[:idx], "/"); j >= 0 {
+			file = file[j+1:]
+		}
 	}
+	return fmt.Sprintf("%s:%d", file, line)
 }
 
 func curHumanTime() string {
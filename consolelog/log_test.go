@@ -0,0 +1,147 @@
+package consolelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJsonFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := &ConsoleLog{Level: LoglevelInfo, Format: FormatJson, Out: &buf}
+
+	l.Debugf("r1", "hidden")
+	l.With("module", "roleapp", "message", "dup").Infof("r1", "hello %s", "world")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatal("debug should be filtered", lines)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatal(err, lines[0])
+	}
+	if m["level"] != "INFO" || m["reqId"] != "r1" || m["message"] != "hello world" || m["module"] != "roleapp" || m["fields.message"] != "dup" {
+		t.Error("bad json entry", lines[0])
+	}
+	if !strings.HasPrefix(m["caller"].(string), "consolelog/log_test.go:") {
+		t.Error("bad caller", m["caller"])
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := &ConsoleLog{Level: LogLevelDebug, Out: &buf}
+
+	l.With("k", 1).Warn("r2", "msg")
+	if !strings.HasPrefix(buf.String(), "[WARNING][r2][") || !strings.HasSuffix(buf.String(), "|msg k=1\n") {
+		t.Error("bad text entry", buf.String())
+	}
+}
+
+type memSink struct {
+	lines []string
+}
+
+func (s *memSink) Write(p []byte) (int, error) {
+	s.lines = append(s.lines, string(p))
+	return len(p), nil
+}
+
+func (s *memSink) Close() error {
+	return nil
+}
+
+func TestAsyncSinks(t *testing.T) {
+	a, b := &memSink{}, &memSink{}
+	l := &ConsoleLog{Level: LogLevelDebug}
+	l.SetSinks(&AsyncOption{BufferSize: 16, Policy: PolicyBlock}, a, b)
+
+	for i := 0; i < 100; i++ {
+		l.Infof("r", "line %d", i)
+	}
+	l.Flush()
+	if len(a.lines) != 100 || len(b.lines) != 100 {
+		t.Error("all lines should be written", len(a.lines), len(b.lines))
+	}
+
+	l.Close()
+	l.SetOutput(&bytes.Buffer{})
+	l.Info("r", "after close")
+}
+
+func TestFileSinkRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consolelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2019, 10, 19, 15, 4, 5, 0, time.Local)
+	s, err := NewFileSink(&FileSinkOption{Path: filepath.Join(dir, "app.log"), MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.nowFunc = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for i := 0; i < 5; i++ {
+		s.Write([]byte("0123456789\n"))
+	}
+	s.Close()
+
+	if len(s.backups()) != 2 {
+		t.Error("only 2 backups should be kept", s.backups())
+	}
+}
+
+func TestModuleLevelAndReqDebug(t *testing.T) {
+	var buf bytes.Buffer
+	l := &ConsoleLog{Level: LogLevelError, Out: &buf}
+
+	SetModuleLevel("consolelog", LogLevelDebug)
+	l.Debug("r1", "by package")
+	ClearModuleLevel("consolelog")
+
+	SetModuleLevel("mymod", LoglevelInfo)
+	l.Module("mymod").Info("r1", "by module")
+	l.Module("other").Info("r1", "hidden")
+	ClearModuleLevel("mymod")
+
+	EnableReqDebug("r2", time.Minute)
+	l.Debug("r2", "by reqId")
+	l.Debug("r3", "hidden")
+	DisableReqDebug("r2")
+	l.Debug("r2", "hidden")
+
+	out := buf.String()
+	if strings.Count(out, "\n") != 3 || strings.Contains(out, "hidden") {
+		t.Error("bad level filter", out)
+	}
+}
+
+func TestLevelField(t *testing.T) {
+	var buf bytes.Buffer
+	lvl := LogLevelWarn
+	l := &ConsoleLog{Level: lvl, Out: &buf}
+	l.Info("r1", "hidden")
+
+	l.Level = LoglevelInfo
+	if l.GetLogLevel() != LoglevelInfo {
+		t.Error("Level field should be used before SetLogLevel", l.GetLogLevel())
+	}
+
+	l.SetLogLevel(LogLevelDebug)
+	l.Debug("r1", "shown")
+	if l.GetLogLevel() != LogLevelDebug || strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Error("unexpected output", buf.String())
+	}
+}
@@ -0,0 +1,165 @@
+package consolelog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// 日志的输出目标，Write 每次收到完整的一行
+// sink 内部出错时不能再使用 Logger 记录，否则可能形成循环，写到 stderr 即可
+type Sink interface {
+	Write(p []byte) (int, error)
+	Close() error
+}
+
+// 标准输出
+type StdoutSink struct{}
+
+func (s *StdoutSink) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (s *StdoutSink) Close() error {
+	return nil
+}
+
+// 缓冲满时的处理方式
+const (
+	PolicyDrop  = iota // 丢弃新日志，不阻塞业务
+	PolicyBlock        // 阻塞写日志的 goroutine，直到有空位
+)
+
+const DefaultBufferSize = 8192
+
+type AsyncOption struct {
+	BufferSize int // 缓冲的行数，默认 8192
+	Policy     int
+}
+
+// 有界的异步缓冲，由单独的 goroutine 依次写入所有 sink
+type AsyncWriter struct {
+	dropped int64 // 放在第一个字段，保证 32 位平台上 atomic 操作对齐
+
+	sinks   []Sink
+	policy  int
+	ch      chan []byte
+	flushCh chan chan struct{}
+	done    chan struct{}
+
+	// 关闭后不再接收日志，避免向已关闭的 channel 写入
+	lock   sync.RWMutex
+	closed bool
+}
+
+func NewAsyncWriter(opt *AsyncOption, sinks ...Sink) *AsyncWriter {
+	size := DefaultBufferSize
+	policy := PolicyDrop
+	if opt != nil {
+		if opt.BufferSize > 0 {
+			size = opt.BufferSize
+		}
+		policy = opt.Policy
+	}
+
+	w := &AsyncWriter{
+		sinks:   sinks,
+		policy:  policy,
+		ch:      make(chan []byte, size),
+		flushCh: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	for {
+		select {
+		case line, ok := <-w.ch:
+			if !ok {
+				return
+			}
+			w.writeAll(line)
+		case ack := <-w.flushCh:
+			// 把 flush 之前进入缓冲的日志全部写完
+			for n := len(w.ch); n > 0; n-- {
+				line, ok := <-w.ch
+				if !ok {
+					break
+				}
+				w.writeAll(line)
+			}
+			close(ack)
+		}
+	}
+}
+
+func (w *AsyncWriter) writeAll(line []byte) {
+	for _, s := range w.sinks {
+		_, err := s.Write(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "consolelog sink write failed, %s\n", err.Error())
+		}
+	}
+}
+
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.closed {
+		atomic.AddInt64(&w.dropped, 1)
+		return len(p), nil
+	}
+
+	if w.policy == PolicyBlock {
+		w.ch <- line
+		return len(p), nil
+	}
+
+	select {
+	case w.ch <- line:
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// 因为缓冲满被丢弃的行数
+func (w *AsyncWriter) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// 等待缓冲中的日志全部写入 sink
+func (w *AsyncWriter) Flush() {
+	ack := make(chan struct{})
+	select {
+	case w.flushCh <- ack:
+		<-ack
+	case <-w.done:
+	}
+}
+
+// 写完缓冲后关闭所有 sink，之后的日志会被丢弃
+func (w *AsyncWriter) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.ch)
+	w.lock.Unlock()
+
+	// run 会先写完 channel 中剩余的日志再退出
+	<-w.done
+	for _, s := range w.sinks {
+		_ = s.Close()
+	}
+	return nil
+}
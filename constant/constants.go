@@ -8,3 +8,9 @@ const ReqIdKey = "REQIDKEY"
 // 返回的 header 中的本次请求的流水号，同一个请求中，与上面的 reqid 一致
 const XRequestIdHeaderKey = "X-Request-Id"
 
+// W3C trace context 的 header
+const TraceParentHeaderKey = "traceparent"
+const TraceStateHeaderKey = "tracestate"
+
+// context 中的 trace 信息
+const TraceCtxKey = "TRACECTXKEY"
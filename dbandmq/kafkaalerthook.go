@@ -0,0 +1,33 @@
+package dbandmq
+
+import (
+	"encoding/json"
+	"github.com/Shopify/sarama"
+	"github.com/leyle/ginbase/middleware"
+)
+
+// 将 middleware.PanicReport 以 json 格式发送到 kafka 的 middleware.AlertHook，key 为 Fingerprint
+// producer 由使用方创建与关闭
+type KafkaAlertHook struct {
+	Producer sarama.SyncProducer
+	Topic    string
+}
+
+func NewKafkaAlertHook(producer sarama.SyncProducer, topic string) *KafkaAlertHook {
+	return &KafkaAlertHook{
+		Producer: producer,
+		Topic:    topic,
+	}
+}
+
+func (h *KafkaAlertHook) Name() string {
+	return "kafka"
+}
+
+func (h *KafkaAlertHook) Alert(r *middleware.PanicReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return SendMsg(h.Producer, h.Topic, r.Fingerprint(), data)
+}
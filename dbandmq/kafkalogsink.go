@@ -0,0 +1,47 @@
+package dbandmq
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// 把日志发送到 kafka 的 consolelog.Sink
+// 不能使用 SendMsg，SendMsg 会记录日志，在 sink 中再写日志会形成循环
+// producer 由使用方创建与关闭
+type KafkaLogSink struct {
+	Producer sarama.SyncProducer
+	Topic    string
+	Key      string // 为空时由 kafka 自动分区
+}
+
+func NewKafkaLogSink(producer sarama.SyncProducer, topic string) *KafkaLogSink {
+	return &KafkaLogSink{
+		Producer: producer,
+		Topic:    topic,
+	}
+}
+
+func (k *KafkaLogSink) Write(p []byte) (int, error) {
+	// 去掉行尾的换行，每条消息就是一行日志
+	data := p
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		data = data[:n-1]
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: k.Topic,
+		Value: sarama.ByteEncoder(data),
+	}
+	if k.Key != "" {
+		msg.Key = sarama.StringEncoder(k.Key)
+	}
+
+	_, _, err := k.Producer.SendMessage(msg)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (k *KafkaLogSink) Close() error {
+	return nil
+}
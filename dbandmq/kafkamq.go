@@ -1,20 +1,30 @@
 package dbandmq
 
 import (
+	"context"
 	"github.com/Shopify/sarama"
 	cluster "github.com/bsm/sarama-cluster"
+	"github.com/leyle/ginbase/constant"
 	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/metrics"
+	"github.com/leyle/ginbase/tracing"
+	"sync"
 )
 
 const DEFAULT_SEND_RETRY_MAX = 5
 const PRODUCER_NAME = "PRODUCER"
 const CONSUMER_NAME = "CONSUMER"
 
+// NewKafkaProducer 创建的、配置的版本支持消息 header(kafka 0.11 及以上)的 producer
+// SendMsg 只对这些 producer 在 header 中带上 trace 信息
+var headerProducers sync.Map
+
 type MqOption struct {
 	Host []string  `json:"host" yaml:"host"`
 	Topic []string `json:"topic" yaml:"topic"`
 	GroupId string `json:"groupid" yaml:"groupid"`
 	SendRetryMax int `json:"sendretrymax" yaml:"sendretrymax"`
+	Version string `json:"version" yaml:"version"` // kafka 版本，为空时使用 sarama 的默认版本，0.11 及以上才会在消息 header 中传递 trace
 	Stop chan struct{}
 }
 
@@ -23,6 +33,19 @@ func(m *MqOption) Info(name string) {
 	Logger.Infof("", "Current connect [%s] kafka: Host[%s], topic[%s], groupId[%s], retrymax[%d]\n", name, m.Host, m.Topic, m.GroupId, m.SendRetryMax)
 }
 
+// 未配置 Version 时返回 sarama 的默认版本
+func(m *MqOption) kafkaVersion(def sarama.KafkaVersion) (sarama.KafkaVersion, error) {
+	if m.Version == "" {
+		return def, nil
+	}
+	v, err := sarama.ParseKafkaVersion(m.Version)
+	if err != nil {
+		Logger.Errorf("", "invalid kafka version [%s], %s", m.Version, err.Error())
+		return v, err
+	}
+	return v, nil
+}
+
 func NewKafkaProducer(opt *MqOption) (sarama.SyncProducer, error) {
 	if opt.SendRetryMax == 0 {
 		opt.SendRetryMax = DEFAULT_SEND_RETRY_MAX
@@ -30,6 +53,11 @@ func NewKafkaProducer(opt *MqOption) (sarama.SyncProducer, error) {
 	opt.Info(PRODUCER_NAME)
 
 	cf := sarama.NewConfig()
+	version, err := opt.kafkaVersion(cf.Version)
+	if err != nil {
+		return nil, err
+	}
+	cf.Version = version
 	cf.Producer.RequiredAcks = sarama.WaitForAll
 	cf.Producer.Retry.Max = opt.SendRetryMax
 	cf.Producer.Return.Successes = true
@@ -38,22 +66,45 @@ func NewKafkaProducer(opt *MqOption) (sarama.SyncProducer, error) {
 		Logger.Errorf("", "failed to create sync kafka producer, %s", err.Error())
 		return nil, err
 	}
+	if version.IsAtLeast(sarama.V0_11_0_0) {
+		headerProducers.Store(producer, true)
+	}
 
 	return producer, nil
 }
 
-func SendMsg(producer sarama.SyncProducer, topic, key string, data []byte) error {
+// 可选的 ctx 传入 *gin.Context 或者带有 span 的 context 时，记录 producer span，
+// 并在 producer 支持时自动在消息 header 中带上 X-Request-Id 与 traceparent/tracestate
+func SendMsg(producer sarama.SyncProducer, topic, key string, data []byte, ctx ...context.Context) error {
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
 		Key: sarama.StringEncoder(key),
 		Value: sarama.StringEncoder(string(data)),
 	}
 
+	var span *tracing.Span
+	if len(ctx) > 0 {
+		_, span = tracing.StartChild(ctx[0], "kafka.produce "+topic, tracing.KindProducer)
+		span.SetAttr("kafka.topic", topic)
+		span.SetAttr("kafka.key", key)
+		defer span.End()
+		if _, ok := headerProducers.Load(producer); ok {
+			for k, v := range span.Headers() {
+				msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+			}
+		}
+	}
+
 	partition, offset, err := producer.SendMessage(msg)
 	if err != nil {
+		metrics.KafkaProduced.Inc(topic, metrics.ResultError)
+		span.SetError(err)
 		Logger.Errorf("", "send kafka msg failed, %s, %s, %s", topic, key, err.Error())
 		return err
 	}
+	metrics.KafkaProduced.Inc(topic, metrics.ResultOk)
+	span.SetAttr("kafka.partition", partition)
+	span.SetAttr("kafka.offset", offset)
 	Logger.Infof("", "msgId: %s, partition: %d, offset: %d", key, partition, offset)
 	return nil
 }
@@ -63,6 +114,11 @@ func NewKafkaConsumer(opt *MqOption) (*cluster.Consumer, error) {
 	opt.Info(CONSUMER_NAME)
 
 	cf := cluster.NewConfig()
+	version, err := opt.kafkaVersion(cf.Version)
+	if err != nil {
+		return nil, err
+	}
+	cf.Version = version
 	cf.Consumer.Return.Errors = true
 	cf.Group.Return.Notifications = true
 	consumer, err := cluster.NewConsumer(opt.Host, opt.GroupId, opt.Topic, cf)
@@ -75,6 +131,14 @@ func NewKafkaConsumer(opt *MqOption) (*cluster.Consumer, error) {
 }
 
 func ConsumeMsg(opt *MqOption, handleF func(message *sarama.ConsumerMessage)) error {
+	return ConsumeMsgWithContext(opt, func(ctx context.Context, msg *sarama.ConsumerMessage) {
+		handleF(msg)
+	})
+}
+
+// 与 ConsumeMsg 相同，每条消息记录一个 consumer span
+// 传给 handleF 的 ctx 带有这个 span，调用 util.HttpPost、SendMsg 等传入 ctx，继续向下游传递
+func ConsumeMsgWithContext(opt *MqOption, handleF func(ctx context.Context, message *sarama.ConsumerMessage)) error {
 	var err error
 	consumer, err := NewKafkaConsumer(opt)
 	if err != nil {
@@ -84,6 +148,7 @@ func ConsumeMsg(opt *MqOption, handleF func(message *sarama.ConsumerMessage)) er
 
 	go func() {
 		for err := range consumer.Errors() {
+			metrics.KafkaConsumeErrors.Inc()
 			Logger.Errorf("", "consume msg error: %s, %s, %s, %s", opt.Host, opt.Topic, opt.GroupId, err.Error())
 		}
 	}()
@@ -99,7 +164,10 @@ func ConsumeMsg(opt *MqOption, handleF func(message *sarama.ConsumerMessage)) er
 		case msg, ok := <-consumer.Messages():
 			if ok {
 				go func(msg *sarama.ConsumerMessage) {
-					handleF(msg)
+					metrics.KafkaConsumed.Inc(msg.Topic)
+					span := StartKafkaMsgSpan(msg)
+					handleF(tracing.ContextWithSpan(context.Background(), span), msg)
+					span.End()
 					consumer.MarkOffset(msg, "")
 				}(msg)
 			}
@@ -108,4 +176,30 @@ func ConsumeMsg(opt *MqOption, handleF func(message *sarama.ConsumerMessage)) er
 			return nil
 		}
 	}
-}
\ No newline at end of file
+}
+
+// 根据消息 header 中的请求号与 trace context 开始 consumer span
+// 上游没有传递时开始新的 trace，请求号为空时使用消息的 key
+func StartKafkaMsgSpan(msg *sarama.ConsumerMessage) *tracing.Span {
+	var reqId, traceParent, traceState string
+	for _, h := range msg.Headers {
+		switch string(h.Key) {
+		case constant.XRequestIdHeaderKey:
+			reqId = string(h.Value)
+		case constant.TraceParentHeaderKey:
+			traceParent = string(h.Value)
+		case constant.TraceStateHeaderKey:
+			traceState = string(h.Value)
+		}
+	}
+	if reqId == "" {
+		reqId = string(msg.Key)
+	}
+
+	remote, _ := tracing.Remote(reqId, traceParent, traceState)
+	span := tracing.StartSpan(remote, reqId, "kafka.consume "+msg.Topic, tracing.KindConsumer)
+	span.SetAttr("kafka.topic", msg.Topic)
+	span.SetAttr("kafka.partition", msg.Partition)
+	span.SetAttr("kafka.offset", msg.Offset)
+	return span
+}
@@ -3,6 +3,8 @@ package dbandmq
 import (
 	"github.com/go-redis/redis"
 	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/metrics"
+	"github.com/leyle/ginbase/tracing"
 	"github.com/leyle/ginbase/util"
 	"time"
 )
@@ -16,8 +18,28 @@ const (
 // 返回 true 的时候，就会同步返回一个 set 的 val
 // 这个 val 可以作为后续 del key 的时候凭证
 // timeout 都是秒
+// r 为 TraceRedis 返回的 client 时，记录整个加锁过程的 span
 const lockPrefix = "LOCK-"
-func AcquireLock(r *redis.Client, resource string, acquireTimeout, lockTimeout int) (string, bool) {
+func AcquireLock(r *redis.Client, resource string, acquireTimeout, lockTimeout int) (val string, ok bool) {
+	_, span := tracing.StartChild(r.Context(), "redis.AcquireLock", tracing.KindInternal)
+	span.SetAttr("lock.resource", resource)
+	startT := time.Now()
+	lockErr := false
+	defer func() {
+		span.SetAttr("lock.acquired", ok)
+		span.End()
+
+		result := "acquired"
+		if !ok {
+			result = "timeout"
+			if lockErr {
+				result = "error"
+			}
+			metrics.LockFailures.Inc(result)
+		}
+		metrics.LockWait.Observe(time.Since(startT).Seconds(), result)
+	}()
+
 	if acquireTimeout <= 0 {
 		acquireTimeout = DEFAULT_LOCK_ACQUIRE_TIMEOUT
 	}
@@ -26,12 +48,14 @@ func AcquireLock(r *redis.Client, resource string, acquireTimeout, lockTimeout i
 	}
 
 	lockResource := lockPrefix + resource
-	val := util.GenerateDataId()
+	val = util.GenerateDataId()
 	lockTimeoutD := time.Duration(lockTimeout) * time.Second
 	endTime := time.Now().Add(time.Duration(acquireTimeout) * time.Second)
 	for time.Now().Unix() < endTime.Unix() {
 		ok, err := r.SetNX(lockResource, val, lockTimeoutD).Result()
 		if err != nil {
+			lockErr = true
+			span.SetError(err)
 			Logger.Errorf("", "设置[%s]的锁失败, %s", resource, err.Error())
 			return "", false
 		}
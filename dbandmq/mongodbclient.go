@@ -1,6 +1,7 @@
 package dbandmq
 
 import (
+	"context"
 	"fmt"
 	. "github.com/leyle/ginbase/consolelog"
 	"gopkg.in/mgo.v2"
@@ -21,6 +22,7 @@ func (opt *MgoOption) String() string {
 type Ds struct {
 	Se *mgo.Session
 	opt *MgoOption
+	ctx context.Context // 追踪用，见 WithContext
 }
 
 func (opt *MgoOption) ConnectUrl() string {
@@ -84,6 +86,7 @@ func (d *Ds) CopyDs() *Ds {
 	newDs := &Ds{
 		Se:  se,
 		opt: d.opt,
+		ctx: d.ctx,
 	}
 	return newDs
 }
@@ -139,31 +142,39 @@ func (d *Ds)InsureUniqueIndex(collection string, keys []string) error {
 }
 
 func (d *Ds)InsureCollectionKeys() error {
-	var err error
 	for _, ik := range indexKeys {
-		name := ik.Collection
-		if len(ik.SingleKey) > 0 {
-			err = d.InsureSingleIndex(name, ik.SingleKey)
-			if err != nil {
-				return err
-			}
+		err := d.InsureIndexKey(ik, ik.Collection)
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if len(ik.CompositeKeys) > 0 {
-			for _, ckey := range ik.CompositeKeys {
-				err = d.InsureCompositeIndex(name, ckey)
-				if err != nil {
-					return err
-				}
-			}
+// 按 ik 的定义给指定的集合建立索引，collection 可以与 ik.Collection 不同，比如临时集合
+func (d *Ds) InsureIndexKey(ik *IndexKey, collection string) error {
+	var err error
+	if len(ik.SingleKey) > 0 {
+		err = d.InsureSingleIndex(collection, ik.SingleKey)
+		if err != nil {
+			return err
 		}
+	}
 
-		if len(ik.UniqueKey) > 0 {
-			err = d.InsureUniqueIndex(name, ik.UniqueKey)
+	if len(ik.CompositeKeys) > 0 {
+		for _, ckey := range ik.CompositeKeys {
+			err = d.InsureCompositeIndex(collection, ckey)
 			if err != nil {
 				return err
 			}
 		}
 	}
+
+	if len(ik.UniqueKey) > 0 {
+		err = d.InsureUniqueIndex(collection, ik.UniqueKey)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
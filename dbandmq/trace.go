@@ -0,0 +1,264 @@
+package dbandmq
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/leyle/ginbase/metrics"
+	"github.com/leyle/ginbase/tracing"
+	"gopkg.in/mgo.v2"
+	"strings"
+	"time"
+)
+
+// 返回带有 ctx 的 redis client，每个命令与 pipeline 记录一个 client span
+// ctx 中没有 span 时原样返回 r；返回的 client 与 r 共用连接池，不需要关闭
+func TraceRedis(ctx context.Context, r *redis.Client) *redis.Client {
+	if tracing.FromContext(ctx) == nil {
+		return r
+	}
+
+	tr := r.WithContext(ctx)
+	tr.WrapProcess(func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			// 参数中可能有敏感数据，只记录命令名
+			_, span := tracing.StartChild(ctx, "redis."+cmd.Name(), tracing.KindClient)
+			span.SetAttr("db.system", "redis")
+			err := old(cmd)
+			endRedisSpan(span, err)
+			return err
+		}
+	})
+	tr.WrapProcessPipeline(func(old func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			names := make([]string, 0, len(cmds))
+			for _, cmd := range cmds {
+				names = append(names, cmd.Name())
+			}
+			_, span := tracing.StartChild(ctx, "redis.pipeline", tracing.KindClient)
+			span.SetAttr("db.system", "redis")
+			span.SetAttr("redis.cmds", strings.Join(names, ","))
+			err := old(cmds)
+			endRedisSpan(span, err)
+			return err
+		}
+	})
+	return tr
+}
+
+func endRedisSpan(span *tracing.Span, err error) {
+	if err != nil && err != redis.Nil {
+		span.SetError(err)
+	}
+	span.End()
+}
+
+// 返回带有 ctx 的 Ds，与 d 共用 session，只需要关闭一次
+// 通过 TC 获取的 collection 的操作记录为 ctx 中 span 的子 span
+func (d *Ds) WithContext(ctx context.Context) *Ds {
+	return &Ds{
+		Se:  d.Se,
+		opt: d.opt,
+		ctx: ctx,
+	}
+}
+
+// 带追踪与耗时指标的 collection，用法与 C 相同
+// ctx 中没有 span 时只记录指标
+func (d *Ds) TC(collection string) *TracedCollection {
+	return &TracedCollection{
+		Collection: d.C(collection),
+		ctx:        d.ctx,
+	}
+}
+
+// 写操作与 Count 直接记录 span 与耗时指标，Find/FindId 返回的 TracedQuery 在执行 One/All/Count 等时记录
+type TracedCollection struct {
+	*mgo.Collection
+	ctx context.Context
+}
+
+// 一次操作的 span 与耗时指标，ctx 中没有 span 时只记录指标
+type mgoOp struct {
+	span       *tracing.Span
+	startT     time.Time
+	collection string
+	op         string
+}
+
+func (c *TracedCollection) start(op string) *mgoOp {
+	_, span := tracing.StartChild(c.ctx, "mongo."+op+" "+c.Name, tracing.KindClient)
+	span.SetAttr("db.system", "mongodb")
+	span.SetAttr("db.collection", c.Name)
+	span.SetAttr("db.operation", op)
+	return &mgoOp{
+		span:       span,
+		startT:     time.Now(),
+		collection: c.Name,
+		op:         op,
+	}
+}
+
+func (o *mgoOp) end(err error) {
+	result := metrics.ResultOk
+	if err != nil && err != mgo.ErrNotFound {
+		result = metrics.ResultError
+		o.span.SetError(err)
+	}
+	o.span.End()
+	metrics.MongoLatency.Observe(time.Since(o.startT).Seconds(), o.collection, o.op, result)
+}
+
+func (c *TracedCollection) Insert(docs ...interface{}) error {
+	op := c.start("insert")
+	op.span.SetAttr("db.docs", len(docs))
+	err := c.Collection.Insert(docs...)
+	op.end(err)
+	return err
+}
+
+func (c *TracedCollection) Update(selector, update interface{}) error {
+	op := c.start("update")
+	err := c.Collection.Update(selector, update)
+	op.end(err)
+	return err
+}
+
+func (c *TracedCollection) UpdateId(id, update interface{}) error {
+	op := c.start("updateId")
+	err := c.Collection.UpdateId(id, update)
+	op.end(err)
+	return err
+}
+
+func (c *TracedCollection) UpdateAll(selector, update interface{}) (*mgo.ChangeInfo, error) {
+	op := c.start("updateAll")
+	info, err := c.Collection.UpdateAll(selector, update)
+	op.end(err)
+	return info, err
+}
+
+func (c *TracedCollection) Upsert(selector, update interface{}) (*mgo.ChangeInfo, error) {
+	op := c.start("upsert")
+	info, err := c.Collection.Upsert(selector, update)
+	op.end(err)
+	return info, err
+}
+
+func (c *TracedCollection) UpsertId(id, update interface{}) (*mgo.ChangeInfo, error) {
+	op := c.start("upsertId")
+	info, err := c.Collection.UpsertId(id, update)
+	op.end(err)
+	return info, err
+}
+
+func (c *TracedCollection) Remove(selector interface{}) error {
+	op := c.start("remove")
+	err := c.Collection.Remove(selector)
+	op.end(err)
+	return err
+}
+
+func (c *TracedCollection) RemoveId(id interface{}) error {
+	op := c.start("removeId")
+	err := c.Collection.RemoveId(id)
+	op.end(err)
+	return err
+}
+
+func (c *TracedCollection) RemoveAll(selector interface{}) (*mgo.ChangeInfo, error) {
+	op := c.start("removeAll")
+	info, err := c.Collection.RemoveAll(selector)
+	op.end(err)
+	return info, err
+}
+
+func (c *TracedCollection) Count() (int, error) {
+	op := c.start("count")
+	n, err := c.Collection.Count()
+	op.end(err)
+	return n, err
+}
+
+func (c *TracedCollection) Find(query interface{}) *TracedQuery {
+	return &TracedQuery{Query: c.Collection.Find(query), c: c}
+}
+
+func (c *TracedCollection) FindId(id interface{}) *TracedQuery {
+	return &TracedQuery{Query: c.Collection.FindId(id), c: c}
+}
+
+// 链式调用的方法返回 TracedQuery 本身，保证最后执行时仍然记录 span
+type TracedQuery struct {
+	*mgo.Query
+	c *TracedCollection
+}
+
+func (q *TracedQuery) Sort(fields ...string) *TracedQuery {
+	q.Query.Sort(fields...)
+	return q
+}
+
+func (q *TracedQuery) Limit(n int) *TracedQuery {
+	q.Query.Limit(n)
+	return q
+}
+
+func (q *TracedQuery) Skip(n int) *TracedQuery {
+	q.Query.Skip(n)
+	return q
+}
+
+func (q *TracedQuery) Select(selector interface{}) *TracedQuery {
+	q.Query.Select(selector)
+	return q
+}
+
+func (q *TracedQuery) Hint(indexKey ...string) *TracedQuery {
+	q.Query.Hint(indexKey...)
+	return q
+}
+
+func (q *TracedQuery) Batch(n int) *TracedQuery {
+	q.Query.Batch(n)
+	return q
+}
+
+func (q *TracedQuery) SetMaxTime(d time.Duration) *TracedQuery {
+	q.Query.SetMaxTime(d)
+	return q
+}
+
+func (q *TracedQuery) One(result interface{}) error {
+	op := q.c.start("findOne")
+	err := q.Query.One(result)
+	op.end(err)
+	return err
+}
+
+func (q *TracedQuery) All(result interface{}) error {
+	op := q.c.start("find")
+	err := q.Query.All(result)
+	op.end(err)
+	return err
+}
+
+func (q *TracedQuery) Count() (int, error) {
+	op := q.c.start("count")
+	n, err := q.Query.Count()
+	op.end(err)
+	return n, err
+}
+
+func (q *TracedQuery) Distinct(key string, result interface{}) error {
+	op := q.c.start("distinct")
+	err := q.Query.Distinct(key, result)
+	op.end(err)
+	return err
+}
+
+func (q *TracedQuery) Apply(change mgo.Change, result interface{}) (*mgo.ChangeInfo, error) {
+	op := q.c.start("findAndModify")
+	info, err := q.Query.Apply(change, result)
+	op.end(err)
+	return info, err
+}
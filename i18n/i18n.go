@@ -0,0 +1,111 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	LangZh = "zh"
+	LangEn = "en"
+)
+
+// 客户端没有指定语言，或者指定的语言没有对应的信息时使用
+// 注册的错误码在客户端没有指定语言时使用原来的 Msg，不使用 DefaultLang
+var DefaultLang = LangZh
+
+// 语言 -> 消息 key -> 消息模板，模板使用 fmt 的格式
+var (
+	catalogLock sync.RWMutex
+	catalogs    = make(map[string]map[string]string)
+)
+
+// 添加消息，已存在的 key 会被覆盖
+// 各个模块在 init 中注册自己的消息，key 使用模块名作为前缀，比如 roleapp.nameExists
+func Register(lang string, msgs map[string]string) {
+	lang = normalize(lang)
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	catalog, ok := catalogs[lang]
+	if !ok {
+		catalog = make(map[string]string, len(msgs))
+		catalogs[lang] = catalog
+	}
+	for k, v := range msgs {
+		catalog[k] = v
+	}
+}
+
+// 查找消息模板，lang 中没有时查找 DefaultLang
+func Lookup(lang, key string) (string, bool) {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+	if tmpl, ok := catalogs[normalize(lang)][key]; ok {
+		return tmpl, true
+	}
+	tmpl, ok := catalogs[DefaultLang][key]
+	return tmpl, ok
+}
+
+// 翻译消息，没有找到时返回 key 本身
+func T(lang, key string, args ...interface{}) string {
+	tmpl, ok := Lookup(lang, key)
+	if !ok {
+		tmpl = key
+	}
+	if len(args) == 0 {
+		return tmpl
+	}
+	return fmt.Sprintf(tmpl, args...)
+}
+
+// 错误码对应的消息 key，用于没有设置 MsgKey 的错误
+func CodeKey(code int) string {
+	return fmt.Sprintf("err.%d", code)
+}
+
+// 已注册消息的语言
+func Langs() []string {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	return langs
+}
+
+func supported(lang string) bool {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// zh_CN 转为 zh-cn
+func normalize(lang string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(lang), "_", "-", -1))
+}
+
+// 延迟翻译的消息，可以作为 error 返回，在 handler 中按请求的语言翻译
+// Error() 使用 DefaultLang
+type Message struct {
+	Key  string
+	Args []interface{}
+}
+
+func New(key string, args ...interface{}) *Message {
+	return &Message{
+		Key:  key,
+		Args: args,
+	}
+}
+
+func (m *Message) Error() string {
+	return m.In(DefaultLang)
+}
+
+func (m *Message) In(lang string) string {
+	return T(lang, m.Key, m.Args...)
+}
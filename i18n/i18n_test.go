@@ -0,0 +1,43 @@
+package i18n
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	Register(LangZh, map[string]string{"test.hello": "你好 %s"})
+	Register(LangEn, map[string]string{"test.hello": "hello %s"})
+	Register("zh-tw", map[string]string{"test.hello": "妳好 %s"})
+
+	cases := []struct {
+		query, header, lang string
+	}{
+		{"", "", DefaultLang},
+		{"en", "zh-CN", LangEn},
+		{"fr", "en-US,en;q=0.9", LangEn},
+		{"", "zh-TW,zh;q=0.9", "zh-tw"},
+		{"", "zh_CN", LangZh},
+		{"", "fr;q=1, en;q=0.5, zh;q=0.8", LangZh},
+		{"", "en;q=0, fr", DefaultLang},
+		{"", "*", DefaultLang},
+	}
+	for _, cs := range cases {
+		if lang := Negotiate(cs.query, cs.header); lang != cs.lang {
+			t.Error("unexpected lang", cs.query, cs.header, lang, cs.lang)
+		}
+	}
+
+	if msg := T(LangEn, "test.hello", "a"); msg != "hello a" {
+		t.Error(msg)
+	}
+	// 没有的语言使用 DefaultLang，没有的 key 返回 key
+	if msg := T("fr", "test.hello", "a"); msg != "你好 a" {
+		t.Error(msg)
+	}
+	if msg := T(LangEn, "test.none"); msg != "test.none" {
+		t.Error(msg)
+	}
+
+	m := New("test.hello", "b")
+	if m.Error() != "你好 b" || m.In(LangEn) != "hello b" {
+		t.Error("unexpected message", m.Error(), m.In(LangEn))
+	}
+}
@@ -0,0 +1,103 @@
+package i18n
+
+import (
+	"github.com/gin-gonic/gin"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 指定语言的 query 参数，优先于 Accept-Language
+var QueryKey = "lang"
+
+const ctxLangKey = "I18NLANGKEY"
+
+// 本次请求使用的语言，结果缓存在 context 中
+func Lang(c *gin.Context) string {
+	if lang := c.GetString(ctxLangKey); lang != "" {
+		return lang
+	}
+	lang := Negotiate(c.Query(QueryKey), c.GetHeader("Accept-Language"))
+	c.Set(ctxLangKey, lang)
+	return lang
+}
+
+// 客户端是否通过 query 参数或 Accept-Language 指定了已注册的语言
+// 没有指定时，原本就有固定信息的错误（比如注册的错误码）保持原来的信息
+func Requested(c *gin.Context) bool {
+	return negotiate(c.Query(QueryKey), c.GetHeader("Accept-Language")) != ""
+}
+
+// 按 query 参数与 Accept-Language 选择已注册的语言，都不匹配时返回 DefaultLang
+// zh-CN 没有注册时匹配 zh
+func Negotiate(query, acceptLanguage string) string {
+	if lang := negotiate(query, acceptLanguage); lang != "" {
+		return lang
+	}
+	return DefaultLang
+}
+
+func negotiate(query, acceptLanguage string) string {
+	if lang := match(query); lang != "" {
+		return lang
+	}
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if lang := match(tag); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+func match(tag string) string {
+	tag = normalize(tag)
+	if tag == "" || tag == "*" {
+		return ""
+	}
+	if supported(tag) {
+		return tag
+	}
+	if idx := strings.Index(tag, "-"); idx > 0 && supported(tag[:idx]) {
+		return tag[:idx]
+	}
+	return ""
+}
+
+type weightedTag struct {
+	tag string
+	q   float64
+}
+
+// 按 q 值从高到低排序，q 为 0 的语言不接受
+func parseAcceptLanguage(header string) []string {
+	var tags []weightedTag
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weightedTag{tag: tag, q: q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	ret := make([]string, 0, len(tags))
+	for _, t := range tags {
+		ret = append(ret, t.tag)
+	}
+	return ret
+}
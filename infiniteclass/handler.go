@@ -20,18 +20,18 @@ type NewInfiniteClassForm struct {
 func NewInfiniteClassHandler(c *gin.Context) {
 	var form NewInfiniteClassForm
 	if err := c.BindJSON(&form); err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
 	domain := c.Param("domain")
 
-	db := Opt.Ds.CopyDs()
+	db := Opt.Ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	ic, err := NewInfiniteClass(db, form.ParentId, form.Name, form.Icon, form.Info, domain)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
@@ -49,32 +49,32 @@ type UpdateInfiniteClassForm struct {
 func UpdateInfiniteClassHandler(c *gin.Context) {
 	var form UpdateInfiniteClassForm
 	if err := c.BindJSON(&form); err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
 	id := c.Param("id")
 
-	db := Opt.Ds.CopyDs()
+	db := Opt.Ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	ic, err := GetInfiniteClassById(db, id)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
 	if ic == nil {
-		returnfun.ReturnErrJson(c, "无指定id的分类信息")
+		returnfun.ReturnErrKeyJson(c, msgClassNotFound)
 		return
 	}
 
 	ic.Name = form.Name
 	ic.Icon = form.Icon
 	ic.Info = form.Info
-	err = db.C(Opt.TbName).UpdateId(ic.Id, ic)
+	err = db.TC(Opt.TbName).UpdateId(ic.Id, ic)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
@@ -85,17 +85,17 @@ func UpdateInfiniteClassHandler(c *gin.Context) {
 // 禁用分类
 func DisableInfiniteClassHandler(c *gin.Context) {
 	id := c.Param("id")
-	db := Opt.Ds.CopyDs()
+	db := Opt.Ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	ic, err := GetInfiniteClassById(db, id)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
 	if ic == nil {
-		returnfun.ReturnErrJson(c, "无指定id的分类信息")
+		returnfun.ReturnErrKeyJson(c, msgClassNotFound)
 		return
 	}
 
@@ -105,9 +105,9 @@ func DisableInfiniteClassHandler(c *gin.Context) {
 		},
 	}
 
-	err = db.C(Opt.TbName).UpdateId(ic.Id, update)
+	err = db.TC(Opt.TbName).UpdateId(ic.Id, update)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
@@ -118,17 +118,17 @@ func DisableInfiniteClassHandler(c *gin.Context) {
 // 启用分类
 func EnableInfiniteClassHandler(c *gin.Context) {
 	id := c.Param("id")
-	db := Opt.Ds.CopyDs()
+	db := Opt.Ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	ic, err := GetInfiniteClassById(db, id)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
 	if ic == nil {
-		returnfun.ReturnErrJson(c, "无指定id的分类信息")
+		returnfun.ReturnErrKeyJson(c, msgClassNotFound)
 		return
 	}
 
@@ -138,9 +138,9 @@ func EnableInfiniteClassHandler(c *gin.Context) {
 		},
 	}
 
-	err = db.C(Opt.TbName).UpdateId(ic.Id, update)
+	err = db.TC(Opt.TbName).UpdateId(ic.Id, update)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
@@ -165,23 +165,23 @@ func GetInfiniteClassInfoHandler(c *gin.Context) {
 	}
 
 	if id == "" && name == "" {
-		returnfun.ReturnErrJson(c, "缺少id或name")
+		returnfun.ReturnErrKeyJson(c, msgMissingIdOrName)
 		return
 	}
 }
 
 func getInfiniteClassById(c *gin.Context, id string) {
-	db := Opt.Ds.CopyDs()
+	db := Opt.Ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	ic, err := GetInfiniteClassById(db, id)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
 	if ic == nil {
-		returnfun.ReturnErrJson(c, "无指定id的分类数据")
+		returnfun.ReturnErrKeyJson(c, msgClassNotFound)
 		return
 	}
 
@@ -192,7 +192,7 @@ func getInfiniteClassById(c *gin.Context, id string) {
 
 	if disable != "" {
 		if disable != "Y" && disable != "N" {
-			returnfun.ReturnErrJson(c, "错误的 disable 参数值")
+			returnfun.ReturnErrKeyJson(c, msgInvalidDisable)
 			return
 		}
 	}
@@ -204,7 +204,7 @@ func getInfiniteClassById(c *gin.Context, id string) {
 		// 读取其下级
 		err = QueryAllChildrenByParentClass(db, ic, disable)
 		if err != nil {
-			returnfun.ReturnErrJson(c, err.Error())
+			returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 			return
 		}
 	}
@@ -241,14 +241,14 @@ func getInfiniteClassByName(c *gin.Context, name string) {
 
 	if disable != "" {
 		if disable != "Y" && disable != "N" {
-			returnfun.ReturnErrJson(c, "错误的 disable 参数值")
+			returnfun.ReturnErrKeyJson(c, msgInvalidDisable)
 			return
 		}
 	}
 
 	domain := c.Param("domain")
 
-	db := Opt.Ds.CopyDs()
+	db := Opt.Ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	f := bson.M{
@@ -263,9 +263,9 @@ func getInfiniteClassByName(c *gin.Context, name string) {
 	}
 
 	var ics []*InfiniteClass
-	err := db.C(Opt.TbName).Find(f).All(&ics)
+	err := db.TC(Opt.TbName).Find(f).All(&ics)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
@@ -289,13 +289,13 @@ func QueryLevelInfiniteClassHandler(c *gin.Context) {
 	level := c.Param("level")
 	ilevel, err := strconv.Atoi(level)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
 	domain := c.Param("domain")
 
-	db := Opt.Ds.CopyDs()
+	db := Opt.Ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	child := c.Query("children")
@@ -312,7 +312,7 @@ func QueryLevelInfiniteClassHandler(c *gin.Context) {
 
 	if disable != "" {
 		if disable != "Y" && disable != "N" {
-			returnfun.ReturnErrJson(c, "错误的 disable 参数值")
+			returnfun.ReturnErrKeyJson(c, msgInvalidDisable)
 			return
 		}
 	}
@@ -328,11 +328,11 @@ func QueryLevelInfiniteClassHandler(c *gin.Context) {
 			// 根据 pname 和 当前 level 读取 pid
 			pic, err := GetInfiniteClassByNameAndLevel(db, pname, ilevel-1)
 			if err != nil {
-				returnfun.ReturnErrJson(c, err.Error())
+				returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 				return
 			}
 			if pic == nil {
-				returnfun.ReturnErrJson(c, "无数据匹配指定的pname")
+				returnfun.ReturnErrKeyJson(c, msgPnameNotFound)
 				return
 			}
 			pid = pic.ParentId
@@ -341,7 +341,7 @@ func QueryLevelInfiniteClassHandler(c *gin.Context) {
 
 	ics, err := QueryInfiniteClassByLevel(db, domain, pid, ilevel, disable, more)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
@@ -353,7 +353,7 @@ func QueryLevelInfiniteClassHandler(c *gin.Context) {
 func QueryInfiniteClassUseParentIdHandler(c *gin.Context) {
 	pid := c.Param("id")
 
-	db := Opt.Ds.CopyDs()
+	db := Opt.Ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	// disable 参数，如果不传，就是选择所有，如果传了，就是指定状态的
@@ -363,7 +363,7 @@ func QueryInfiniteClassUseParentIdHandler(c *gin.Context) {
 
 	if disable != "" {
 		if disable != "Y" && disable != "N" {
-			returnfun.ReturnErrJson(c, "错误的 disable 参数值")
+			returnfun.ReturnErrKeyJson(c, msgInvalidDisable)
 			return
 		}
 	}
@@ -378,9 +378,9 @@ func QueryInfiniteClassUseParentIdHandler(c *gin.Context) {
 	}
 
 	var ics []*InfiniteClass
-	err := db.C(Opt.TbName).Find(f).All(&ics)
+	err := db.TC(Opt.TbName).Find(f).All(&ics)
 	if err != nil {
-		returnfun.ReturnErrJson(c, err.Error())
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
@@ -0,0 +1,38 @@
+package infiniteclass
+
+import "github.com/leyle/ginbase/i18n"
+
+// 返回给客户端的信息
+const (
+	msgClassNotFound    = "infiniteclass.classNotFound"
+	msgMissingIdOrName  = "infiniteclass.missingIdOrName"
+	msgInvalidDisable   = "infiniteclass.invalidDisable"
+	msgPnameNotFound    = "infiniteclass.pnameNotFound"
+	msgParentNotFound   = "infiniteclass.parentNotFound"
+	msgNameExists       = "infiniteclass.nameExists"
+	msgNewParentMissing = "infiniteclass.newParentMissing"
+	msgParentDisabled   = "infiniteclass.parentDisabled"
+)
+
+func init() {
+	i18n.Register(i18n.LangZh, map[string]string{
+		msgClassNotFound:    "无指定id的分类信息",
+		msgMissingIdOrName:  "缺少id或name",
+		msgInvalidDisable:   "错误的 disable 参数值",
+		msgPnameNotFound:    "无数据匹配指定的pname",
+		msgParentNotFound:   "无指定id的父级分类信息",
+		msgNameExists:       "新建分类时，已存在domain[%s]父级为[%s]的子分类名[%s]",
+		msgNewParentMissing: "新建分类时，不存在指定的父级[%s]信息",
+		msgParentDisabled:   "新建分类时，父级[%s][%s]分类已被禁用",
+	})
+	i18n.Register(i18n.LangEn, map[string]string{
+		msgClassNotFound:    "no class for this id",
+		msgMissingIdOrName:  "missing id or name",
+		msgInvalidDisable:   "invalid disable parameter",
+		msgPnameNotFound:    "no data matches the pname",
+		msgParentNotFound:   "no parent class for this id",
+		msgNameExists:       "class name [%[3]s] already exists under parent [%[2]s] in domain [%[1]s]",
+		msgNewParentMissing: "parent class [%s] does not exist",
+		msgParentDisabled:   "parent class [%s][%s] is disabled",
+	})
+}
@@ -4,8 +4,8 @@ import (
 	"fmt"
 	. "github.com/leyle/ginbase/consolelog"
 	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/i18n"
 	"github.com/leyle/ginbase/util"
-	"github.com/pkg/errors"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -48,7 +48,7 @@ func CalcLevelByParentId(db *dbandmq.Ds, pid string) (int, error) {
 	}
 
 	if ic == nil {
-		return -1, errors.New("无指定id的父级分类信息")
+		return -1, i18n.New(msgParentNotFound)
 	}
 
 	pLevel := ic.Level
@@ -63,7 +63,7 @@ func NewInfiniteClass(db *dbandmq.Ds, pid, name, icon, info, domain string) (*In
 	}
 
 	if dbc != nil {
-		e := fmt.Errorf("新建分类时，已存在domain[%s]父级为[%s]的子分类名[%s]", domain, pid, name)
+		e := i18n.New(msgNameExists, domain, pid, name)
 		Logger.Error("", e.Error())
 		return nil, e
 	}
@@ -76,13 +76,13 @@ func NewInfiniteClass(db *dbandmq.Ds, pid, name, icon, info, domain string) (*In
 		}
 
 		if dbpc == nil {
-			e := fmt.Errorf("新建分类时，不存在指定的父级[%s]信息", pid)
+			e := i18n.New(msgNewParentMissing, pid)
 			Logger.Error("", e.Error())
 			return nil, e
 		}
 
 		if dbpc.Disable {
-			e := fmt.Errorf("新建分类时，父级[%s][%s]分类已被禁用", pid, dbpc.Name)
+			e := i18n.New(msgParentDisabled, pid, dbpc.Name)
 			Logger.Error("", e.Error())
 			return nil, e
 		}
@@ -104,7 +104,7 @@ func NewInfiniteClass(db *dbandmq.Ds, pid, name, icon, info, domain string) (*In
 		Disable:  false,
 	}
 
-	err = db.C(Opt.TbName).Insert(c)
+	err = db.TC(Opt.TbName).Insert(c)
 	if err != nil {
 		Logger.Errorf("", "新建%s失败,%s", c.Desc(), err.Error())
 		return nil, err
@@ -122,7 +122,7 @@ func GetInfiniteClassByParentIdAndName(db *dbandmq.Ds, pid, name, domain string)
 	}
 
 	var c *InfiniteClass
-	err := db.C(Opt.TbName).Find(f).One(&c)
+	err := db.TC(Opt.TbName).Find(f).One(&c)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "根据ParentId[%s]和name[%s]及domain[%s]查询分类信息失败, %s", pid, name, domain, err.Error())
 		return nil, err
@@ -134,7 +134,7 @@ func GetInfiniteClassByParentIdAndName(db *dbandmq.Ds, pid, name, domain string)
 // 根据 id 读取分类信息
 func GetInfiniteClassById(db *dbandmq.Ds, id string) (*InfiniteClass, error) {
 	var ic *InfiniteClass
-	err := db.C(Opt.TbName).FindId(id).One(&ic)
+	err := db.TC(Opt.TbName).FindId(id).One(&ic)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "根据id[%s]读取分类信息失败, %s", id, err.Error())
 		return nil, err
@@ -159,7 +159,7 @@ func QueryAllChildrenByParentClass(db *dbandmq.Ds, pic *InfiniteClass, disable s
 		// 不做处理，筛选全部信息
 	}
 
-	err = db.C(Opt.TbName).Find(f).All(&ics)
+	err = db.TC(Opt.TbName).Find(f).All(&ics)
 	if err != nil {
 		Logger.Errorf("", "根据parent[%s][%s]读取其子分类失败, %s", pic.Id, pic.Name, err.Error())
 		return err
@@ -196,7 +196,7 @@ func QueryInfiniteClassByLevel(db *dbandmq.Ds, domain, pid string, level int, di
 		// 不做处理，筛选全部状态
 	}
 
-	err = db.C(Opt.TbName).Find(f).All(&ics)
+	err = db.TC(Opt.TbName).Find(f).All(&ics)
 	if err != nil {
 		Logger.Errorf("", "根据level[%d]读取分类列表失败, %s", level, err.Error())
 		return nil, err
@@ -223,7 +223,7 @@ func GetInfiniteClassByNameAndLevel(ds *dbandmq.Ds, name string, level int) (*In
 	}
 
 	var ic *InfiniteClass
-	err := ds.C(Opt.TbName).Find(f).One(&ic)
+	err := ds.TC(Opt.TbName).Find(f).One(&ic)
 	if err != nil && err != mgo.ErrNotFound {
 		return nil, err
 	}
@@ -0,0 +1,152 @@
+package loginlimit
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/util"
+	"net/http"
+	"strconv"
+)
+
+// 需要验证码时设置的响应头，调用方据此展示验证码
+var CaptchaHeader = "X-Require-Captcha"
+
+const (
+	ctxStatusKey  = "LOGINLIMITSTATUS"
+	ctxAccountKey = "LOGINLIMITACCOUNT"
+	ctxLimiterKey = "LOGINLIMITLIMITER"
+)
+
+// 登录限制管理的权限
+const (
+	LoginLimitPermissionId   = "5e8c1a3cfa080a3ac0956dc2"
+	LoginLimitPermissionName = "loginLimitManager"
+)
+
+// 初始化管理接口的 item 与 permission
+// 需要在 roleapp.InitRoleApp 之后调用
+func InitLoginLimit(ds *dbandmq.Ds, uriPrefix string) error {
+	curT := util.GetCurTime()
+	items := []*roleapp.Item{
+		roleapp.GenerateItem(curT, "loginlimit:lockouts", "GET", uriPrefix+"/loginlimit/lockouts"),
+		roleapp.GenerateItem(curT, "loginlimit:status", "GET", uriPrefix+"/loginlimit/status"),
+		roleapp.GenerateItem(curT, "loginlimit:clear", "POST", uriPrefix+"/loginlimit/clear"),
+	}
+
+	var itemIds []string
+	for _, item := range items {
+		dbitem, err := roleapp.AddItem(ds, item, roleapp.KeyQueryName)
+		if err != nil {
+			return err
+		}
+		itemIds = append(itemIds, dbitem.Id)
+	}
+
+	p := &roleapp.Permission{
+		Id:      LoginLimitPermissionId,
+		Name:    LoginLimitPermissionName,
+		ItemIds: itemIds,
+		Deleted: false,
+		Source:  roleapp.RoleDataSourceInternal,
+		CreateT: curT,
+		UpdateT: curT,
+	}
+	return roleapp.AddPermission(ds, p, roleapp.KeyQueryId)
+}
+
+// 验证前调用，账户或 ip 被锁定时返回 429 并终止请求，返回 false
+// redis 异常时只记录日志并放行，不影响正常登录
+func (l *Limiter) Guard(c *gin.Context, account string) bool {
+	if account != "" {
+		c.Set(ctxAccountKey, account)
+	}
+
+	s, err := l.Check(account, c.ClientIP())
+	if err == ErrLocked {
+		Logger.Warnf(middleware.GetReqId(c), "账户[%s]或ip[%s]已被锁定, %d秒后重试", account, c.ClientIP(), s.RetryAfter)
+		c.Header("Retry-After", strconv.FormatInt(s.RetryAfter, 10))
+		returnfun.ReturnJson(c, http.StatusTooManyRequests, http.StatusTooManyRequests, err.Error(), s)
+		return false
+	}
+	if err != nil {
+		return true
+	}
+
+	l.setStatus(c, s)
+	return true
+}
+
+// 验证后调用，记录成功或失败
+func (l *Limiter) Report(c *gin.Context, account string, success bool) {
+	if success {
+		err := l.Success(account)
+		if err != nil {
+			Logger.Errorf(middleware.GetReqId(c), "清除账户[%s]登录失败记录失败, %s", account, err.Error())
+		}
+		return
+	}
+
+	s, err := l.Fail(account, c.ClientIP())
+	if err != nil {
+		return
+	}
+	l.setStatus(c, s)
+}
+
+func (l *Limiter) setStatus(c *gin.Context, s *Status) {
+	c.Set(ctxStatusKey, s)
+	if s.RequireCaptcha {
+		c.Header(CaptchaHeader, "true")
+	}
+}
+
+// 读取本次请求的限制状态，handler 可以据此决定是否校验验证码
+func GetStatus(c *gin.Context) *Status {
+	v, ok := c.Get(ctxStatusKey)
+	if !ok {
+		return nil
+	}
+	return v.(*Status)
+}
+
+// 在 handler 中解析出账户后、验证密码之前调用，供 Middleware 记录结果
+// 同时检查账户是否被锁定，返回 false 时已经返回 429，handler 需要直接返回
+// 没有使用 Middleware 时只记录账户，需要自行调用 Guard
+func SetAccount(c *gin.Context, account string) bool {
+	c.Set(ctxAccountKey, account)
+	v, ok := c.Get(ctxLimiterKey)
+	if !ok || account == "" {
+		return true
+	}
+	return v.(*Limiter).Guard(c, account)
+}
+
+// 通用的中间件，可以放在任意验证中间件或者登录接口之前
+// 请求前按 ip 检查，账户由 accountFunc 提供，或者由 handler 在验证密码前调用 SetAccount 检查
+// 请求后响应为 401 时记录失败，2xx 时清除账户的失败记录
+func (l *Limiter) Middleware(accountFunc func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ctxLimiterKey, l)
+		account := ""
+		if accountFunc != nil {
+			account = accountFunc(c)
+		}
+		if !l.Guard(c, account) {
+			return
+		}
+
+		c.Next()
+
+		account = c.GetString(ctxAccountKey)
+		status := c.Writer.Status()
+		if status == http.StatusUnauthorized {
+			l.Report(c, account, false)
+		} else if status >= 200 && status < 300 {
+			l.Report(c, account, true)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package loginlimit
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+)
+
+// 当前所有锁定
+func ListLockoutsHandler(c *gin.Context, l *Limiter) {
+	los, err := l.ListLockouts()
+	middleware.StopExec(err)
+
+	returnfun.ReturnOKJson(c, los)
+	return
+}
+
+// 读取账户或 ip 的失败次数与锁定状态
+func GetLockoutHandler(c *gin.Context, l *Limiter) {
+	kind := c.Query("kind")
+	id := c.Query("id")
+	if err := checkKind(kind); err != nil || id == "" {
+		returnfun.ReturnErrJson(c, "kind 或 id 错误")
+		return
+	}
+
+	lo, err := l.Get(kind, id)
+	middleware.StopExec(err)
+
+	returnfun.ReturnOKJson(c, lo)
+	return
+}
+
+// 解除锁定
+type ClearForm struct {
+	Kind string `json:"kind" binding:"required"`
+	Id   string `json:"id" binding:"required"`
+}
+
+func ClearLockoutHandler(c *gin.Context, l *Limiter) {
+	var form ClearForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	if err = checkKind(form.Kind); err != nil {
+		returnfun.ReturnErrJson(c, err.Error())
+		return
+	}
+
+	err = l.Clear(form.Kind, form.Id)
+	middleware.StopExec(err)
+
+	operator := ""
+	if curUser := roleapp.GetCurUser(c); curUser != nil {
+		operator = curUser.UserId
+	}
+	Logger.Infof(middleware.GetReqId(c), "用户[%s]解除了[%s][%s]的登录锁定", operator, form.Kind, form.Id)
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
@@ -0,0 +1,277 @@
+package loginlimit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	. "github.com/leyle/ginbase/consolelog"
+	"strings"
+	"time"
+)
+
+// 限制的维度
+const (
+	KindAccount = "account"
+	KindIp      = "ip"
+)
+
+const (
+	failPrefix  = "LOGINLIMIT-FAIL-"  // 窗口内的失败次数
+	lockPrefix  = "LOGINLIMIT-LOCK-"  // 锁定标记，ttl 即剩余锁定时间
+	levelPrefix = "LOGINLIMIT-LEVEL-" // 已经被锁定的次数，用于计算指数锁定时间
+)
+
+var ErrLocked = errors.New("尝试次数过多，请稍后再试")
+
+type Option struct {
+	R *redis.Client
+
+	AccountMaxFails int           // 账户在窗口内允许的失败次数，默认 5
+	IpMaxFails      int           // ip 在窗口内允许的失败次数，默认 20
+	CaptchaAfter    int           // 账户或 ip 失败次数达到后要求验证码，0 表示不要求
+	Window          time.Duration // 失败次数的统计窗口，默认 15 分钟
+	BaseLockout     time.Duration // 第一次锁定的时长，之后每次翻倍，默认 1 分钟
+	MaxLockout      time.Duration // 最长锁定时长，默认 24 小时
+	LevelTTL        time.Duration // 锁定次数的保存时间，过后锁定时长从头计算，默认 24 小时
+}
+
+type Limiter struct {
+	opt *Option
+}
+
+func NewLimiter(opt *Option) *Limiter {
+	if opt.AccountMaxFails <= 0 {
+		opt.AccountMaxFails = 5
+	}
+	if opt.IpMaxFails <= 0 {
+		opt.IpMaxFails = 20
+	}
+	if opt.Window <= 0 {
+		opt.Window = 15 * time.Minute
+	}
+	if opt.BaseLockout <= 0 {
+		opt.BaseLockout = time.Minute
+	}
+	if opt.MaxLockout <= 0 {
+		opt.MaxLockout = 24 * time.Hour
+	}
+	if opt.LevelTTL <= 0 {
+		opt.LevelTTL = 24 * time.Hour
+	}
+	return &Limiter{opt: opt}
+}
+
+// 检查结果，返回给调用方
+type Status struct {
+	Locked         bool   `json:"locked"`
+	LockedBy       string `json:"lockedBy,omitempty"` // account 或 ip
+	RetryAfter     int64  `json:"retryAfter"`         // 剩余锁定秒数
+	Fails          int64  `json:"fails"`              // 账户与 ip 中较大的失败次数
+	RequireCaptcha bool   `json:"requireCaptcha"`
+}
+
+// 单个维度的状态，管理接口使用
+type Lockout struct {
+	Kind       string `json:"kind"`
+	Id         string `json:"id"`
+	Fails      int64  `json:"fails"`
+	Level      int64  `json:"level"`
+	RetryAfter int64  `json:"retryAfter"`
+}
+
+func key(prefix, kind, id string) string {
+	return prefix + kind + "-" + strings.ToLower(id)
+}
+
+func (l *Limiter) maxFails(kind string) int {
+	if kind == KindIp {
+		return l.opt.IpMaxFails
+	}
+	return l.opt.AccountMaxFails
+}
+
+// 第 level 次锁定的时长，level 从 0 开始
+func lockoutDuration(base, max time.Duration, level int64) time.Duration {
+	d := base
+	for i := int64(0); i < level; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+func (l *Limiter) get(kind, id string) (*Lockout, error) {
+	lo := &Lockout{Kind: kind, Id: id}
+	if id == "" {
+		return lo, nil
+	}
+
+	pipe := l.opt.R.Pipeline()
+	fails := pipe.Get(key(failPrefix, kind, id))
+	level := pipe.Get(key(levelPrefix, kind, id))
+	ttl := pipe.TTL(key(lockPrefix, kind, id))
+	_, err := pipe.Exec()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	lo.Fails, _ = fails.Int64()
+	lo.Level, _ = level.Int64()
+	if d := ttl.Val(); d > 0 {
+		lo.RetryAfter = int64((d + time.Second - 1) / time.Second)
+	}
+	return lo, nil
+}
+
+func (l *Limiter) merge(los ...*Lockout) *Status {
+	s := &Status{}
+	for _, lo := range los {
+		if lo.RetryAfter > s.RetryAfter {
+			s.Locked = true
+			s.LockedBy = lo.Kind
+			s.RetryAfter = lo.RetryAfter
+		}
+		if lo.Fails > s.Fails {
+			s.Fails = lo.Fails
+		}
+	}
+	s.RequireCaptcha = l.opt.CaptchaAfter > 0 && s.Fails >= int64(l.opt.CaptchaAfter)
+	return s
+}
+
+// 验证前调用，账户或者 ip 被锁定时返回 ErrLocked
+// account 或 ip 为空时不检查对应的维度
+func (l *Limiter) Check(account, ip string) (*Status, error) {
+	alo, err := l.get(KindAccount, account)
+	if err != nil {
+		Logger.Errorf("", "读取登录限制状态失败, %s", err.Error())
+		return nil, err
+	}
+	ilo, err := l.get(KindIp, ip)
+	if err != nil {
+		Logger.Errorf("", "读取登录限制状态失败, %s", err.Error())
+		return nil, err
+	}
+
+	s := l.merge(alo, ilo)
+	if s.Locked {
+		return s, ErrLocked
+	}
+	return s, nil
+}
+
+// 记录一次失败，失败次数达到上限时锁定，锁定时长按锁定次数指数增长
+func (l *Limiter) Fail(account, ip string) (*Status, error) {
+	var los []*Lockout
+	for _, kv := range [][2]string{{KindAccount, account}, {KindIp, ip}} {
+		kind, id := kv[0], kv[1]
+		if id == "" {
+			continue
+		}
+		lo, err := l.fail(kind, id)
+		if err != nil {
+			Logger.Errorf("", "记录登录失败次数失败, %s", err.Error())
+			return nil, err
+		}
+		los = append(los, lo)
+	}
+	return l.merge(los...), nil
+}
+
+func (l *Limiter) fail(kind, id string) (*Lockout, error) {
+	fk := key(failPrefix, kind, id)
+
+	pipe := l.opt.R.TxPipeline()
+	incr := pipe.Incr(fk)
+	pipe.Expire(fk, l.opt.Window)
+	_, err := pipe.Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	lo := &Lockout{Kind: kind, Id: id, Fails: incr.Val()}
+	if lo.Fails < int64(l.maxFails(kind)) {
+		return lo, nil
+	}
+
+	lk := key(levelPrefix, kind, id)
+	level, err := l.opt.R.Incr(lk).Result()
+	if err != nil {
+		return nil, err
+	}
+	d := lockoutDuration(l.opt.BaseLockout, l.opt.MaxLockout, level-1)
+
+	pipe = l.opt.R.TxPipeline()
+	pipe.Expire(lk, l.opt.LevelTTL+d)
+	pipe.Set(key(lockPrefix, kind, id), level, d)
+	pipe.Del(fk)
+	_, err = pipe.Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	Logger.Warnf("", "登录失败次数过多，锁定[%s][%s] %s", kind, id, d.String())
+	lo.Level = level
+	lo.RetryAfter = int64(d / time.Second)
+	return lo, nil
+}
+
+// 验证成功，清除账户的失败记录
+// ip 的失败次数不清除，避免同一个 ip 用少量正确账户掩护撞库
+func (l *Limiter) Success(account string) error {
+	if account == "" {
+		return nil
+	}
+	return l.opt.R.Del(key(failPrefix, KindAccount, account), key(levelPrefix, KindAccount, account)).Err()
+}
+
+func (l *Limiter) Get(kind, id string) (*Lockout, error) {
+	return l.get(kind, id)
+}
+
+// 清除锁定与失败记录
+func (l *Limiter) Clear(kind, id string) error {
+	return l.opt.R.Del(key(failPrefix, kind, id), key(levelPrefix, kind, id), key(lockPrefix, kind, id)).Err()
+}
+
+// 列出当前所有锁定
+func (l *Limiter) ListLockouts() ([]*Lockout, error) {
+	var ret []*Lockout
+	var cursor uint64
+	for {
+		keys, next, err := l.opt.R.Scan(cursor, lockPrefix+"*", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			kv := strings.SplitN(strings.TrimPrefix(k, lockPrefix), "-", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			lo, err := l.get(kv[0], kv[1])
+			if err != nil {
+				return nil, err
+			}
+			if lo.RetryAfter > 0 {
+				ret = append(ret, lo)
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return ret, nil
+}
+
+func checkKind(kind string) error {
+	if kind != KindAccount && kind != KindIp {
+		return fmt.Errorf("kind 只能是 %s 或 %s", KindAccount, KindIp)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package loginlimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	base, max := time.Minute, time.Hour
+	cases := map[int64]time.Duration{
+		0:  time.Minute,
+		1:  2 * time.Minute,
+		3:  8 * time.Minute,
+		6:  time.Hour,
+		60: time.Hour,
+	}
+	for level, want := range cases {
+		if d := lockoutDuration(base, max, level); d != want {
+			t.Error("level", level, "want", want, "got", d)
+		}
+	}
+}
+
+func TestMergeStatus(t *testing.T) {
+	l := NewLimiter(&Option{CaptchaAfter: 3})
+	s := l.merge(&Lockout{Kind: KindAccount, Fails: 3}, &Lockout{Kind: KindIp, Fails: 1, RetryAfter: 30})
+	if !s.Locked || s.LockedBy != KindIp || s.RetryAfter != 30 {
+		t.Error("ip lockout should win", s)
+	}
+	if !s.RequireCaptcha {
+		t.Error("captcha should be required")
+	}
+}
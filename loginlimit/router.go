@@ -0,0 +1,27 @@
+package loginlimit
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// 登录锁定管理
+// 与 roleapp 一样，外部需要先配置用户验证，把当前用户 SetCurUser 到 context 中
+func LoginLimitRouter(g *gin.RouterGroup, l *Limiter) {
+	llR := g.Group("/loginlimit")
+	{
+		// 当前所有锁定
+		llR.GET("/lockouts", func(c *gin.Context) {
+			ListLockoutsHandler(c, l)
+		})
+
+		// 单个账户或 ip 的状态
+		llR.GET("/status", func(c *gin.Context) {
+			GetLockoutHandler(c, l)
+		})
+
+		// 解除锁定
+		llR.POST("/clear", func(c *gin.Context) {
+			ClearLockoutHandler(c, l)
+		})
+	}
+}
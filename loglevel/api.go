@@ -0,0 +1,44 @@
+package loglevel
+
+import (
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/util"
+)
+
+// 日志级别管理的权限
+const (
+	LogLevelPermissionId   = "5e8c1a3cfa080a3ac0956dc3"
+	LogLevelPermissionName = "logLevelManager"
+)
+
+// 初始化日志级别管理接口的 item 与 permission
+// 需要在 roleapp.InitRoleApp 之后调用
+func InitLogLevel(ds *dbandmq.Ds, uriPrefix string) error {
+	curT := util.GetCurTime()
+	items := []*roleapp.Item{
+		roleapp.GenerateItem(curT, "loglevel:get", "GET", uriPrefix+"/loglevel"),
+		roleapp.GenerateItem(curT, "loglevel:set", "POST", uriPrefix+"/loglevel"),
+		roleapp.GenerateItem(curT, "loglevel:debugtoken", "POST", uriPrefix+"/loglevel/debugtoken"),
+	}
+
+	var itemIds []string
+	for _, item := range items {
+		dbitem, err := roleapp.AddItem(ds, item, roleapp.KeyQueryName)
+		if err != nil {
+			return err
+		}
+		itemIds = append(itemIds, dbitem.Id)
+	}
+
+	p := &roleapp.Permission{
+		Id:      LogLevelPermissionId,
+		Name:    LogLevelPermissionName,
+		ItemIds: itemIds,
+		Deleted: false,
+		Source:  roleapp.RoleDataSourceInternal,
+		CreateT: curT,
+		UpdateT: curT,
+	}
+	return roleapp.AddPermission(ds, p, roleapp.KeyQueryId)
+}
@@ -0,0 +1,161 @@
+package loglevel
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/middleware"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 携带调试签名的请求头
+var DebugHeader = "X-Debug-Log"
+
+const DefaultMaxTTL = time.Hour
+
+var ErrInvalidDebugToken = errors.New("invalid debug token")
+
+type DebugOption struct {
+	Secret string        `json:"secret" yaml:"secret"` // 为空时不启用单请求调试
+	MaxTTL time.Duration `json:"maxTTL" yaml:"maxTTL"` // 签名最长有效期，默认 1 小时
+}
+
+func (o *DebugOption) maxTTL() time.Duration {
+	if o.MaxTTL <= 0 {
+		return DefaultMaxTTL
+	}
+	return o.MaxTTL
+}
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 生成调试签名，格式为 <过期时间 unix 秒>.<随机 nonce>.<hmac>
+// 签名只能使用一次，nonce 在有效期内记录为已使用
+func (o *DebugOption) NewDebugToken(ttl time.Duration) (string, int64, error) {
+	if o.Secret == "" {
+		return "", 0, errors.New("debug secret is not configured")
+	}
+	if ttl <= 0 || ttl > o.maxTTL() {
+		ttl = o.maxTTL()
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", 0, err
+	}
+	expireAt := time.Now().Add(ttl).Unix()
+	payload := strconv.FormatInt(expireAt, 10) + "." + base64.RawURLEncoding.EncodeToString(buf)
+	return payload + "." + sign(o.Secret, payload), expireAt, nil
+}
+
+// 验证签名，返回剩余有效期，不记录使用
+func (o *DebugOption) VerifyDebugToken(token string) (time.Duration, error) {
+	left, _, err := o.verify(token)
+	return left, err
+}
+
+// 验证签名并记录为已使用，同一个签名再次使用时返回 ErrInvalidDebugToken
+// 使用记录只保存在当前进程中
+func (o *DebugOption) UseDebugToken(token string) (time.Duration, error) {
+	left, nonce, err := o.verify(token)
+	if err != nil {
+		return 0, err
+	}
+	if !usedNonces.use(nonce, time.Now().Add(left)) {
+		return 0, ErrInvalidDebugToken
+	}
+	return left, nil
+}
+
+func (o *DebugOption) verify(token string) (time.Duration, string, error) {
+	if o.Secret == "" {
+		return 0, "", ErrInvalidDebugToken
+	}
+	idx := strings.LastIndex(token, ".")
+	if idx < 0 {
+		return 0, "", ErrInvalidDebugToken
+	}
+	payload := token[:idx]
+	if !hmac.Equal([]byte(token[idx+1:]), []byte(sign(o.Secret, payload))) {
+		return 0, "", ErrInvalidDebugToken
+	}
+	parts := strings.SplitN(payload, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", ErrInvalidDebugToken
+	}
+
+	expireAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidDebugToken
+	}
+	left := time.Until(time.Unix(expireAt, 0))
+	// 过期的，或者有效期超过上限的（比如 MaxTTL 被调小之前签发的）都不接受
+	if left <= 0 || left > o.maxTTL() {
+		return 0, "", ErrInvalidDebugToken
+	}
+	return left, parts[1], nil
+}
+
+// 已经使用过的 nonce 与其过期时间
+type nonceSet struct {
+	lock  sync.Mutex
+	nonce map[string]time.Time
+}
+
+var usedNonces = &nonceSet{nonce: make(map[string]time.Time)}
+
+// 记录 nonce，已经使用过时返回 false
+func (s *nonceSet) use(nonce string, expireT time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for k, t := range s.nonce {
+		if now.After(t) {
+			delete(s.nonce, k)
+		}
+	}
+	if _, ok := s.nonce[nonce]; ok {
+		return false
+	}
+	s.nonce[nonce] = expireT
+	return true
+}
+
+// 请求带有效的调试签名时，本次请求的日志全部按 debug 级别输出
+// 需要放在 ReqIdMiddleware 之后
+func DebugMiddleware(opt *DebugOption) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(DebugHeader)
+		if token == "" || opt.Secret == "" {
+			c.Next()
+			return
+		}
+
+		reqId := middleware.GetReqId(c)
+		if _, err := opt.UseDebugToken(token); err != nil {
+			Logger.Warnf(reqId, "调试签名无效, %s", err.Error())
+			c.Next()
+			return
+		}
+
+		// 请求本身的处理时间不会超过这个值，结束后立即删除
+		EnableReqDebug(reqId, opt.maxTTL())
+		defer DisableReqDebug(reqId)
+		// 配置了访问日志策略时，本次请求也完整记录 body
+		middleware.ForceLog(c)
+
+		Logger.Infof(reqId, "本次请求开启debug日志")
+		c.Next()
+	}
+}
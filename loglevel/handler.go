@@ -0,0 +1,92 @@
+package loglevel
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+	"time"
+)
+
+// 读取全局级别与模块级别
+func GetLevelHandler(c *gin.Context) {
+	modules := make(map[string]string)
+	for name, level := range ModuleLevels() {
+		modules[name] = LevelName(level)
+	}
+
+	retData := gin.H{
+		"level":   LevelName(Logger.GetLogLevel()),
+		"modules": modules,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
+
+// 修改级别，module 为空时修改全局级别
+// 修改模块级别时 level 为 default 表示删除模块级别，恢复使用全局级别
+type SetLevelForm struct {
+	Level  string `json:"level" binding:"required"`
+	Module string `json:"module"`
+}
+
+func SetLevelHandler(c *gin.Context) {
+	var form SetLevelForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	operator := ""
+	if curUser := roleapp.GetCurUser(c); curUser != nil {
+		operator = curUser.UserId
+	}
+	reqId := middleware.GetReqId(c)
+
+	if form.Module != "" && form.Level == "default" {
+		ClearModuleLevel(form.Module)
+		Logger.Infof(reqId, "用户[%s]删除了模块[%s]的日志级别", operator, form.Module)
+		returnfun.ReturnOKJson(c, "")
+		return
+	}
+
+	level, err := ParseLevel(form.Level)
+	if err != nil {
+		returnfun.ReturnErrJson(c, err.Error())
+		return
+	}
+
+	if form.Module == "" {
+		Logger.SetLogLevel(level)
+	} else {
+		SetModuleLevel(form.Module, level)
+	}
+	Logger.Infof(reqId, "用户[%s]修改模块[%s]日志级别为[%s]", operator, form.Module, LevelName(level))
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
+
+// 生成单请求调试签名
+type DebugTokenForm struct {
+	Ttl int `json:"ttl"` // 秒，为 0 或者超过上限时使用上限
+}
+
+func NewDebugTokenHandler(c *gin.Context, opt *DebugOption) {
+	var form DebugTokenForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	token, expireAt, err := opt.NewDebugToken(time.Duration(form.Ttl) * time.Second)
+	if err != nil {
+		returnfun.ReturnErrJson(c, err.Error())
+		return
+	}
+
+	retData := gin.H{
+		"header":   DebugHeader,
+		"token":    token,
+		"expireAt": expireAt,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
@@ -0,0 +1,33 @@
+package loglevel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebugToken(t *testing.T) {
+	opt := &DebugOption{Secret: "s1", MaxTTL: 10 * time.Minute}
+	token, _, err := opt.NewDebugToken(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, err := opt.VerifyDebugToken(token)
+	if err != nil || left > 10*time.Minute {
+		t.Error("valid token rejected or ttl not capped", left, err)
+	}
+
+	other := &DebugOption{Secret: "s2"}
+	if _, err = other.VerifyDebugToken(token); err != ErrInvalidDebugToken {
+		t.Error("token signed by other secret should be rejected", err)
+	}
+	if _, err = opt.VerifyDebugToken("1" + token); err != ErrInvalidDebugToken {
+		t.Error("tampered token should be rejected", err)
+	}
+
+	if _, err = opt.UseDebugToken(token); err != nil {
+		t.Error("first use should be accepted", err)
+	}
+	if _, err = opt.UseDebugToken(token); err != ErrInvalidDebugToken {
+		t.Error("token should not be reused", err)
+	}
+}
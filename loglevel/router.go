@@ -0,0 +1,27 @@
+package loglevel
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// 日志级别管理
+// 与 roleapp 一样，外部需要先配置用户验证，把当前用户 SetCurUser 到 context 中
+func LogLevelRouter(g *gin.RouterGroup, opt *DebugOption) {
+	llR := g.Group("/loglevel")
+	{
+		// 读取级别
+		llR.GET("", func(c *gin.Context) {
+			GetLevelHandler(c)
+		})
+
+		// 修改全局或者模块级别
+		llR.POST("", func(c *gin.Context) {
+			SetLevelHandler(c)
+		})
+
+		// 生成单请求调试签名
+		llR.POST("/debugtoken", func(c *gin.Context) {
+			NewDebugTokenHandler(c, opt)
+		})
+	}
+}
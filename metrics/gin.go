@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 没有匹配到路由的请求统一使用这个 route 标签，避免原始路径导致标签数量无限增长
+const (
+	RouteNotFound = "NOT_FOUND"
+	RouteUnknown  = "UNKNOWN"
+)
+
+// 记录请求数、延迟与正在处理的请求数，route 标签为注册路由时的模板，比如 /user/:id
+// 需要放在 RecoveryMiddleware 之前，才能记录到 panic 后最终返回的状态码，SetupGin 已经配置
+func GinMiddleware(e *gin.Engine) gin.HandlerFunc {
+	rr := &routeResolver{e: e}
+	return func(c *gin.Context) {
+		startT := time.Now()
+		HttpInFlight.Inc()
+		defer func() {
+			HttpInFlight.Dec()
+			method := c.Request.Method
+			status := c.Writer.Status()
+			route := rr.resolve(method, c.HandlerName(), c.Request.URL.Path, status)
+			code := strconv.Itoa(status)
+			HttpRequests.Inc(method, route, code)
+			HttpLatency.Observe(time.Since(startT).Seconds(), method, route, code)
+		}()
+		c.Next()
+	}
+}
+
+// 输出 DefaultRegistry 中的全部指标
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		_, _ = DefaultRegistry.WriteTo(c.Writer)
+	}
+}
+
+// gin 1.4 没有 FullPath，根据 engine.Routes() 中的 method 与 handler 名字反查路由模板
+// 同一个 handler 注册到多个路由时，再按路径匹配，静态段多的优先
+type routeResolver struct {
+	e *gin.Engine
+
+	lock   sync.RWMutex
+	routes map[string][]*routeEntry // method + handler name
+	builtT time.Time
+}
+
+// 找不到路由时最多每秒重建一次
+const rebuildInterval = time.Second
+
+type routeEntry struct {
+	path  string
+	parts []string
+}
+
+func (r *routeResolver) rebuild() {
+	routes := make(map[string][]*routeEntry)
+	for _, ri := range r.e.Routes() {
+		key := ri.Method + " " + ri.Handler
+		routes[key] = append(routes[key], &routeEntry{
+			path:  ri.Path,
+			parts: strings.Split(strings.Trim(ri.Path, "/"), "/"),
+		})
+	}
+	r.lock.Lock()
+	r.routes = routes
+	r.builtT = time.Now()
+	r.lock.Unlock()
+}
+
+func (r *routeResolver) canRebuild() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return time.Since(r.builtT) >= rebuildInterval
+}
+
+func (r *routeResolver) lookup(key string) ([]*routeEntry, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.routes == nil {
+		return nil, false
+	}
+	entries, ok := r.routes[key]
+	return entries, ok
+}
+
+func (r *routeResolver) resolve(method, handler, path string, status int) string {
+	key := method + " " + handler
+	entries, ok := r.lookup(key)
+	if !ok {
+		// 404 不重建，避免被随意的路径触发
+		if status == http.StatusNotFound {
+			return RouteNotFound
+		}
+		// 启动后新注册的路由
+		if !r.canRebuild() {
+			return RouteUnknown
+		}
+		r.rebuild()
+		if entries, ok = r.lookup(key); !ok {
+			return RouteUnknown
+		}
+	}
+	if len(entries) == 1 {
+		return entries[0].path
+	}
+
+	best, bestStatic := RouteUnknown, -1
+	for _, entry := range entries {
+		if n := entry.match(path); n > bestStatic {
+			best, bestStatic = entry.path, n
+		}
+	}
+	return best
+}
+
+// 返回匹配的静态段数，不匹配时返回 -1
+func (e *routeEntry) match(path string) int {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	static := 0
+	for i, p := range e.parts {
+		if strings.HasPrefix(p, "*") {
+			return static
+		}
+		if i >= len(segs) {
+			return -1
+		}
+		if strings.HasPrefix(p, ":") {
+			if segs[i] == "" {
+				return -1
+			}
+			continue
+		}
+		if p != segs[i] {
+			return -1
+		}
+		static++
+	}
+	if len(segs) != len(e.parts) {
+		return -1
+	}
+	return static
+}
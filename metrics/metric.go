@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prometheus text 格式的指标，https://prometheus.io/docs/instrumenting/exposition_formats/
+// 只实现了 counter、gauge、histogram 三种类型
+type Collector interface {
+	Name() string
+	write(w io.Writer)
+}
+
+// 默认的 histogram 分桶，单位秒
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 按标签值分组的指标，标签值的个数必须与定义时的标签名个数一致
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64  // counter 与 gauge
+	counts      []uint64 // histogram 每个分桶的计数，不累加
+	sum         float64  // histogram
+	count       uint64   // histogram
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+func (v *vec) Name() string {
+	return v.name
+}
+
+// 调用方需要持有锁
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// 按标签值排序，保证输出稳定
+func (v *vec) sorted() []*series {
+	ret := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		ret = append(ret, s)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return strings.Join(ret[i].labelValues, "\xff") < strings.Join(ret[j].labelValues, "\xff")
+	})
+	return ret
+}
+
+func (v *vec) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+func (v *vec) writeSimple(w io.Writer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.header(w)
+	for _, s := range v.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, labelString(v.labels, s.labelValues, "", ""), formatFloat(s.value))
+	}
+}
+
+type CounterVec struct {
+	*vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labels)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// counter 只能增加，v 小于 0 时忽略
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.lock.Lock()
+	c.get(labelValues).value += v
+	c.lock.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeSimple(w)
+}
+
+type GaugeVec struct {
+	*vec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labels)}
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.lock.Lock()
+	g.get(labelValues).value = v
+	g.lock.Unlock()
+}
+
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	g.lock.Lock()
+	g.get(labelValues).value += v
+	g.lock.Unlock()
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeSimple(w)
+}
+
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// buckets 为 nil 时使用 DefBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{
+		vec:     newVec(name, help, "histogram", labels),
+		buckets: b,
+	}
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := h.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.header(w)
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, s.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// extraName 不为空时追加一个标签，用于 histogram 的 le
+func labelString(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounterVec("test_total", "Test counter.", "code")
+	h := NewHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1})
+	r.MustRegister(c, h)
+
+	c.Inc("a\"b")
+	c.Add(2, "ok")
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	var buf bytes.Buffer
+	_, _ = r.WriteTo(&buf)
+	out := buf.String()
+	expects := []string{
+		"# TYPE test_total counter",
+		`test_total{code="a\"b"} 1`,
+		`test_total{code="ok"} 2`,
+		`test_seconds_bucket{le="0.1"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		"test_seconds_sum 5.55",
+		"test_seconds_count 3",
+	}
+	for _, e := range expects {
+		if !strings.Contains(out, e) {
+			t.Errorf("missing %s in\n%s", e, out)
+		}
+	}
+	if strings.Index(out, "test_seconds") > strings.Index(out, "test_total") {
+		t.Error("metrics should be sorted by name")
+	}
+	if err := r.Register(c); err == nil {
+		t.Error("duplicated register should fail")
+	}
+}
+
+func TestGinRouteLabel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(GinMiddleware(e))
+	user := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	e.GET("/user/:id", user)
+	e.GET("/group/:gid/user/:id", user)
+	MetricsRouter(e.Group(""))
+
+	for _, path := range []string{"/user/1", "/user/2", "/group/1/user/3", "/nothing/here"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	out := w.Body.String()
+	expects := []string{
+		`ginbase_http_requests_total{method="GET",route="/user/:id",status="200"} 2`,
+		`ginbase_http_requests_total{method="GET",route="/group/:gid/user/:id",status="200"} 1`,
+		`ginbase_http_requests_total{method="GET",route="NOT_FOUND",status="404"} 1`,
+		`ginbase_http_requests_in_flight 1`,
+	}
+	for _, e := range expects {
+		if !strings.Contains(out, e) {
+			t.Errorf("missing %s in\n%s", e, out)
+		}
+	}
+	if strings.Contains(out, `route="/user/1"`) {
+		t.Error("raw path should not be used as label")
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+type Registry struct {
+	lock       sync.RWMutex
+	collectors map[string]Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// /metrics 输出的 registry，包含 ginbase 内置的指标
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) Register(c Collector) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.collectors[c.Name()]; ok {
+		return fmt.Errorf("metric %s already registered", c.Name())
+	}
+	r.collectors[c.Name()] = c
+	return nil
+}
+
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// 按指标名排序输出
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.lock.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cs := make([]Collector, 0, len(names))
+	for _, name := range names {
+		cs = append(cs, r.collectors[name])
+	}
+	r.lock.RUnlock()
+
+	var buf bytes.Buffer
+	for _, c := range cs {
+		c.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// 注册到 DefaultRegistry
+func Register(c Collector) error {
+	return DefaultRegistry.Register(c)
+}
+
+func MustRegister(cs ...Collector) {
+	DefaultRegistry.MustRegister(cs...)
+}
@@ -0,0 +1,11 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// 指标接口，比如 MetricsRouter(e.Group(""))
+// 一般只在内网暴露，需要鉴权时挂到配置了用户验证的 group 上
+func MetricsRouter(g *gin.RouterGroup) {
+	g.GET("/metrics", Handler())
+}
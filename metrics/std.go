@@ -0,0 +1,49 @@
+package metrics
+
+// ginbase 内置的指标，由各模块在对应的位置记录
+var (
+	HttpRequests = NewCounterVec("ginbase_http_requests_total",
+		"HTTP requests by method, route template and status.", "method", "route", "status")
+	HttpLatency = NewHistogramVec("ginbase_http_request_duration_seconds",
+		"HTTP request latency by method, route template and status.", nil, "method", "route", "status")
+	HttpInFlight = NewGaugeVec("ginbase_http_requests_in_flight",
+		"HTTP requests currently being served.")
+
+	Panics = NewCounterVec("ginbase_panics_total",
+		"Panics recovered by RecoveryMiddleware, kind is runtime, error or other.", "kind")
+
+	AuthDecisions = NewCounterVec("ginbase_auth_decisions_total",
+		"roleapp.AuthUser decisions by result.", "result")
+
+	MongoLatency = NewHistogramVec("ginbase_mongo_op_duration_seconds",
+		"Mongo operation latency through Ds.TC by collection, operation and result.", nil, "collection", "op", "result")
+
+	LockWait = NewHistogramVec("ginbase_redis_lock_wait_seconds",
+		"Time spent in AcquireLock by result, result is acquired, timeout or error.", nil, "result")
+	LockFailures = NewCounterVec("ginbase_redis_lock_failures_total",
+		"AcquireLock failures by reason, reason is timeout or error.", "reason")
+
+	KafkaProduced = NewCounterVec("ginbase_kafka_produce_total",
+		"Kafka messages produced through SendMsg by topic and result.", "topic", "result")
+	KafkaConsumed = NewCounterVec("ginbase_kafka_consume_total",
+		"Kafka messages consumed through ConsumeMsg by topic.", "topic")
+	KafkaConsumeErrors = NewCounterVec("ginbase_kafka_consume_errors_total",
+		"Kafka consumer errors.")
+)
+
+// 结果标签的取值
+const (
+	ResultOk    = "ok"
+	ResultError = "error"
+)
+
+func init() {
+	DefaultRegistry.MustRegister(
+		HttpRequests, HttpLatency, HttpInFlight,
+		Panics,
+		AuthDecisions,
+		MongoLatency,
+		LockWait, LockFailures,
+		KafkaProduced, KafkaConsumed, KafkaConsumeErrors,
+	)
+}
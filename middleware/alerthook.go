@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/leyle/ginbase/util"
+	"net/http"
+)
+
+// 将 PanicReport 以 json 格式 POST 到指定的 url
+type WebhookAlertHook struct {
+	Url     string
+	Headers map[string]string
+}
+
+func NewWebhookAlertHook(url string, headers map[string]string) *WebhookAlertHook {
+	return &WebhookAlertHook{
+		Url:     url,
+		Headers: headers,
+	}
+}
+
+func (h *WebhookAlertHook) Name() string {
+	return "webhook"
+}
+
+func (h *WebhookAlertHook) Alert(r *PanicReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	for k, v := range h.Headers {
+		headers[k] = v
+	}
+	resp, err := util.HttpPost(h.Url, data, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook 返回 %d", resp.StatusCode)
+	}
+	return nil
+}
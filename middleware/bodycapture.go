@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// 日志中记录的 body 最大字节数，超过的部分截断，0 表示不记录 body
+var MaxLogBodySize = 4096
+
+// 只记录这些文本类型的 body，其余类型只记录长度
+var TextContentTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-www-form-urlencoded",
+	"text/",
+	"+json",
+	"+xml",
+}
+
+func isTextContentType(ctype string) bool {
+	ctype = strings.ToLower(ctype)
+	for _, t := range TextContentTypes {
+		if strings.Contains(ctype, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// 流式响应，不缓存
+func isStreamContentType(ctype string) bool {
+	return strings.HasPrefix(strings.ToLower(ctype), "text/event-stream")
+}
+
+// gin 写法的路由匹配，:name 匹配一段，*name 匹配剩余全部
+// method 为空时匹配所有方法
+type routePattern struct {
+	method string
+	parts  []string
+}
+
+func newRoutePattern(method, pattern string) *routePattern {
+	method = strings.ToUpper(method)
+	if method == "*" {
+		method = ""
+	}
+	return &routePattern{
+		method: method,
+		parts:  strings.Split(strings.Trim(pattern, "/"), "/"),
+	}
+}
+
+func (r *routePattern) match(method, path string) bool {
+	if r.method != "" && r.method != method {
+		return false
+	}
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range r.parts {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			if segs[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segs[i] {
+			return false
+		}
+	}
+	return len(segs) == len(r.parts)
+}
+
+// 不记录 body 的规则，method 为空或者 * 时匹配所有方法
+var ignoreBodyRules []*routePattern
+
+func AddIgnoreBodyRule(method, pattern string) {
+	ignoreBodyRules = append(ignoreBodyRules, newRoutePattern(method, pattern))
+}
+
+func isIgnoreBody(method, path string) bool {
+	for _, r := range ignoreBodyRules {
+		if r.match(method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncatedMarker(total int64) string {
+	if total < 0 {
+		return "...[truncated]"
+	}
+	return fmt.Sprintf("...[truncated, total %d bytes]", total)
+}
+
+// 只读取请求 body 的前 MaxLogBodySize 字节用于日志，剩余部分不读入内存
+// 读取的部分与剩余部分重新拼接为 c.Request.Body，后续 handler 读取不受影响
+func captureReqBody(c *gin.Context) ([]byte, bool, error) {
+	limit := int64(MaxLogBodySize)
+	head, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.Request.Body = &multiReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(head), c.Request.Body),
+		closer: c.Request.Body,
+	}
+
+	if int64(len(head)) > limit {
+		return head[:limit], true, nil
+	}
+	return head, false, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (m *multiReadCloser) Close() error {
+	return m.closer.Close()
+}
+
+// 记录响应 body 的 writer
+// 只缓存文本类型的前 MaxLogBodySize 字节，流式响应（sse 或者调用过 Flush）不缓存
+type respWriter struct {
+	gin.ResponseWriter
+	cache     *bytes.Buffer
+	capture   bool // 是否允许缓存，忽略规则命中时为 false
+	decided   bool // 是否已经根据 content type 做过判断
+	streaming bool
+	truncated bool
+}
+
+func newRespWriter(w gin.ResponseWriter, capture bool) *respWriter {
+	return &respWriter{
+		ResponseWriter: w,
+		cache:          bytes.NewBufferString(""),
+		capture:        capture && MaxLogBodySize > 0,
+	}
+}
+
+func (r *respWriter) decide() {
+	if r.decided {
+		return
+	}
+	r.decided = true
+	ctype := r.Header().Get("Content-Type")
+	if isStreamContentType(ctype) {
+		r.streaming = true
+		r.capture = false
+		return
+	}
+	// 没有设置 content type 时由 net/http 自动识别，无法提前判断，按文本处理
+	if ctype != "" && !isTextContentType(ctype) {
+		r.capture = false
+	}
+}
+
+func (r *respWriter) cacheData(b []byte) {
+	r.decide()
+	if !r.capture || r.truncated {
+		return
+	}
+	left := MaxLogBodySize - r.cache.Len()
+	if len(b) > left {
+		r.cache.Write(b[:left])
+		r.truncated = true
+		return
+	}
+	r.cache.Write(b)
+}
+
+func (r *respWriter) Write(b []byte) (int, error) {
+	r.cacheData(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *respWriter) WriteString(s string) (int, error) {
+	r.cacheData([]byte(s))
+	return r.ResponseWriter.WriteString(s)
+}
+
+// 调用过 Flush 的响应是流式的，不再缓存，已经缓存的也丢弃
+func (r *respWriter) Flush() {
+	r.streaming = true
+	r.capture = false
+	r.cache.Reset()
+	r.ResponseWriter.Flush()
+}
+
+// 响应 body 的日志内容
+func (r *respWriter) logBody() string {
+	r.decide()
+	size := r.Size()
+	if r.streaming {
+		return fmt.Sprintf("[stream body, %d bytes]", size)
+	}
+	if !r.capture {
+		if size > 0 && r.Header().Get("Content-Type") != "" && !isTextContentType(r.Header().Get("Content-Type")) {
+			return fmt.Sprintf("[%s body, %d bytes]", r.Header().Get("Content-Type"), size)
+		}
+		return ""
+	}
+	if r.cache.Len() == 0 {
+		return ""
+	}
+	if r.truncated {
+		return redactTruncatedBody(r.Header().Get("Content-Type"), r.cache.Bytes()) + truncatedMarker(int64(size))
+	}
+	return redactBody(r.Header().Get("Content-Type"), r.cache.Bytes())
+}
@@ -1,8 +1,16 @@
 package middleware
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/constant"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var allowHeaders = []string{
@@ -18,6 +26,7 @@ var allowHeaders = []string{
 	"X-Requested-With",
 }
 
+// 追加到默认的 AllowHeaders 中，对 AllowHeaders 为 nil 的 CORSOption 生效
 func AddAllowHeaders(val string) {
 	allowHeaders = append(allowHeaders, val)
 }
@@ -26,17 +35,252 @@ func getAllowHeaders() string {
 	return strings.Join(allowHeaders, ",")
 }
 
-func CORSMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", getAllowHeaders())
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, HEAD, CONNECT, TRACE, PATCH")
+// 跨域配置
+// 来源支持三种写法：完整的 https://a.com，子域名通配 https://*.a.com（不包含 a.com 本身），以及 AllowOriginRegexps 中的正则
+// 正则总是匹配完整的 Origin，不需要自己加 ^ 与 $
+// 匹配时返回请求的 Origin 并设置 Vary: Origin，AllowAllOrigins 且不允许携带凭证时返回 *
+type CORSOption struct {
+	AllowAllOrigins    bool
+	AllowOrigins       []string
+	AllowOriginRegexps []string
+	AllowMethods       []string      // 为空时使用 DefaultCORSMethods
+	AllowHeaders       []string      // 为 nil 时使用 AddAllowHeaders 维护的默认列表
+	ExposeHeaders      []string      // 前端 js 可以读取的响应 header
+	AllowCredentials   bool          // 允许携带 cookie 等凭证，此时不能返回 *，只能返回匹配的来源
+	MaxAge             time.Duration // 预检请求的缓存时间，0 表示不设置
+}
+
+// 默认允许的方法，不包含 CONNECT 与 TRACE
+var DefaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// 允许所有来源，但是不允许携带凭证
+// 原来的 * 与 Allow-Credentials: true 的组合会被浏览器拒绝，需要凭证时请配置来源列表
+func DefaultCORSOption() *CORSOption {
+	return &CORSOption{
+		AllowAllOrigins: true,
+		ExposeHeaders:   []string{constant.XRequestIdHeaderKey},
+		MaxAge:          10 * time.Minute,
+	}
+}
+
+// 编译后的配置
+type corsPolicy struct {
+	opt       *CORSOption
+	exact     map[string]bool
+	wildcards [][2]string // 通配符前后两部分
+	regexps   []*regexp.Regexp
+	methods   string
+	expose    string
+	maxAge    string
+}
+
+func newCorsPolicy(opt *CORSOption) (*corsPolicy, error) {
+	p := &corsPolicy{
+		opt:   opt,
+		exact: make(map[string]bool),
+	}
+	for _, origin := range opt.AllowOrigins {
+		origin = strings.ToLower(strings.TrimRight(origin, "/"))
+		if origin == "*" {
+			return nil, fmt.Errorf("use AllowAllOrigins instead of *")
+		}
+		if idx := strings.Index(origin, "*"); idx >= 0 {
+			p.wildcards = append(p.wildcards, [2]string{origin[:idx], origin[idx+1:]})
+			continue
+		}
+		p.exact[origin] = true
+	}
+	for _, expr := range opt.AllowOriginRegexps {
+		re, err := regexp.Compile(`^(?:` + expr + `)$`)
+		if err != nil {
+			return nil, err
+		}
+		p.regexps = append(p.regexps, re)
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(200)
+	methods := opt.AllowMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	upper := make([]string, 0, len(methods))
+	for _, m := range methods {
+		upper = append(upper, strings.ToUpper(m))
+	}
+	p.methods = strings.Join(upper, ", ")
+	p.expose = strings.Join(opt.ExposeHeaders, ", ")
+	if opt.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(opt.MaxAge / time.Second))
+	}
+	return p, nil
+}
+
+// 子域名部分只允许域名字符，避免 https://evil.com/.a.com 这类绕过
+func validSubdomain(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if !(ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.opt.AllowAllOrigins {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if p.exact[lower] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) &&
+			validSubdomain(lower[len(w[0]):len(lower)-len(w[1])]) {
+			return true
+		}
+	}
+	for _, re := range p.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowHeaders() string {
+	if p.opt.AllowHeaders == nil {
+		return getAllowHeaders()
+	}
+	return strings.Join(p.opt.AllowHeaders, ",")
+}
+
+func (p *corsPolicy) handle(c *gin.Context) {
+	h := c.Writer.Header()
+	origin := c.GetHeader("Origin")
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+	// 不是跨域请求
+	if origin == "" {
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusOK)
 			return
 		}
 		c.Next()
+		return
 	}
+
+	if !p.opt.AllowAllOrigins || p.opt.AllowCredentials {
+		h.Add("Vary", "Origin")
+	}
+	if !p.allowOrigin(origin) {
+		// 不返回跨域 header，由浏览器拒绝
+		if preflight {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+		return
+	}
+
+	if p.opt.AllowAllOrigins && !p.opt.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.opt.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", p.methods)
+		h.Set("Access-Control-Allow-Headers", p.allowHeaders())
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		c.AbortWithStatus(http.StatusOK)
+		return
+	}
+
+	if p.expose != "" {
+		h.Set("Access-Control-Expose-Headers", p.expose)
+	}
+	if c.Request.Method == http.MethodOptions {
+		c.AbortWithStatus(http.StatusOK)
+		return
+	}
+	c.Next()
+}
+
+// 按路径前缀覆盖的配置，最长前缀优先
+type corsOverride struct {
+	prefix string
+	policy *corsPolicy
+}
+
+var (
+	corsLock      sync.RWMutex
+	corsOverrides []*corsOverride
+)
+
+// 对 pathPrefix 开头的请求使用 opt 代替 CORSMiddleware 的配置，包括预检请求
+// 前缀按路径段匹配，/api 匹配 /api 与 /api/x，不匹配 /apix
+func AddCORSOverride(pathPrefix string, opt *CORSOption) error {
+	p, err := newCorsPolicy(opt)
+	if err != nil {
+		return err
+	}
+	corsLock.Lock()
+	defer corsLock.Unlock()
+	corsOverrides = append(corsOverrides, &corsOverride{
+		prefix: strings.TrimRight(pathPrefix, "/"),
+		policy: p,
+	})
+	sort.SliceStable(corsOverrides, func(i, j int) bool {
+		return len(corsOverrides[i].prefix) > len(corsOverrides[j].prefix)
+	})
+	return nil
+}
+
+// 对 route group 覆盖跨域配置
+func GroupCORS(g *gin.RouterGroup, opt *CORSOption) error {
+	return AddCORSOverride(g.BasePath(), opt)
+}
+
+func matchCORSOverride(path string) *corsPolicy {
+	corsLock.RLock()
+	defer corsLock.RUnlock()
+	for _, o := range corsOverrides {
+		if path == o.prefix || strings.HasPrefix(path, o.prefix+"/") || o.prefix == "" {
+			return o.policy
+		}
+	}
+	return nil
+}
+
+// 使用 opt 的跨域中间件，opt 为 nil 时使用 DefaultCORSOption
+// 配置错误属于程序错误，直接 panic
+func NewCORSMiddleware(opt *CORSOption) gin.HandlerFunc {
+	if opt == nil {
+		opt = DefaultCORSOption()
+	}
+	policy, err := newCorsPolicy(opt)
+	if err != nil {
+		panic("CORS 配置错误, " + err.Error())
+	}
+
+	return func(c *gin.Context) {
+		p := matchCORSOverride(c.Request.URL.Path)
+		if p == nil {
+			p = policy
+		}
+		p.handle(c)
+	}
+}
+
+func CORSMiddleware() gin.HandlerFunc {
+	return NewCORSMiddleware(nil)
 }
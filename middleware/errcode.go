@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/returnfun"
+	"io"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 错误码注册表，用于检查重复的错误码，以及给客户端开发者列出全部错误码
+var (
+	errLock     sync.RWMutex
+	errRegistry = make(map[int]*registeredErr)
+)
+
+type registeredErr struct {
+	err    *CustomErrStruct
+	source string // 注册的位置
+}
+
+// 对外展示的错误码信息
+type ErrCodeInfo struct {
+	Code   int    `json:"code"`
+	Status int    `json:"status"`
+	Msg    string `json:"msg"`
+	MsgKey string `json:"msgKey,omitempty"`
+	Source string `json:"source"`
+}
+
+// 注册错误码，一般在包级变量中使用
+// var ErrXxx = middleware.RegisterErr(&middleware.CustomErrStruct{Code: 30001, Msg: "xxx", Status: 400})
+// 错误码重复属于程序错误，直接 panic，启动时就能发现
+func RegisterErr(e *CustomErrStruct) *CustomErrStruct {
+	source := "unknown"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		source = fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line)
+	}
+
+	errLock.Lock()
+	defer errLock.Unlock()
+	if old, ok := errRegistry[e.Code]; ok {
+		panic(fmt.Sprintf("错误码[%d]重复注册, 已经在[%s]注册, 重复的位置[%s]", e.Code, old.source, source))
+	}
+	errRegistry[e.Code] = &registeredErr{err: e, source: source}
+	return e
+}
+
+// 查找注册的错误，没有时返回 nil
+func LookupErr(code int) *CustomErrStruct {
+	errLock.RLock()
+	defer errLock.RUnlock()
+	if reg, ok := errRegistry[code]; ok {
+		return reg.err
+	}
+	return nil
+}
+
+// 按错误码排序的全部错误
+func ListErrCodes() []*ErrCodeInfo {
+	errLock.RLock()
+	defer errLock.RUnlock()
+	ret := make([]*ErrCodeInfo, 0, len(errRegistry))
+	for _, reg := range errRegistry {
+		status := reg.err.Status
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		ret = append(ret, &ErrCodeInfo{
+			Code:   reg.err.Code,
+			Status: status,
+			Msg:    strings.TrimRight(reg.err.Msg, ": "),
+			MsgKey: reg.err.MsgKey,
+			Source: reg.source,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Code < ret[j].Code
+	})
+	return ret
+}
+
+// 输出 markdown 表格，用于生成客户端文档
+func WriteErrCodeMarkdown(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "| Code | HTTP Status | Message | Message Key | Source |\n| --- | --- | --- | --- | --- |"); err != nil {
+		return err
+	}
+	for _, info := range ListErrCodes() {
+		msg := strings.Replace(info.Msg, "|", `\|`, -1)
+		if _, err := fmt.Fprintf(w, "| %d | %d | %s | %s | %s |\n", info.Code, info.Status, msg, info.MsgKey, info.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 列出全部错误码，format=markdown 时返回 markdown 表格
+func ErrCodeRouter(g *gin.RouterGroup) {
+	g.GET("/errcodes", func(c *gin.Context) {
+		if c.Query("format") == "markdown" {
+			c.Header("Content-Type", "text/markdown; charset=utf-8")
+			c.Status(http.StatusOK)
+			_ = WriteErrCodeMarkdown(c.Writer)
+			return
+		}
+		returnfun.ReturnOKJson(c, ListErrCodes())
+	})
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/constant"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// 字段错误，比如参数校验失败
+type FieldError struct {
+	Field string `json:"field"`           // 字段路径，比如 items[0].name
+	Rule  string `json:"rule"`            // 未通过的规则
+	Param string `json:"param,omitempty"` // 规则的参数
+	Msg   string `json:"msg"`
+}
+
+// 调用栈的最大深度
+const maxStackDepth = 64
+
+// 记录当前的调用栈，skip 为 0 时从调用 callers 的函数开始
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	// 跳过 runtime.Callers 与 callers 本身
+	n := runtime.Callers(skip+2, pcs)
+	return pcs[:n]
+}
+
+// 每行一个函数与位置，返回第一个帧的位置
+// skipRuntime 为 true 时跳过开头 runtime 包中的帧，比如 panic 相关的帧
+func formatStack(pcs []uintptr, skipRuntime bool) (location, stack string) {
+	if len(pcs) == 0 {
+		return "", ""
+	}
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if skipRuntime && location == "" && strings.HasPrefix(f.Function, "runtime.") {
+			if !more {
+				break
+			}
+			continue
+		}
+		if location == "" {
+			location = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return location, sb.String()
+}
+
+// 复制一份，记录调用栈，注册的错误作为哨兵不会被修改
+func (c *CustomErrStruct) derive() *CustomErrStruct {
+	t := &CustomErrStruct{
+		Code:    c.Code,
+		Msg:     c.Msg,
+		Status:  c.Status,
+		MsgKey:  c.MsgKey,
+		Cause:   c.Cause,
+		Details: c.Details,
+		Fields:  c.Fields,
+		stack:   c.stack,
+	}
+	if t.stack == nil {
+		// 跳过 derive 以及调用 derive 的方法
+		t.stack = callers(2)
+	}
+	return t
+}
+
+// 包装底层错误，msg 保持不变，底层错误只出现在日志中
+// errors.Is(err, ErrDbExec) 与 errors.Is(err, cause) 都成立
+func (c *CustomErrStruct) Wrap(cause error) *CustomErrStruct {
+	t := c.derive()
+	t.Cause = cause
+	return t
+}
+
+// 替换 msg
+func (c *CustomErrStruct) WithMsg(msg string) *CustomErrStruct {
+	t := c.derive()
+	t.Msg = msg
+	return t
+}
+
+// 追加附加信息，返回给客户端的 data.details
+func (c *CustomErrStruct) WithDetail(key string, val interface{}) *CustomErrStruct {
+	t := c.derive()
+	t.Details = make(map[string]interface{}, len(c.Details)+1)
+	for k, v := range c.Details {
+		t.Details[k] = v
+	}
+	t.Details[key] = val
+	return t
+}
+
+// 追加字段错误，返回给客户端的 data.fields
+func (c *CustomErrStruct) WithFields(fields ...*FieldError) *CustomErrStruct {
+	t := c.derive()
+	t.Fields = append(c.Fields[:len(c.Fields):len(c.Fields)], fields...)
+	return t
+}
+
+func (c *CustomErrStruct) Unwrap() error {
+	return c.Cause
+}
+
+// code 相同即认为是同一个错误，派生出来的错误可以与注册的错误比较
+func (c *CustomErrStruct) Is(target error) bool {
+	t, ok := target.(*CustomErrStruct)
+	return ok && t != nil && t.Code == c.Code
+}
+
+// 派生时的调用栈，每行一个函数与位置
+func (c *CustomErrStruct) Stack() string {
+	_, stack := formatStack(c.stack, false)
+	return stack
+}
+
+// 错误链中第一个带有调用栈的 CustomErrStruct 的调用栈
+func ErrStack(err error) string {
+	for err != nil {
+		if c, ok := err.(*CustomErrStruct); ok && len(c.stack) > 0 {
+			return c.Stack()
+		}
+		err = errors.Unwrap(err)
+	}
+	return ""
+}
+
+// 完整的错误链，每一层的错误以 -> 连接
+// CustomErrStruct 只取自身的 code 与 msg，其余错误的 Error() 已经包含了底层错误，不再展开
+func ErrChain(err error) string {
+	var parts []string
+	for err != nil {
+		c, ok := err.(*CustomErrStruct)
+		if !ok {
+			parts = append(parts, fmt.Sprintf("%s(%T)", err.Error(), err))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%d|%s", c.Code, c.Msg))
+		err = c.Cause
+	}
+	return strings.Join(parts, " -> ")
+}
+
+type errRespData struct {
+	Details map[string]interface{} `json:"details,omitempty"`
+	Fields  []*FieldError          `json:"fields,omitempty"`
+}
+
+// 返回给客户端的 data，没有附加信息时保持原来的空字符串
+func (c *CustomErrStruct) respData() interface{} {
+	if len(c.Details) == 0 && len(c.Fields) == 0 {
+		return ""
+	}
+	return &errRespData{
+		Details: c.Details,
+		Fields:  c.Fields,
+	}
+}
+
+// 记录中止请求的错误链，服务端错误同时记录调用栈
+func logStopErr(c *gin.Context, err error) {
+	reqId := c.GetString(constant.ReqIdKey)
+	if reqId == "" {
+		reqId = DefaultReqId
+	}
+	var cerr *CustomErrStruct
+	if !errors.As(err, &cerr) || cerr.HttpStatus() < http.StatusInternalServerError {
+		consolelog.Logger.Warnf(reqId, "请求中止, %s", ErrChain(err))
+		return
+	}
+	consolelog.Logger.Errorf(reqId, "请求失败, %s\n%s", ErrChain(err), ErrStack(err))
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/i18n"
+	"strings"
+)
+
+// 内置错误码的信息
+func init() {
+	i18n.Register(i18n.LangZh, map[string]string{
+		i18n.CodeKey(ErrDefault.Code):    "请求失败",
+		i18n.CodeKey(ErrValidation.Code): "参数校验失败",
+		i18n.CodeKey(ErrDbExec.Code):     "数据库执行失败: ",
+		i18n.CodeKey(ErrInternal.Code):   "服务器内部错误",
+		i18n.CodeKey(ErrNoIdData.Code):   "无指定id的数据: ",
+	})
+	i18n.Register(i18n.LangEn, map[string]string{
+		i18n.CodeKey(ErrDefault.Code):    ErrDefault.Msg,
+		i18n.CodeKey(ErrValidation.Code): ErrValidation.Msg,
+		i18n.CodeKey(ErrDbExec.Code):     ErrDbExec.Msg,
+		i18n.CodeKey(ErrInternal.Code):   ErrInternal.Msg,
+		i18n.CodeKey(ErrNoIdData.Code):   ErrNoIdData.Msg,
+	})
+}
+
+// 按请求的语言翻译返回给客户端的错误信息
+// 注册的错误按 MsgKey 翻译，没有 MsgKey 时使用错误码对应的 key，Append 追加的内容原样保留
+// 客户端没有指定语言、WithMsg 替换过 msg 或者没有翻译时使用原来的 msg
+// 没有注册的错误，错误链中有 i18n.Message 时按其翻译
+func localizeErr(c *gin.Context, err error, cerr *CustomErrStruct) string {
+	lang := i18n.Lang(c)
+	if reg := LookupErr(cerr.Code); reg != nil && strings.HasPrefix(cerr.Msg, reg.Msg) {
+		if !i18n.Requested(c) {
+			return cerr.Msg
+		}
+		key := cerr.MsgKey
+		if key == "" {
+			key = i18n.CodeKey(cerr.Code)
+		}
+		if tmpl, ok := i18n.Lookup(lang, key); ok {
+			return tmpl + cerr.Msg[len(reg.Msg):]
+		}
+		return cerr.Msg
+	}
+
+	var m *i18n.Message
+	var typed *CustomErrStruct
+	if !errors.As(err, &typed) && errors.As(err, &m) {
+		return m.In(lang)
+	}
+	return cerr.Msg
+}
@@ -1,11 +1,9 @@
 package middleware
 
 import (
-	"bytes"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	. "github.com/leyle/ginbase/consolelog"
-	"io/ioutil"
 	"strings"
 	"time"
 )
@@ -13,20 +11,12 @@ import (
 // 是否打印请求头
 var PrintHeader = false
 
-// 不支持通配符，string equals 匹配模式
-var ignoreReadReqBodyPath = []string{}
-
+// 不记录 body 的 path，支持 gin 的 :name 与 *name 写法，匹配所有方法
+// 需要按方法区分时使用 AddIgnoreBodyRule
 func AddIgnoreReadReqBodyPath(paths ...string) {
-	ignoreReadReqBodyPath = append(ignoreReadReqBodyPath, paths ...)
-}
-
-func isIgnoreReadBodyPath(reqPath string) bool {
-	for _, path := range ignoreReadReqBodyPath {
-		if reqPath == path {
-			return true
-		}
+	for _, path := range paths {
+		AddIgnoreBodyRule("", path)
 	}
-	return false
 }
 
 func GinLogMiddleware() gin.HandlerFunc {
@@ -40,13 +30,13 @@ func GinLogMiddleware() gin.HandlerFunc {
 		method := c.Request.Method
 		ctype := strings.ToLower(c.Request.Header.Get("Content-Type"))
 		clientIp := c.ClientIP()
-		reqMsg := fmt.Sprintf("[Req][%s][%s][%s][%s]", method, path, clientIp, ctype)
+		reqMsg := fmt.Sprintf("[Req][%s][%s][%s][%s]", method, redactURI(path), clientIp, ctype)
 
 		// 判断是否打印 header
 		if PrintHeader {
 			hmsg := ""
 			for k, v := range c.Request.Header {
-				val := strings.Join(v, " ")
+				val := redactHeader(k, strings.Join(v, " "))
 				hmsg += fmt.Sprintf("%s:%s\n", k, val)
 			}
 			if hmsg != "" {
@@ -54,64 +44,105 @@ func GinLogMiddleware() gin.HandlerFunc {
 			}
 		}
 
+		// 先确定策略，有策略时 body 的脱敏推迟到请求结束后确定要记录时
+		// 非 2xx 与慢请求需要记录 body，只能在请求结束后判断，所以原始内容仍然需要先保存
+		policy := matchLogPolicy(method, c.Request.URL.Path)
+		sampled := policy == nil || policy.sample()
+
 		// 判断是否有 request body，如果有，就转存读取
-		if c.Request.ContentLength > 0 && !isIgnoreReadBodyPath(c.Request.URL.Path) {
-			body, err := ioutil.ReadAll(c.Request.Body)
-			if err != nil {
-				// 忽略掉错误，不继续处理
-				Logger.Errorf(GetReqId(c), "读取请求body失败, %s", err.Error())
-			} else {
-				// 还原回去
-				c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-				if len(body) > 0 {
-					reqMsg += "\n" + string(body)
+		// 只读取文本类型的前 MaxLogBodySize 字节，其余类型只记录长度
+		var (
+			reqRaw       []byte
+			reqTruncated bool
+			reqNote      string
+		)
+		ignoreBody := isIgnoreBody(method, c.Request.URL.Path)
+		if c.Request.ContentLength != 0 && !ignoreBody && MaxLogBodySize > 0 {
+			if isTextContentType(ctype) {
+				body, truncated, err := captureReqBody(c)
+				if err != nil {
+					// 忽略掉错误，不继续处理
+					Logger.Errorf(GetReqId(c), "读取请求body失败, %s", err.Error())
+				} else {
+					reqRaw, reqTruncated = body, truncated
 				}
+			} else if c.Request.ContentLength > 0 {
+				reqNote = fmt.Sprintf("[%s body, %d bytes]", ctype, c.Request.ContentLength)
+			}
+		}
+		reqBody := func() string {
+			if len(reqRaw) == 0 {
+				return reqNote
+			}
+			if reqTruncated {
+				return redactTruncatedBody(ctype, reqRaw) + truncatedMarker(c.Request.ContentLength)
+			}
+			return redactBody(ctype, reqRaw)
+		}
+
+		// 没有策略时请求 body 直接跟在请求日志后面
+		// 有策略时先只记录摘要，请求结束后根据结果决定是否记录 body
+		if policy == nil {
+			if body := reqBody(); body != "" {
+				reqMsg += "\n" + body
 			}
 		}
 
 		Logger.Info(GetReqId(c), reqMsg)
 
 		// rewrite writer，方便后续转存数据
-		c.Writer = &respWriter{
-			ResponseWriter: c.Writer,
-			cache:          bytes.NewBufferString(""),
-		}
+		c.Writer = newRespWriter(c.Writer, !ignoreBody)
 
 		c.Next()
 
 		// 下面的内容会在请求结束后执行
 		statusCode := c.Writer.Status()
-		respBody := ""
-
-		respMsg := fmt.Sprintf("[Resp][%s][%s][%d]", method, path, statusCode)
+		latency := time.Now().Sub(startT)
+		respMsg := fmt.Sprintf("[Resp][%s][%s][%d][%v]", method, redactURI(path), statusCode, latency)
 
-		rw, ok := c.Writer.(*respWriter)
-		if !ok {
-			Logger.Warnf(GetReqId(c), "处理response数据，转回respwriter失败")
-		} else {
-			if rw.cache.Len() > 0 && !isIgnoreReadBodyPath(c.Request.URL.Path) {
-				respBody = "\n" + rw.cache.String()
+		if sampled || IsForceLog(c) || policy.logBody(statusCode, latency) {
+			if policy != nil {
+				if body := reqBody(); body != "" {
+					respMsg += "\n[ReqBody]" + body
+				}
 			}
-		}
 
-		latency := time.Now().Sub(startT)
-		respMsg += fmt.Sprintf("[%v]", latency)
-		if respBody != "" {
-			respMsg += respBody
+			rw, ok := c.Writer.(*respWriter)
+			if !ok {
+				Logger.Warnf(GetReqId(c), "处理response数据，转回respwriter失败")
+			} else if body := rw.logBody(); body != "" {
+				respMsg += "\n" + body
+			}
 		}
 
 		Logger.Info(GetReqId(c), respMsg)
 	}
 }
 
-// rewrite Write()
-type respWriter struct {
-	gin.ResponseWriter
-	cache *bytes.Buffer
+func redactURI(uri string) string {
+	if LogRedactor == nil {
+		return uri
+	}
+	return LogRedactor.URI(uri)
 }
 
-// 会导致内存增加，性能稍微降低，但是我觉得值得
-func (r *respWriter) Write(b []byte) (int, error) {
-	r.cache.Write(b)
-	return r.ResponseWriter.Write(b)
-}
\ No newline at end of file
+func redactHeader(name, val string) string {
+	if LogRedactor == nil {
+		return val
+	}
+	return LogRedactor.Header(name, val)
+}
+
+func redactBody(ctype string, body []byte) string {
+	if LogRedactor == nil {
+		return string(body)
+	}
+	return LogRedactor.Body(ctype, body)
+}
+
+func redactTruncatedBody(ctype string, body []byte) string {
+	if LogRedactor == nil {
+		return string(body)
+	}
+	return LogRedactor.TruncatedBody(ctype, body)
+}
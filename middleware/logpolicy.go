@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 访问日志的记录策略
+// 配置了策略的请求总是记录一行摘要，body 只在以下情况记录：
+// 响应不是 2xx、耗时超过 SlowThreshold、命中采样、或者请求被标记为强制记录
+type LogPolicy struct {
+	SlowThreshold time.Duration // 0 表示不按耗时判断
+	SampleRate    float64       // 正常请求记录 body 的百分比，0-100
+}
+
+// 没有命中路由策略时使用的策略，为 nil 时保持原来的行为，每个请求都记录 body
+var DefaultLogPolicy *LogPolicy
+
+type routeLogPolicy struct {
+	route  *routePattern
+	policy *LogPolicy
+}
+
+var (
+	policyLock    sync.RWMutex
+	routePolicies []*routeLogPolicy
+)
+
+// 按路由配置策略，pattern 支持 gin 的 :name 与 *name 写法，先添加的优先
+func AddRouteLogPolicy(method, pattern string, p *LogPolicy) {
+	policyLock.Lock()
+	routePolicies = append(routePolicies, &routeLogPolicy{
+		route:  newRoutePattern(method, pattern),
+		policy: p,
+	})
+	policyLock.Unlock()
+}
+
+func matchLogPolicy(method, path string) *LogPolicy {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	for _, rp := range routePolicies {
+		if rp.route.match(method, path) {
+			return rp.policy
+		}
+	}
+	return DefaultLogPolicy
+}
+
+// 是否命中采样，在请求开始时判断
+func (p *LogPolicy) sample() bool {
+	return p.SampleRate > 0 && rand.Float64()*100 < p.SampleRate
+}
+
+// 没有命中采样时，根据请求结果判断是否记录 body
+func (p *LogPolicy) logBody(status int, latency time.Duration) bool {
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return true
+	}
+	return p.SlowThreshold > 0 && latency >= p.SlowThreshold
+}
+
+const ctxForceLogKey = "FORCELOGBODY"
+
+// 强制记录本次请求的 body，不受策略影响
+// 比如 loglevel.DebugMiddleware 验证调试签名通过后调用
+func ForceLog(c *gin.Context) {
+	c.Set(ctxForceLogKey, true)
+}
+
+func IsForceLog(c *gin.Context) bool {
+	return c.GetBool(ctxForceLogKey)
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/i18n"
+	"github.com/leyle/ginbase/metrics"
 	"github.com/leyle/ginbase/returnfun"
-	"runtime/debug"
+	"net/http"
+	"runtime"
 	"strconv"
 	"strings"
 )
@@ -14,62 +16,101 @@ import (
 const DefaultCustomErrCode = 4000 // 默认的错误码，通用的错误码
 const DefaultSep = "|"
 
+// 业务错误，通过 RegisterErr 注册后由 DefaultStopExecHandler 按 Status 返回
 type CustomErrStruct struct {
 	Code int
-	Msg string
+	Msg string // 默认的错误信息
+	Status int // http 状态码，0 表示 400
+	MsgKey string // 错误信息的翻译 key，可选
+
+	Cause   error                  // 底层错误，只记录日志，不返回给客户端
+	Details map[string]interface{} // 附加信息，返回给客户端
+	Fields  []*FieldError          // 字段错误，返回给客户端
+	stack   []uintptr              // 派生时的调用栈，注册的错误没有
 }
 
+// 带有 Cause 时追加底层错误，方便日志排查
 func (c *CustomErrStruct) Error() string {
+	if c.Cause != nil {
+		return fmt.Sprintf("%d|%s: %s", c.Code, c.Msg, c.Cause.Error())
+	}
 	return fmt.Sprintf("%d|%s", c.Code, c.Msg)
 }
 
 func (c *CustomErrStruct) Append(msg string) *CustomErrStruct {
-	t := &CustomErrStruct{
-		Code: c.Code,
-		Msg:  c.Msg + msg,
-	}
+	t := c.derive()
+	t.Msg = c.Msg + msg
 	return t
 }
 
-var ErrDbExec = &CustomErrStruct{
-	Code: 5000,
-	Msg:  "Database execute failed: ",
+// http 状态码，未设置时查找注册的错误
+func (c *CustomErrStruct) HttpStatus() int {
+	if c.Status != 0 {
+		return c.Status
+	}
+	if reg := LookupErr(c.Code); reg != nil && reg.Status != 0 {
+		return reg.Status
+	}
+	return http.StatusBadRequest
 }
 
-var ErrNoIdData = &CustomErrStruct{
-	Code: 40000,
-	Msg:  "No data for this id: ",
-}
+var ErrDefault = RegisterErr(&CustomErrStruct{
+	Code:   DefaultCustomErrCode,
+	Msg:    "Request failed",
+	Status: http.StatusBadRequest,
+})
 
-// 反向解析出来 code 和 msg
+var ErrDbExec = RegisterErr(&CustomErrStruct{
+	Code:   5000,
+	Msg:    "Database execute failed: ",
+	Status: http.StatusInternalServerError,
+})
+
+// runtime panic 不把原始信息返回给客户端
+var ErrInternal = RegisterErr(&CustomErrStruct{
+	Code:   5001,
+	Msg:    "Internal server error",
+	Status: http.StatusInternalServerError,
+})
+
+var ErrNoIdData = RegisterErr(&CustomErrStruct{
+	Code:   40000,
+	Msg:    "No data for this id: ",
+	Status: http.StatusBadRequest,
+})
+
+// 取出错误链中的 CustomErrStruct
+// 没有时兼容旧的 "code|msg" 字符串，| 前面不是数字时整体作为 msg，使用默认 code
 func ParseCustomErr(err error) *CustomErrStruct {
-	msg := err.Error()
-	if !strings.Contains(msg, DefaultSep)  {
-		return &CustomErrStruct{
-			Code: DefaultCustomErrCode,
-			Msg:  msg,
-		}
+	var cerr *CustomErrStruct
+	if errors.As(err, &cerr) {
+		return cerr
 	}
 
+	msg := err.Error()
 	ret := strings.SplitN(msg, DefaultSep, 2)
-	scode := ret[0]
-	emsg := ret[1]
+	if len(ret) == 2 {
+		if code, ok := parseStrCode(ret[0]); ok {
+			return &CustomErrStruct{
+				Code:  code,
+				Msg:  strings.TrimSpace(ret[1]),
+			}
+		}
+	}
 
 	return &CustomErrStruct{
-		Code: parseStrCode(scode),
-		Msg:  strings.TrimSpace(emsg),
+		Code: DefaultCustomErrCode,
+		Msg:  msg,
 	}
 }
 
-// 解析字符串格式的 code， 如果解析失败，就返回默认 code
-func parseStrCode(code string) int {
-	code = strings.TrimSpace(code)
-	c, err := strconv.ParseInt(code, 10, 64)
+// 解析字符串格式的 code
+func parseStrCode(code string) (int, bool) {
+	c, err := strconv.Atoi(strings.TrimSpace(code))
 	if err != nil {
-		consolelog.Logger.Errorf("", "parse err code failed, %s", err.Error())
-		return DefaultCustomErrCode
+		return 0, false
 	}
-	return int(c)
+	return c, true
 }
 
 // panic 后可以给客户端返回一个期望的数据格式
@@ -79,42 +120,63 @@ func StopExec(err error) {
 	if err == nil {
 		return
 	}
-	panic(err)
+	panic(&stopExecPanic{err: err})
 }
 
 // 恢复回来
+// StopExec 抛出的错误按业务错误记录日志，其余的 panic 属于程序错误，记录调用栈并发送告警
 func RecoveryMiddleware(f func(*gin.Context, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
-			if rval := recover(); rval != nil {
-				// runtime error, such as nil pointer dereference, should print stack
-				prval := fmt.Sprintf("%v", rval)
-				if strings.Contains(prval, "runtime") {
-					consolelog.Logger.Error(GetReqId(c), prval)
-					debug.PrintStack()
-				}
-				err, ok := rval.(error)
-				if ok {
-					f(c, err)
-				} else {
-					err, ok := rval.(string)
-					if ok {
-						f(c, errors.New(err))
-					} else {
-						// 简单处理
-						emsg := fmt.Sprintf("%v", rval)
-						consolelog.Logger.Error(GetReqId(c), emsg)
-						f(c, errors.New(emsg))
-					}
-				}
+			rval := recover()
+			if rval == nil {
+				return
+			}
+			// 业务错误不计入 panic 指标
+			if sp, ok := rval.(*stopExecPanic); ok {
+				logStopErr(c, sp.err)
+				f(c, sp.err)
+				return
+			}
+
+			prval := fmt.Sprintf("%v", rval)
+			metrics.Panics.Inc(panicKind(rval))
+			// 跳过 runtime.Callers、panicStack 与当前函数
+			location, stack := panicStack(1)
+			reportPanic(newPanicReport(c, rval, prval, location, stack))
+
+			err, ok := rval.(error)
+			if !ok {
+				err = errors.New(prval)
 			}
+			f(c, &panicError{err: err})
 		}()
 		c.Next()
 	}
 }
 
+// panic 的类型，用于指标与告警
+func panicKind(rval interface{}) string {
+	switch rval.(type) {
+	case runtime.Error:
+		return "runtime"
+	case error, string:
+		return "error"
+	}
+	return "other"
+}
+
 // 提供一个默认的 recoveryhandler
+// 按注册的 http 状态码返回，不是 StopExec 抛出的 panic 一律返回 ErrInternal，不把 panic 的内容返回给客户端
+// 参数校验错误返回字段错误
+// 错误信息按请求的语言翻译
 func DefaultStopExecHandler(c *gin.Context, err error) {
+	if IsPanicErr(err) {
+		err = ErrInternal
+	}
+	if verr := BindErr(err, i18n.Lang(c)); verr != nil {
+		err = verr
+	}
 	cerr := ParseCustomErr(err)
-	returnfun.ReturnJson(c, 400, cerr.Code, cerr.Msg, "")
+	returnfun.ReturnJson(c, cerr.HttpStatus(), cerr.Code, localizeErr(c, err, cerr), cerr.respData())
 }
\ No newline at end of file
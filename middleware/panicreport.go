@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/constant"
+	"os"
+	"sync"
+	"time"
+)
+
+// StopExec 抛出的 panic，与程序错误导致的 panic 区分开
+// 实现 error 与 Unwrap，外层自行 recover 时也能按 error 处理
+type stopExecPanic struct {
+	err error
+}
+
+func (p *stopExecPanic) Error() string {
+	return p.err.Error()
+}
+
+func (p *stopExecPanic) Unwrap() error {
+	return p.err
+}
+
+// 不是 StopExec 抛出的 panic，传给 RecoveryMiddleware 的处理函数前包装一层
+type panicError struct {
+	err error
+}
+
+func (p *panicError) Error() string {
+	return p.err.Error()
+}
+
+func (p *panicError) Unwrap() error {
+	return p.err
+}
+
+// 错误是否来自程序 panic，而不是 StopExec，自定义的处理函数可以据此区分业务错误
+func IsPanicErr(err error) bool {
+	_, ok := err.(*panicError)
+	return ok
+}
+
+// 当前用户的 id，用于 panic 报告，roleapp 会在 init 中设置
+var CurUserIdFunc func(c *gin.Context) string
+
+// 一次 panic 的信息，记录日志并发送给告警 hook
+type PanicReport struct {
+	ReqId      string    `json:"reqId"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	UserId     string    `json:"userId,omitempty"`
+	Kind       string    `json:"kind"`     // runtime, error, other
+	Value      string    `json:"value"`    // panic 的值
+	Location   string    `json:"location"` // 触发 panic 的位置，用于告警去重
+	Stack      string    `json:"stack"`
+	Host       string    `json:"host"`
+	Time       time.Time `json:"time"`
+	Suppressed int       `json:"suppressed"` // 上次告警之后被合并的次数
+}
+
+// 告警去重的 key，同一个位置的同一类 panic 认为是重复的
+func (r *PanicReport) Fingerprint() string {
+	if r.Location == "" {
+		return r.Kind + "|" + r.Value
+	}
+	return r.Kind + "|" + r.Location
+}
+
+var hostname, _ = os.Hostname()
+
+// 在 recover 的 defer 函数中调用，skip 为 0 时从调用 panicStack 的函数开始，跳过 runtime 中 panic 相关的帧
+// 返回第一个非 runtime 的帧作为 panic 的位置
+func panicStack(skip int) (location, stack string) {
+	return formatStack(callers(skip+1), true)
+}
+
+func newPanicReport(c *gin.Context, rval interface{}, prval, location, stack string) *PanicReport {
+	r := &PanicReport{
+		ReqId:    c.GetString(constant.ReqIdKey),
+		Method:   c.Request.Method,
+		Path:     c.Request.URL.Path,
+		Kind:     panicKind(rval),
+		Value:    prval,
+		Location: location,
+		Stack:    stack,
+		Host:     hostname,
+		Time:     time.Now(),
+	}
+	if r.ReqId == "" {
+		r.ReqId = DefaultReqId
+	}
+	if CurUserIdFunc != nil {
+		r.UserId = CurUserIdFunc(c)
+	}
+	return r
+}
+
+// 记录日志并发送告警
+func reportPanic(r *PanicReport) {
+	consolelog.Logger.With(
+		"method", r.Method,
+		"path", r.Path,
+		"userId", r.UserId,
+		"panicKind", r.Kind,
+		"location", r.Location,
+		"stack", r.Stack,
+	).Errorf(r.ReqId, "请求 panic, %s", r.Value)
+
+	fireAlert(r)
+}
+
+// 告警 hook，比如 webhook 与 kafka
+// Alert 在单独的 goroutine 中调用，不阻塞请求
+type AlertHook interface {
+	Name() string
+	Alert(r *PanicReport) error
+}
+
+// 相同 Fingerprint 的告警的最小间隔，间隔内的重复 panic 只记录日志，计入下一次告警的 Suppressed
+var AlertInterval = time.Minute
+
+var (
+	alertLock  sync.RWMutex
+	alertHooks []AlertHook
+)
+
+func AddAlertHook(hook AlertHook) {
+	alertLock.Lock()
+	alertHooks = append(alertHooks, hook)
+	alertLock.Unlock()
+}
+
+func getAlertHooks() []AlertHook {
+	alertLock.RLock()
+	defer alertLock.RUnlock()
+	return alertHooks
+}
+
+type alertState struct {
+	last       time.Time
+	suppressed int
+}
+
+// 告警去重
+type alertLimiter struct {
+	lock   sync.Mutex
+	states map[string]*alertState
+}
+
+var alertLimit = &alertLimiter{states: make(map[string]*alertState)}
+
+// 最多保留的去重记录，超过时清理已经过期的
+const maxAlertStates = 1024
+
+// 是否发送告警，发送时返回之前被合并的次数
+func (l *alertLimiter) allow(key string, now time.Time) (bool, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	st, ok := l.states[key]
+	if ok && now.Sub(st.last) < AlertInterval {
+		st.suppressed++
+		return false, 0
+	}
+
+	if !ok {
+		if len(l.states) >= maxAlertStates {
+			for k, s := range l.states {
+				if now.Sub(s.last) >= AlertInterval {
+					delete(l.states, k)
+				}
+			}
+		}
+		st = &alertState{}
+		l.states[key] = st
+	}
+	suppressed := st.suppressed
+	st.last = now
+	st.suppressed = 0
+	return true, suppressed
+}
+
+func fireAlert(r *PanicReport) {
+	hooks := getAlertHooks()
+	if len(hooks) == 0 {
+		return
+	}
+	ok, suppressed := alertLimit.allow(r.Fingerprint(), r.Time)
+	if !ok {
+		return
+	}
+	r.Suppressed = suppressed
+
+	for _, hook := range hooks {
+		go func(hook AlertHook) {
+			defer func() {
+				if rval := recover(); rval != nil {
+					consolelog.Logger.Errorf(r.ReqId, "告警[%s] panic, %v", hook.Name(), rval)
+				}
+			}()
+			if err := hook.Alert(r); err != nil {
+				consolelog.Logger.Errorf(r.ReqId, "告警[%s]发送失败, %s", hook.Name(), err.Error())
+			}
+		}(hook)
+	}
+}
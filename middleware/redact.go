@@ -0,0 +1,418 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 日志中敏感数据的脱敏
+// header 按名字整体替换，json 与 form 按字段替换，其余文本按正则替换
+type Redactor struct {
+	Mask string
+
+	lock     sync.RWMutex
+	headers  map[string]bool // 小写
+	fields   [][]string      // 字段路径，按 . 切分，小写
+	patterns []*RedactPattern
+}
+
+type RedactPattern struct {
+	Name  string
+	Re    *regexp.Regexp
+	Check func(s string) bool // 可选，正则匹配后再次确认，返回 false 时不脱敏
+}
+
+// 默认脱敏的 header
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"TOKEN",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Debug-Log",
+}
+
+// 默认脱敏的字段
+// 单个名字匹配任意层级的同名字段，带 . 的路径从根开始匹配，* 匹配任意字段名或数组下标
+var DefaultRedactFields = []string{
+	"passwd",
+	"password",
+	"oldPasswd",
+	"newPasswd",
+	"secret",
+	"clientSecret",
+	"token",
+	"accessToken",
+	"refreshToken",
+	"id_token",
+	"idCard",
+	"idNo",
+	"cardNo",
+	"data.key", // apikey 创建与轮换时返回的明文 key
+}
+
+// 默认的正则，按顺序执行，身份证号需要在银行卡号之前
+// 银行卡号通过 Luhn 校验后才脱敏，避免误伤时间戳与数字 id
+var DefaultRedactPatterns = []*RedactPattern{
+	{Name: "phone", Re: regexp.MustCompile(`\b1[3-9]\d{9}\b`)},
+	{Name: "idcard", Re: regexp.MustCompile(`\b\d{17}[\dXx]\b`)},
+	{Name: "card", Re: regexp.MustCompile(`\b\d{16,19}\b`), Check: LuhnValid},
+	{Name: "apikey", Re: regexp.MustCompile(`\bgbk_[0-9a-f]{12}_[A-Za-z0-9_-]+`)},
+	{Name: "jwt", Re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+}
+
+// Luhn 校验，银行卡号的最后一位是校验位
+func LuhnValid(s string) bool {
+	if s == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		d := int(s[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{
+		Mask:    "***",
+		headers: make(map[string]bool),
+	}
+}
+
+// 带默认规则的 Redactor
+func NewDefaultRedactor() *Redactor {
+	r := NewRedactor()
+	r.AddHeaders(DefaultRedactHeaders...)
+	r.AddFields(DefaultRedactFields...)
+	r.AddPatterns(DefaultRedactPatterns...)
+	return r
+}
+
+// GinLogMiddleware 使用的 Redactor，设置为 nil 时不脱敏
+var LogRedactor = NewDefaultRedactor()
+
+func (r *Redactor) AddHeaders(names ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, name := range names {
+		r.headers[strings.ToLower(name)] = true
+	}
+}
+
+func (r *Redactor) AddFields(paths ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, path := range paths {
+		r.fields = append(r.fields, strings.Split(strings.ToLower(path), "."))
+	}
+}
+
+func (r *Redactor) AddPattern(name, expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	r.AddPatterns(&RedactPattern{Name: name, Re: re})
+	return nil
+}
+
+// 按顺序追加，在已有的规则之后执行
+func (r *Redactor) AddPatterns(patterns ...*RedactPattern) {
+	r.lock.Lock()
+	r.patterns = append(r.patterns, patterns...)
+	r.lock.Unlock()
+}
+
+func (r *Redactor) Header(name, val string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.headers[strings.ToLower(name)] {
+		return r.Mask
+	}
+	return r.text(val)
+}
+
+// 按正则替换文本中的敏感数据，保留前 3 位与后 4 位方便排查
+func (r *Redactor) Text(s string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.text(s)
+}
+
+func (r *Redactor) text(s string) string {
+	for _, p := range r.patterns {
+		check := p.Check
+		s = p.Re.ReplaceAllStringFunc(s, func(m string) string {
+			if check != nil && !check(m) {
+				return m
+			}
+			return r.maskMiddle(m)
+		})
+	}
+	return s
+}
+
+func (r *Redactor) maskMiddle(s string) string {
+	if len(s) <= 8 {
+		return r.Mask
+	}
+	return s[:3] + r.Mask + s[len(s)-4:]
+}
+
+// 字段是否需要脱敏，path 为从根开始的字段路径
+func (r *Redactor) matchField(path []string) bool {
+	for _, f := range r.fields {
+		if len(f) == 1 {
+			if strings.ToLower(path[len(path)-1]) == f[0] {
+				return true
+			}
+			continue
+		}
+		if len(f) != len(path) {
+			continue
+		}
+		matched := true
+		for i := range f {
+			if f[i] != "*" && f[i] != strings.ToLower(path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// 按 content type 脱敏 body，json 与 form 按字段处理，解析失败时按文本处理
+func (r *Redactor) Body(ctype string, body []byte) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	ctype = strings.ToLower(ctype)
+	switch {
+	case strings.Contains(ctype, "json"):
+		if ret, ok := r.jsonBody(body); ok {
+			return r.text(ret)
+		}
+	case strings.Contains(ctype, "application/x-www-form-urlencoded"):
+		if vals, err := url.ParseQuery(string(body)); err == nil {
+			return r.text(r.values(vals).Encode())
+		}
+	}
+	return r.text(string(body))
+}
+
+// 脱敏被截断的 body，json 已经不完整，逐个 token 扫描并按字段脱敏，只输出截断前完整的部分
+func (r *Redactor) TruncatedBody(ctype string, body []byte) string {
+	if !strings.Contains(strings.ToLower(ctype), "json") {
+		return r.Body(ctype, body)
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.text(r.jsonPrefix(body))
+}
+
+// 扫描中的 json 对象或数组
+type jsonFrame struct {
+	object    bool
+	expectKey bool
+	count     int
+}
+
+func (r *Redactor) jsonPrefix(body []byte) string {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+
+	var (
+		buf    bytes.Buffer
+		frames []*jsonFrame
+		path   []string
+	)
+	// 一个值结束，对象中的值结束时去掉路径中的字段名
+	valueDone := func() {
+		if len(frames) == 0 {
+			return
+		}
+		top := frames[len(frames)-1]
+		top.count++
+		if top.object {
+			top.expectKey = true
+			path = path[:len(path)-1]
+		}
+	}
+	// 跳过一个值，值为对象或数组时读到对应的结束符
+	skipValue := func() bool {
+		depth := 0
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return false
+			}
+			if delim, ok := tok.(json.Delim); ok {
+				if delim == '{' || delim == '[' {
+					depth++
+				} else {
+					depth--
+				}
+			}
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+
+		var top *jsonFrame
+		if len(frames) > 0 {
+			top = frames[len(frames)-1]
+		}
+
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			buf.WriteByte(byte(delim))
+			frames = frames[:len(frames)-1]
+			if delim == ']' {
+				path = path[:len(path)-1]
+			}
+			valueDone()
+			continue
+		}
+
+		if top != nil && top.object && top.expectKey {
+			key, _ := tok.(string)
+			if top.count > 0 {
+				buf.WriteByte(',')
+			}
+			writeJsonValue(&buf, key)
+			buf.WriteByte(':')
+			top.expectKey = false
+			path = append(path, key)
+			if r.matchField(path) {
+				writeJsonValue(&buf, r.Mask)
+				if !skipValue() {
+					break
+				}
+				valueDone()
+			}
+			continue
+		}
+
+		if top != nil && !top.object && top.count > 0 {
+			buf.WriteByte(',')
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			buf.WriteByte(byte(delim))
+			frames = append(frames, &jsonFrame{object: delim == '{', expectKey: delim == '{'})
+			if delim == '[' {
+				// 数组下标按 * 匹配
+				path = append(path, "*")
+			}
+			continue
+		}
+		writeJsonValue(&buf, tok)
+		valueDone()
+	}
+	return buf.String()
+}
+
+func writeJsonValue(buf *bytes.Buffer, v interface{}) {
+	if n, ok := v.(json.Number); ok {
+		buf.WriteString(n.String())
+		return
+	}
+	e := json.NewEncoder(buf)
+	e.SetEscapeHTML(false)
+	_ = e.Encode(v)
+	buf.Truncate(buf.Len() - 1) // Encode 会追加换行
+}
+
+// 脱敏 uri 中的 query 参数
+func (r *Redactor) URI(uri string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	idx := strings.Index(uri, "?")
+	if idx < 0 {
+		return r.text(uri)
+	}
+	vals, err := url.ParseQuery(uri[idx+1:])
+	if err != nil {
+		return r.text(uri)
+	}
+	return r.text(uri[:idx+1] + r.values(vals).Encode())
+}
+
+func (r *Redactor) values(vals url.Values) url.Values {
+	for k, vs := range vals {
+		if r.matchField([]string{k}) {
+			for i := range vs {
+				vs[i] = r.Mask
+			}
+		}
+	}
+	return vals
+}
+
+func (r *Redactor) jsonBody(body []byte) (string, bool) {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return "", false
+	}
+
+	v = r.walk(v, nil)
+
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return "", false
+	}
+	return strings.TrimRight(buf.String(), "\n"), true
+}
+
+func (r *Redactor) walk(v interface{}, path []string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			p := append(path[:len(path):len(path)], k)
+			if r.matchField(p) {
+				val[k] = r.Mask
+				continue
+			}
+			val[k] = r.walk(item, p)
+		}
+	case []interface{}:
+		for i, item := range val {
+			// 数组下标按 * 匹配
+			val[i] = r.walk(item, append(path[:len(path):len(path)], "*"))
+		}
+	}
+	return v
+}
@@ -1,17 +1,69 @@
 package middleware
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/leyle/ginbase/constant"
+	"github.com/leyle/ginbase/tracing"
 	"github.com/leyle/ginbase/util"
+	"net/http"
 )
 
 const DefaultReqId = "NoReqId"
 
+// 是否沿用上游传入的 X-Request-Id，网关或者上游服务不可信时设置为 false
+var AcceptReqIdHeader = true
+
+// 上游传入的 X-Request-Id 的最大长度，超过时重新生成
+var MaxReqIdLength = 64
+
+// 上游传入的 X-Request-Id 只允许字母、数字与 - _ . :，避免日志注入
+func validReqId(reqId string) bool {
+	if reqId == "" || len(reqId) > MaxReqIdLength {
+		return false
+	}
+	for _, ch := range reqId {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '-', ch == '_', ch == '.', ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// 请求号与 trace context，每个请求记录一个 server span
+// 合法的 X-Request-Id 直接沿用，否则生成新的
+// 合法的 traceparent 沿用上游的 trace id，否则生成新的 trace
 func ReqIdMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		reqId := util.GenerateDataId()
+		reqId := c.GetHeader(constant.XRequestIdHeaderKey)
+		if !AcceptReqIdHeader || !validReqId(reqId) {
+			reqId = util.GenerateDataId()
+		}
+
+		// 不合法时 remote 为 nil，开始新的 trace
+		remote, _ := tracing.Remote(reqId,
+			c.GetHeader(constant.TraceParentHeaderKey),
+			c.GetHeader(constant.TraceStateHeaderKey))
+		path := c.Request.URL.Path
+		span := tracing.StartSpan(remote, reqId, fmt.Sprintf("HTTP %s %s", c.Request.Method, path), tracing.KindServer)
+		span.SetAttr("http.method", c.Request.Method)
+		span.SetAttr("http.path", path)
+		span.SetAttr("http.clientIp", c.ClientIP())
+		defer func() {
+			status := c.Writer.Status()
+			span.SetAttr("http.status", status)
+			if status >= http.StatusInternalServerError {
+				span.SetError(fmt.Errorf("HTTP %d", status))
+			}
+			span.End()
+		}()
+
 		c.Set(constant.ReqIdKey, reqId)
+		c.Set(constant.TraceCtxKey, span)
+		c.Request = c.Request.WithContext(tracing.ContextWithSpan(c.Request.Context(), span))
 		c.Writer.Header().Set(constant.XRequestIdHeaderKey, reqId)
 		c.Next()
 	}
@@ -25,3 +77,8 @@ func GetReqId(c *gin.Context) string {
 	}
 	return reqId.(string)
 }
+
+// 本次请求的 server span，没有配置 ReqIdMiddleware 时返回 nil
+func GetTrace(c *gin.Context) *tracing.Span {
+	return tracing.FromContext(c)
+}
@@ -1,10 +1,15 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/metrics"
+)
 
+// 需要暴露指标时调用 metrics.MetricsRouter 注册 /metrics
 func SetupGin() *gin.Engine {
 	e := gin.New()
 	e.Use(ReqIdMiddleware())
+	e.Use(metrics.GinMiddleware(e))
 	e.Use(GinLogMiddleware())
 	e.Use(CORSMiddleware())
 	e.Use(RecoveryMiddleware(DefaultStopExecHandler))
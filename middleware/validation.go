@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/leyle/ginbase/i18n"
+	"gopkg.in/go-playground/validator.v8"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 参数校验失败，data.fields 中是每个字段的错误
+var ErrValidation = RegisterErr(&CustomErrStruct{
+	Code:   4001,
+	Msg:    "Validation failed",
+	Status: http.StatusBadRequest,
+})
+
+// 替换 gin 默认的 validator
+// 使用 json tag 作为字段名，这样返回的字段路径与请求 body 一致，并注册项目中的自定义规则
+type ginValidator struct {
+	validate *validator.Validate
+}
+
+var _ binding.StructValidator = &ginValidator{}
+
+func (v *ginValidator) ValidateStruct(obj interface{}) error {
+	value := reflect.ValueOf(obj)
+	kind := value.Kind()
+	if kind == reflect.Ptr {
+		kind = value.Elem().Kind()
+	}
+	if kind == reflect.Struct {
+		return v.validate.Struct(obj)
+	}
+	return nil
+}
+
+func (v *ginValidator) Engine() interface{} {
+	return v.validate
+}
+
+var defaultValidator = &ginValidator{
+	validate: validator.New(&validator.Config{TagName: "binding", FieldNameTag: "json"}),
+}
+
+func init() {
+	RegisterValidation("httpmethod", isHttpMethod)
+	RegisterValidation("rolepath", isRolePath)
+	RegisterValidation("objectid", isObjectId)
+	registerValidationMsgs()
+	binding.Validator = defaultValidator
+}
+
+// 注册自定义的校验规则，在 binding tag 中使用，比如 binding:"omitempty,objectid"
+// 错误信息通过 RegisterValidationMsg 添加，没有时使用默认的信息
+// 规则名重复属于程序错误，直接 panic
+func RegisterValidation(tag string, fn validator.Func) {
+	if err := defaultValidator.validate.RegisterValidation(tag, fn); err != nil {
+		panic("注册校验规则失败, " + err.Error())
+	}
+}
+
+// http 方法，roleapp 中的 * 表示全部方法
+var validHttpMethods = map[string]bool{
+	"*":                true,
+	http.MethodGet:     true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+func isHttpMethod(v *validator.Validate, topStruct reflect.Value, currentStruct reflect.Value, field reflect.Value, fieldType reflect.Type, fieldKind reflect.Kind, param string) bool {
+	return fieldKind == reflect.String && validHttpMethods[strings.ToUpper(field.String())]
+}
+
+// roleapp 中 item 的 path，* 表示全部，或者以 / 开头，其中的 * 匹配一段字母数字
+var rolePathChars = regexp.MustCompile(`^/[A-Za-z0-9_\-./:*]*$`)
+
+func isRolePath(v *validator.Validate, topStruct reflect.Value, currentStruct reflect.Value, field reflect.Value, fieldType reflect.Type, fieldKind reflect.Kind, param string) bool {
+	if fieldKind != reflect.String {
+		return false
+	}
+	path := field.String()
+	if path == "*" {
+		return true
+	}
+	if !rolePathChars.MatchString(path) {
+		return false
+	}
+	_, err := regexp.Compile("^" + strings.ReplaceAll(path, "*", "\\w+") + "$")
+	return err == nil
+}
+
+func isObjectId(v *validator.Validate, topStruct reflect.Value, currentStruct reflect.Value, field reflect.Value, fieldType reflect.Type, fieldKind reflect.Kind, param string) bool {
+	return fieldKind == reflect.String && bson.IsObjectIdHex(field.String())
+}
+
+// 字段错误的信息模板，{field} 与 {param} 会被替换
+// 长度相关的规则作用在字符串、数组与 map 上时使用 .len 后缀的模板
+// key 为 validation.规则名，validation 为没有对应模板时的默认信息
+func registerValidationMsgs() {
+	i18n.Register(i18n.LangZh, map[string]string{
+		"validation":            "{field} 校验失败",
+		"validation.required":   "{field} 为必填字段",
+		"validation.min":        "{field} 不能小于 {param}",
+		"validation.min.len":    "{field} 长度不能小于 {param}",
+		"validation.max":        "{field} 不能大于 {param}",
+		"validation.max.len":    "{field} 长度不能大于 {param}",
+		"validation.len":        "{field} 必须等于 {param}",
+		"validation.len.len":    "{field} 长度必须为 {param}",
+		"validation.gt":         "{field} 必须大于 {param}",
+		"validation.gt.len":     "{field} 长度必须大于 {param}",
+		"validation.gte":        "{field} 不能小于 {param}",
+		"validation.gte.len":    "{field} 长度不能小于 {param}",
+		"validation.lt":         "{field} 必须小于 {param}",
+		"validation.lt.len":     "{field} 长度必须小于 {param}",
+		"validation.lte":        "{field} 不能大于 {param}",
+		"validation.lte.len":    "{field} 长度不能大于 {param}",
+		"validation.eq":         "{field} 必须等于 {param}",
+		"validation.ne":         "{field} 不能等于 {param}",
+		"validation.email":      "{field} 不是合法的邮箱地址",
+		"validation.url":        "{field} 不是合法的 url",
+		"validation.numeric":    "{field} 必须是数字",
+		"validation.alphanum":   "{field} 只能包含字母与数字",
+		"validation.uuid":       "{field} 不是合法的 uuid",
+		"validation.httpmethod": "{field} 不是合法的 http 方法",
+		"validation.rolepath":   "{field} 不是合法的路径，必须为 * 或者以 / 开头",
+		"validation.objectid":   "{field} 不是合法的 id",
+		"validation.type":       "{field} 类型错误，应为 {param}",
+	})
+	i18n.Register(i18n.LangEn, map[string]string{
+		"validation":            "{field} is invalid",
+		"validation.required":   "{field} is required",
+		"validation.min":        "{field} must be at least {param}",
+		"validation.min.len":    "{field} must be at least {param} in length",
+		"validation.max":        "{field} must be at most {param}",
+		"validation.max.len":    "{field} must be at most {param} in length",
+		"validation.len":        "{field} must be {param}",
+		"validation.len.len":    "{field} must be {param} in length",
+		"validation.gt":         "{field} must be greater than {param}",
+		"validation.gt.len":     "{field} must be longer than {param}",
+		"validation.gte":        "{field} must be at least {param}",
+		"validation.gte.len":    "{field} must be at least {param} in length",
+		"validation.lt":         "{field} must be less than {param}",
+		"validation.lt.len":     "{field} must be shorter than {param}",
+		"validation.lte":        "{field} must be at most {param}",
+		"validation.lte.len":    "{field} must be at most {param} in length",
+		"validation.eq":         "{field} must be {param}",
+		"validation.ne":         "{field} must not be {param}",
+		"validation.email":      "{field} must be a valid email address",
+		"validation.url":        "{field} must be a valid url",
+		"validation.numeric":    "{field} must be numeric",
+		"validation.alphanum":   "{field} must contain only letters and digits",
+		"validation.uuid":       "{field} must be a valid uuid",
+		"validation.httpmethod": "{field} must be a valid http method",
+		"validation.rolepath":   "{field} must be * or a path starting with /",
+		"validation.objectid":   "{field} must be a valid id",
+		"validation.type":       "{field} must be of type {param}",
+	})
+}
+
+// 添加或者覆盖规则的错误信息模板
+func RegisterValidationMsg(lang, tag, tmpl string) {
+	i18n.Register(lang, map[string]string{validationKey(tag): tmpl})
+}
+
+func validationKey(tag string) string {
+	if tag == "" {
+		return "validation"
+	}
+	return "validation." + tag
+}
+
+func validationMsg(lang, tag, field, param string) string {
+	tmpl, ok := i18n.Lookup(lang, validationKey(tag))
+	if !ok {
+		tmpl, ok = i18n.Lookup(lang, validationKey(strings.TrimSuffix(tag, ".len")))
+	}
+	if !ok {
+		tmpl, _ = i18n.Lookup(lang, validationKey(""))
+	}
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(tmpl)
+}
+
+// 按长度校验的类型
+func isLenKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// 去掉最外层的结构体名，CreateItemForm.items[0].name 转为 items[0].name
+func fieldPath(ns string) string {
+	if idx := strings.Index(ns, "."); idx >= 0 {
+		return ns[idx+1:]
+	}
+	return ns
+}
+
+// 将 c.BindJSON 等返回的错误转为字段错误，lang 为 i18n 中的语言
+// 不是校验错误或者 json 类型错误时返回 nil
+func BindErr(err error, lang string) *CustomErrStruct {
+	var fields []*FieldError
+
+	var verrs validator.ValidationErrors
+	var terr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &verrs):
+		for _, fe := range verrs {
+			field := fieldPath(fe.NameNamespace)
+			key := fe.Tag
+			if isLenKind(fe.Kind) {
+				key += ".len"
+			}
+			fields = append(fields, &FieldError{
+				Field: field,
+				Rule:  fe.Tag,
+				Param: fe.Param,
+				Msg:   validationMsg(lang, key, field, fe.Param),
+			})
+		}
+		// map 无序，按字段排序保证返回稳定
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].Field < fields[j].Field
+		})
+	case errors.As(err, &terr):
+		field := terr.Field
+		if field == "" {
+			field = terr.Struct
+		}
+		param := terr.Type.String()
+		fields = append(fields, &FieldError{
+			Field: field,
+			Rule:  "type",
+			Param: param,
+			Msg:   validationMsg(lang, "type", field, param),
+		})
+	default:
+		return nil
+	}
+
+	msgs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		msgs = append(msgs, f.Msg)
+	}
+	return ErrValidation.Wrap(err).WithMsg(strings.Join(msgs, "; ")).WithFields(fields...)
+}
@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/token"
+	"net/http"
+	"strings"
+)
+
+// 保存登录 state 的 cookie，把 state 绑定到发起登录的浏览器
+const StateCookieName = "OIDC_STATE"
+
+func isHttps(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+// HttpOnly，SameSite=Lax 保证 idp 跳转回来的 GET 请求可以带上
+func setCookie(c *gin.Context, name, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   isHttps(c),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// 跳转到 idp 登录
+func LoginHandler(c *gin.Context, p *Provider) {
+	if token.CookieName == "" {
+		middleware.StopExec(ErrNoTokenCookie)
+	}
+
+	u, state, err := p.AuthCodeURL(c.Query("returnTo"))
+	middleware.StopExec(err)
+
+	setCookie(c, StateCookieName, state, int(p.opt.StateTTL))
+	c.Redirect(http.StatusFound, u)
+}
+
+// idp 回调，完成登录后同步角色并签发 jwt
+// jwt 写入 token.CookieName 的 HttpOnly cookie，然后跳转到 returnTo
+// 使用前需要设置 token.CookieName 开启 cookie 验证
+func CallbackHandler(c *gin.Context, p *Provider, db *dbandmq.Ds, jm *token.JwtManager) {
+	reqId := middleware.GetReqId(c)
+
+	if e := c.Query("error"); e != "" {
+		Logger.Warnf(reqId, "oidc登录失败, %s %s", e, c.Query("error_description"))
+		returnfun.Return401Json(c, e)
+		return
+	}
+
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(StateCookieName)
+	setCookie(c, StateCookieName, "", -1)
+	if cookieState == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		Logger.Warnf(reqId, "oidc登录失败, state 与 cookie 不一致")
+		returnfun.Return401Json(c, ErrInvalidState.Error())
+		return
+	}
+
+	lr, err := p.Exchange(state, c.Query("code"))
+	if err == ErrInvalidState || err == ErrInvalidCode || err == ErrInvalidIdToken {
+		Logger.Warnf(reqId, "oidc登录失败, %s", err.Error())
+		returnfun.Return401Json(c, err.Error())
+		return
+	}
+	middleware.StopExec(err)
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	err = p.SyncRoles(ds, lr)
+	middleware.StopExec(err)
+
+	ar := roleapp.LoadUser(ds, lr.UserId)
+	if ar.Result == roleapp.AuthResultInternalError {
+		middleware.StopExec(middleware.ErrDbExec.Append(ar.Msg))
+	}
+
+	claims := &token.Claims{
+		Subject: lr.UserId,
+		Name:    lr.Name,
+		Roles:   ar.Roles,
+	}
+	tk, err := jm.Issue(claims)
+	middleware.StopExec(err)
+
+	Logger.Infof(reqId, "sso用户[%s][%s]登录成功", lr.UserId, lr.Name)
+
+	setCookie(c, token.CookieName, tk, int(jm.Expire().Seconds()))
+	c.Redirect(http.StatusFound, lr.ReturnTo)
+}
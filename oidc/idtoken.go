@@ -0,0 +1,215 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// jwks 中的一个公钥，只支持 RSA 与 EC
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func b64Int(s string) (*big.Int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, false
+	}
+	return new(big.Int).SetBytes(b), true
+}
+
+func algHash(alg string) (crypto.Hash, bool) {
+	if len(alg) != 5 {
+		return 0, false
+	}
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, true
+	case "384":
+		return crypto.SHA384, true
+	case "512":
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// 使用 jwk 验证签名，不支持 HMAC 与 none
+func (k *jwk) verify(alg string, input, sig []byte) bool {
+	if k.Alg != "" && k.Alg != alg {
+		return false
+	}
+	h, ok := algHash(alg)
+	if !ok {
+		return false
+	}
+	hasher := h.New()
+	hasher.Write(input)
+	digest := hasher.Sum(nil)
+
+	switch {
+	case k.Kty == "RSA" && strings.HasPrefix(alg, "RS"):
+		n, ok1 := b64Int(k.N)
+		e, ok2 := b64Int(k.E)
+		if !ok1 || !ok2 {
+			return false
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		return rsa.VerifyPKCS1v15(pub, h, digest, sig) == nil
+	case k.Kty == "EC" && strings.HasPrefix(alg, "ES"):
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return false
+		}
+		x, ok1 := b64Int(k.X)
+		y, ok2 := b64Int(k.Y)
+		if !ok1 || !ok2 {
+			return false
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+// id token 中的 claims，原始数据保存在 Raw 中用于角色映射
+type IdToken struct {
+	Issuer   string
+	Subject  string
+	Audience []string
+	Nonce    string
+	Email    string
+	Name     string
+	Expiry   int64
+	Raw      map[string]interface{}
+}
+
+// 读取字符串或者字符串数组类型的 claim
+func (t *IdToken) ClaimStrings(name string) []string {
+	switch v := t.Raw[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var ret []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+func claimString(m map[string]interface{}, name string) string {
+	s, _ := m[name].(string)
+	return s
+}
+
+func claimInt(m map[string]interface{}, name string) int64 {
+	f, _ := m[name].(float64)
+	return int64(f)
+}
+
+// 验证 id token 的签名、iss、aud、exp 与 nonce
+func (p *Provider) VerifyIdToken(raw, nonce string) (*IdToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIdToken
+	}
+
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidIdToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err = json.Unmarshal(hb, &h); err != nil {
+		return nil, ErrInvalidIdToken
+	}
+
+	k, err := p.getKey(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !k.verify(h.Alg, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrInvalidIdToken
+	}
+
+	pb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidIdToken
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(pb, &m); err != nil {
+		return nil, ErrInvalidIdToken
+	}
+
+	t := &IdToken{
+		Issuer:  claimString(m, "iss"),
+		Subject: claimString(m, "sub"),
+		Nonce:   claimString(m, "nonce"),
+		Email:   claimString(m, "email"),
+		Name:    claimString(m, "name"),
+		Expiry:  claimInt(m, "exp"),
+		Raw:     m,
+	}
+	t.Audience = t.ClaimStrings("aud")
+
+	if strings.TrimSuffix(t.Issuer, "/") != p.opt.Issuer || t.Subject == "" {
+		return nil, ErrInvalidIdToken
+	}
+
+	audOk := false
+	for _, aud := range t.Audience {
+		if aud == p.opt.ClientId {
+			audOk = true
+		}
+	}
+	// 多个 aud 时 azp 必须是自己
+	if !audOk || len(t.Audience) > 1 && claimString(m, "azp") != p.opt.ClientId {
+		return nil, ErrInvalidIdToken
+	}
+
+	leeway := p.opt.Leeway
+	if t.Expiry == 0 || time.Now().Unix() > t.Expiry+leeway {
+		return nil, ErrInvalidIdToken
+	}
+
+	if nonce == "" || t.Nonce != nonce {
+		return nil, ErrInvalidIdToken
+	}
+
+	return t, nil
+}
@@ -0,0 +1,300 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// sso 用户在 RoleAndUser 中的 userId 前缀
+const PrincipalPrefix = "oidc:"
+
+func PrincipalId(sub string) string {
+	return PrincipalPrefix + sub
+}
+
+// 登录发起时保存的数据
+type loginState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"returnTo"`
+}
+
+type LoginResult struct {
+	UserId   string   `json:"userId"`
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	RoleIds  []string `json:"roleIds"`
+	ReturnTo string   `json:"returnTo"`
+	IdToken  *IdToken `json:"-"`
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func pkceChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func hasUnsafeChar(s string) bool {
+	for _, r := range s {
+		if r == '\\' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// 只允许站内的相对路径，防止登录后跳转到外部网站
+// 浏览器会忽略路径中的 tab 换行等字符，比如 /\t/evil.com 会被当作 //evil.com，所以这些字符一律拒绝
+func safeReturnTo(returnTo string) string {
+	if hasUnsafeChar(returnTo) {
+		return "/"
+	}
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil || hasUnsafeChar(u.Path) {
+		return "/"
+	}
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(u.Path, "//") {
+		return "/"
+	}
+	return returnTo
+}
+
+// 生成跳转到 idp 的登录地址，state nonce 与 pkce verifier 保存到 StateStore
+// 返回的 state 需要绑定到浏览器(比如 cookie)，回调时与参数中的 state 比较，防止登录 csrf
+func (p *Provider) AuthCodeURL(returnTo string) (authUrl, state string, err error) {
+	d, err := p.Discovery()
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err = randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(48)
+	if err != nil {
+		return "", "", err
+	}
+
+	ls := &loginState{
+		Nonce:    nonce,
+		Verifier: verifier,
+		ReturnTo: safeReturnTo(returnTo),
+	}
+	data, _ := json.Marshal(ls)
+	err = p.store.Save(state, string(data), time.Duration(p.opt.StateTTL)*time.Second)
+	if err != nil {
+		Logger.Errorf("", "保存oidc登录state失败, %s", err.Error())
+		return "", "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.opt.ClientId)
+	v.Set("redirect_uri", p.opt.RedirectUrl)
+	v.Set("scope", strings.Join(p.opt.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", pkceChallenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), state, nil
+}
+
+type tokenResponse struct {
+	IdToken          string `json:"id_token"`
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// 使用 code 换取并验证 id token
+func (p *Provider) exchangeCode(code, verifier string) (*tokenResponse, error) {
+	d, err := p.Discovery()
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.opt.RedirectUrl)
+	v.Set("client_id", p.opt.ClientId)
+	v.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.opt.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.opt.ClientId), url.QueryEscape(p.opt.ClientSecret))
+	}
+
+	resp, err := p.opt.Client.Do(req)
+	if err != nil {
+		Logger.Errorf("", "请求oidc token接口失败, %s", err.Error())
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var tr *tokenResponse
+	err = json.Unmarshal(body, &tr)
+	if err != nil {
+		return nil, fmt.Errorf("parse token response failed, status %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		Logger.Warnf("", "oidc token接口返回错误, %s %s", tr.Error, tr.ErrorDescription)
+		return nil, ErrInvalidCode
+	}
+	if tr.IdToken == "" {
+		return nil, ErrInvalidIdToken
+	}
+	return tr, nil
+}
+
+// 完成登录，校验 state 后换取 id token，并返回映射后的角色
+// state 只能使用一次
+func (p *Provider) Exchange(state, code string) (*LoginResult, error) {
+	if state == "" || code == "" {
+		return nil, ErrInvalidState
+	}
+
+	val, err := p.store.Take(state)
+	if err != nil {
+		Logger.Errorf("", "读取oidc登录state失败, %s", err.Error())
+		return nil, err
+	}
+	if val == "" {
+		return nil, ErrInvalidState
+	}
+	var ls *loginState
+	if err = json.Unmarshal([]byte(val), &ls); err != nil {
+		return nil, ErrInvalidState
+	}
+
+	tr, err := p.exchangeCode(code, ls.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	idt, err := p.VerifyIdToken(tr.IdToken, ls.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	name := idt.Name
+	if name == "" {
+		name = idt.Email
+	}
+
+	return &LoginResult{
+		UserId:   PrincipalId(idt.Subject),
+		Name:     name,
+		Email:    idt.Email,
+		RoleIds:  p.MapRoles(idt),
+		ReturnTo: ls.ReturnTo,
+		IdToken:  idt,
+	}, nil
+}
+
+// 按配置把 id token 的 claims 映射为 roleapp 的 roleId
+func (p *Provider) MapRoles(idt *IdToken) []string {
+	roleIds := append([]string{}, p.opt.DefaultRoleIds...)
+	for _, m := range p.opt.Mappings {
+		vals := idt.ClaimStrings(m.Claim)
+		for _, v := range vals {
+			if m.Value == "*" || v == m.Value {
+				roleIds = append(roleIds, m.RoleIds...)
+				break
+			}
+		}
+	}
+	return util.UniqueStringArray(roleIds)
+}
+
+// 把映射后的角色写入 RoleAndUser
+// 未配置 KeepLocalRoles 时以 idp 为准，覆盖本地分配的角色
+func (p *Provider) SyncRoles(ds *dbandmq.Ds, lr *LoginResult) error {
+	rau, err := roleapp.GetRoleAndUserByUserId(ds, lr.UserId)
+	if err != nil {
+		return err
+	}
+
+	curT := util.GetCurTime()
+	if rau == nil {
+		rau = &roleapp.RoleAndUser{
+			Id:       util.GenerateDataId(),
+			UserId:   lr.UserId,
+			UserName: lr.Name,
+			RoleIds:  lr.RoleIds,
+			CreateT:  curT,
+			UpdateT:  curT,
+		}
+		err = roleapp.SaveRoleAndUser(ds, rau)
+		if err != nil {
+			Logger.Errorf("", "保存sso用户[%s]角色失败, %s", lr.UserId, err.Error())
+			return middleware.ErrDbExec.Append(err.Error())
+		}
+		return nil
+	}
+
+	roleIds := lr.RoleIds
+	if p.opt.KeepLocalRoles {
+		roleIds = util.UniqueStringArray(append(rau.RoleIds, roleIds...))
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"userName": lr.Name,
+			"roleIds":  roleIds,
+			"updateT":  curT,
+		},
+	}
+	err = ds.TC(roleapp.CollectionNameRoleAndUser).UpdateId(rau.Id, update)
+	if err != nil {
+		Logger.Errorf("", "更新sso用户[%s]角色失败, %s", lr.UserId, err.Error())
+		return middleware.ErrDbExec.Append(err.Error())
+	}
+	lr.RoleIds = roleIds
+	return nil
+}
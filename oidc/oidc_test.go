@@ -0,0 +1,250 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/token"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	lock sync.Mutex
+	m    map[string]string
+}
+
+func (s *memStore) Save(key, val string, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.m[key] = val
+	return nil
+}
+
+func (s *memStore) Take(key string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	val := s.m[key]
+	delete(s.m, key)
+	return val, nil
+}
+
+// 本地模拟的 idp，authorize 接口直接记录 nonce 与 challenge
+type fakeIdp struct {
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	nonce     string
+	challenge string
+}
+
+func newFakeIdp(t *testing.T) *fakeIdp {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdp{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "idp-1",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		h := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(h[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"id_token":     idp.sign(t, "client-1"),
+			"access_token": "at",
+			"token_type":   "Bearer",
+		})
+	})
+	idp.srv = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *fakeIdp) sign(t *testing.T, aud string) string {
+	h, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "idp-1"})
+	p, _ := json.Marshal(map[string]interface{}{
+		"iss":    idp.srv.URL,
+		"sub":    "alice",
+		"aud":    aud,
+		"exp":    time.Now().Add(time.Minute).Unix(),
+		"nonce":  idp.nonce,
+		"name":   "Alice",
+		"groups": []string{"dev", "ops"},
+	})
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestLoginFlow(t *testing.T) {
+	idp := newFakeIdp(t)
+	defer idp.srv.Close()
+
+	p := NewProviderWithStore(&Option{
+		Issuer:         idp.srv.URL,
+		ClientId:       "client-1",
+		RedirectUrl:    "http://localhost/oidc/callback",
+		DefaultRoleIds: []string{"r-default"},
+		Mappings: []*ClaimMapping{
+			{Claim: "groups", Value: "ops", RoleIds: []string{"r-ops"}},
+			{Claim: "groups", Value: "admin", RoleIds: []string{"r-admin"}},
+		},
+	}, &memStore{m: make(map[string]string)})
+
+	u, state, err := p.AuthCodeURL("https://evil.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pu, _ := url.Parse(u)
+	q := pu.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client-1" {
+		t.Fatal("bad authorize url", u)
+	}
+	idp.nonce = q.Get("nonce")
+	idp.challenge = q.Get("code_challenge")
+	if q.Get("state") != state {
+		t.Fatal("state mismatch", state)
+	}
+
+	lr, err := p.Exchange(state, "good-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lr.UserId != "oidc:alice" || lr.ReturnTo != "/" {
+		t.Error("bad login result", lr.UserId, lr.ReturnTo)
+	}
+	if len(lr.RoleIds) != 2 {
+		t.Error("bad mapped roles", lr.RoleIds)
+	}
+
+	// state 只能使用一次
+	if _, err = p.Exchange(state, "good-code"); err != ErrInvalidState {
+		t.Error("state should be consumed", err)
+	}
+}
+
+func TestVerifyIdToken(t *testing.T) {
+	idp := newFakeIdp(t)
+	defer idp.srv.Close()
+
+	p := NewProviderWithStore(&Option{Issuer: idp.srv.URL, ClientId: "client-1"}, &memStore{m: make(map[string]string)})
+	idp.nonce = "n1"
+
+	if _, err := p.VerifyIdToken(idp.sign(t, "client-1"), "n1"); err != nil {
+		t.Error("valid token rejected", err)
+	}
+	if _, err := p.VerifyIdToken(idp.sign(t, "client-2"), "n1"); err != ErrInvalidIdToken {
+		t.Error("bad audience should be rejected", err)
+	}
+	if _, err := p.VerifyIdToken(idp.sign(t, "client-1"), "n2"); err != ErrInvalidIdToken {
+		t.Error("bad nonce should be rejected", err)
+	}
+}
+
+func TestCallbackStateCookie(t *testing.T) {
+	idp := newFakeIdp(t)
+	defer idp.srv.Close()
+
+	p := NewProviderWithStore(&Option{Issuer: idp.srv.URL, ClientId: "client-1"}, &memStore{m: make(map[string]string)})
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware())
+	NoNeedAuthRouter(e.Group(""), p, nil, nil)
+
+	token.CookieName = "JWT_TOKEN"
+	defer func() { token.CookieName = "" }()
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatal("login should redirect", w.Code)
+	}
+	var cookie *http.Cookie
+	for _, ck := range w.Result().Cookies() {
+		if ck.Name == StateCookieName {
+			cookie = ck
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.Value == "" {
+		t.Fatal("state cookie not set", cookie)
+	}
+
+	// 没有 cookie 或 cookie 与 state 不一致时拒绝，state 不会被消费
+	req := httptest.NewRequest("GET", "/oidc/callback?code=good-code&state="+url.QueryEscape(cookie.Value), nil)
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Error("callback without cookie should be rejected", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/oidc/callback?code=good-code&state="+url.QueryEscape(cookie.Value), nil)
+	req.AddCookie(&http.Cookie{Name: StateCookieName, Value: "other"})
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Error("callback with mismatched cookie should be rejected", w.Code)
+	}
+}
+
+func TestSafeReturnTo(t *testing.T) {
+	cases := map[string]string{
+		"/home?a=1":          "/home?a=1",
+		"/a/b#c":             "/a/b#c",
+		"":                   "/",
+		"https://evil.com":   "/",
+		"//evil.com":         "/",
+		"/\\evil.com":        "/",
+		"/\t/evil.com":       "/",
+		"/\n/evil.com":       "/",
+		"/\r/evil.com":       "/",
+		"/%09/evil.com":      "/",
+		"/%0a/evil.com":      "/",
+		"/%2F/evil.com":      "/",
+		"/ /evil.com":        "/",
+		"javascript:alert()": "/",
+		"evil.com":           "/",
+	}
+	for in, want := range cases {
+		if got := safeReturnTo(in); got != want {
+			t.Errorf("safeReturnTo(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
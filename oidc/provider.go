@@ -0,0 +1,200 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	. "github.com/leyle/ginbase/consolelog"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 单位秒
+	DefaultDiscoveryTTL = 24 * 3600
+	DefaultJwksTTL      = 3600
+	DefaultStateTTL     = 600
+
+	// 遇到未知 kid 时重新拉取 jwks 的最小间隔，防止被伪造的 kid 刷接口
+	jwksMinRefresh = time.Minute
+)
+
+// idp 的 claim 到 roleapp role 的映射
+// claim 的值可以是字符串或者字符串数组，Value 为 * 时只要 claim 存在即可
+type ClaimMapping struct {
+	Claim   string   `json:"claim" yaml:"claim"`
+	Value   string   `json:"value" yaml:"value"`
+	RoleIds []string `json:"roleIds" yaml:"roleIds"`
+}
+
+type Option struct {
+	Issuer       string   `json:"issuer" yaml:"issuer"` // idp 地址，discovery 文档为 Issuer + /.well-known/openid-configuration
+	ClientId     string   `json:"clientId" yaml:"clientId"`
+	ClientSecret string   `json:"clientSecret" yaml:"clientSecret"` // 公开客户端可以为空，只依赖 pkce
+	RedirectUrl  string   `json:"redirectUrl" yaml:"redirectUrl"`
+	Scopes       []string `json:"scopes" yaml:"scopes"` // 为空时使用 openid profile email
+
+	Mappings       []*ClaimMapping `json:"mappings" yaml:"mappings"`
+	DefaultRoleIds []string        `json:"defaultRoleIds" yaml:"defaultRoleIds"` // 所有 sso 用户都有的角色
+	KeepLocalRoles bool            `json:"keepLocalRoles" yaml:"keepLocalRoles"` // 为 true 时保留本地额外分配的角色，否则每次登录以 idp 为准
+
+	// 以下单位都是秒
+	DiscoveryTTL int64 `json:"discoveryTTL" yaml:"discoveryTTL"`
+	JwksTTL      int64 `json:"jwksTTL" yaml:"jwksTTL"`
+	StateTTL     int64 `json:"stateTTL" yaml:"stateTTL"`
+	Leeway       int64 `json:"leeway" yaml:"leeway"` // 验证 id token exp 时允许的时钟偏差
+
+	Client *http.Client `json:"-" yaml:"-"` // 为空时使用带超时的默认 client
+}
+
+var (
+	ErrInvalidState   = errors.New("登录状态无效或已过期")
+	ErrInvalidIdToken = errors.New("id token 无效")
+	ErrInvalidCode    = errors.New("授权码无效或已过期")
+	ErrNoTokenCookie  = errors.New("未配置 token.CookieName，无法保存登录后的 jwt")
+)
+
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JwksUri               string   `json:"jwks_uri"`
+	AlgValues             []string `json:"id_token_signing_alg_values_supported"`
+}
+
+type Provider struct {
+	opt   *Option
+	store StateStore
+
+	lock       sync.Mutex
+	discovery  *Discovery
+	discoveryT time.Time
+	jwks       map[string]*jwk
+	jwksT      time.Time
+}
+
+// 使用 redis 保存 state 与 nonce
+func NewProvider(opt *Option, r *redis.Client) *Provider {
+	return NewProviderWithStore(opt, &RedisStateStore{R: r})
+}
+
+func NewProviderWithStore(opt *Option, store StateStore) *Provider {
+	if opt.Client == nil {
+		opt.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(opt.Scopes) == 0 {
+		opt.Scopes = []string{"openid", "profile", "email"}
+	}
+	if opt.DiscoveryTTL <= 0 {
+		opt.DiscoveryTTL = DefaultDiscoveryTTL
+	}
+	if opt.JwksTTL <= 0 {
+		opt.JwksTTL = DefaultJwksTTL
+	}
+	if opt.StateTTL <= 0 {
+		opt.StateTTL = DefaultStateTTL
+	}
+	opt.Issuer = strings.TrimSuffix(opt.Issuer, "/")
+
+	return &Provider{
+		opt:   opt,
+		store: store,
+	}
+}
+
+func (p *Provider) getJson(url string, v interface{}) error {
+	resp, err := p.opt.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s failed, status %d", url, resp.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// 读取 discovery 文档，按 DiscoveryTTL 缓存
+func (p *Provider) Discovery() (*Discovery, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.discovery != nil && time.Since(p.discoveryT) < time.Duration(p.opt.DiscoveryTTL)*time.Second {
+		return p.discovery, nil
+	}
+
+	var d *Discovery
+	err := p.getJson(p.opt.Issuer+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		Logger.Errorf("", "读取oidc discovery文档失败, %s", err.Error())
+		if p.discovery != nil {
+			// 拉取失败时继续使用旧的文档
+			return p.discovery, nil
+		}
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.opt.Issuer {
+		return nil, fmt.Errorf("discovery issuer[%s] does not match[%s]", d.Issuer, p.opt.Issuer)
+	}
+
+	p.discovery = d
+	p.discoveryT = time.Now()
+	return d, nil
+}
+
+// 按 kid 读取 jwk，缓存过期或者 kid 未知时重新拉取
+func (p *Provider) getKey(kid string) (*jwk, error) {
+	d, err := p.Discovery()
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	k, ok := p.jwks[kid]
+	if ok && time.Since(p.jwksT) < time.Duration(p.opt.JwksTTL)*time.Second {
+		return k, nil
+	}
+	if !ok && p.jwks != nil && time.Since(p.jwksT) < jwksMinRefresh {
+		return nil, ErrInvalidIdToken
+	}
+
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	err = p.getJson(d.JwksUri, &set)
+	if err != nil {
+		Logger.Errorf("", "读取oidc jwks失败, %s", err.Error())
+		if ok {
+			return k, nil
+		}
+		return nil, err
+	}
+
+	keys := make(map[string]*jwk)
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		keys[key.Kid] = key
+	}
+	p.jwks = keys
+	p.jwksT = time.Now()
+
+	k, ok = keys[kid]
+	if !ok {
+		return nil, ErrInvalidIdToken
+	}
+	return k, nil
+}
@@ -0,0 +1,22 @@
+package oidc
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/token"
+)
+
+// sso 登录接口，不需要验证
+// 登录成功后签发的 jwt 写入 cookie，需要设置 token.CookieName 后使用 token.JwtManager.Middleware 验证
+func NoNeedAuthRouter(g *gin.RouterGroup, p *Provider, ds *dbandmq.Ds, jm *token.JwtManager) {
+	oidcR := g.Group("/oidc")
+	{
+		oidcR.GET("/login", func(c *gin.Context) {
+			LoginHandler(c, p)
+		})
+
+		oidcR.GET("/callback", func(c *gin.Context) {
+			CallbackHandler(c, p, ds, jm)
+		})
+	}
+}
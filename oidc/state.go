@@ -0,0 +1,37 @@
+package oidc
+
+import (
+	"github.com/go-redis/redis"
+	"time"
+)
+
+// 保存登录过程中的 state nonce 与 pkce verifier
+// Take 读取后立即删除，保证 state 只能使用一次
+type StateStore interface {
+	Save(key, val string, ttl time.Duration) error
+	Take(key string) (string, error) // 不存在时返回空字符串
+}
+
+const statePrefix = "OIDC-STATE-"
+
+type RedisStateStore struct {
+	R *redis.Client
+}
+
+func (s *RedisStateStore) Save(key, val string, ttl time.Duration) error {
+	return s.R.Set(statePrefix+key, val, ttl).Err()
+}
+
+func (s *RedisStateStore) Take(key string) (string, error) {
+	pipe := s.R.TxPipeline()
+	get := pipe.Get(statePrefix + key)
+	pipe.Del(statePrefix + key)
+	_, err := pipe.Exec()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return get.Val(), nil
+}
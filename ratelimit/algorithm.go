@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// 一次限流判断的结果
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // 配额恢复的时间
+	RetryAfter time.Duration // 被拒绝时需要等待的时间
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(math.Ceil(ms)) * time.Millisecond
+}
+
+// 令牌桶状态
+type bucketState struct {
+	tokens float64
+	ts     float64 // 上次更新的时间，毫秒
+}
+
+// 与 tokenBucketScript 的逻辑相同，state 为 nil 时桶是满的
+func takeTokenBucket(state *bucketState, limit int, periodMs, nowMs float64) (*bucketState, *Result) {
+	capacity := float64(limit)
+	rate := capacity / periodMs
+	tokens := capacity
+	if state != nil {
+		tokens = math.Min(capacity, state.tokens+math.Max(0, nowMs-state.ts)*rate)
+	}
+
+	ret := &Result{Limit: limit}
+	if tokens >= 1 {
+		tokens--
+		ret.Allowed = true
+	} else {
+		ret.RetryAfter = msDuration((1 - tokens) / rate)
+	}
+	ret.Remaining = int(math.Floor(tokens))
+	ret.Reset = msDuration((capacity - tokens) / rate)
+	return &bucketState{tokens: tokens, ts: nowMs}, ret
+}
+
+// 滑动窗口状态，当前窗口与上一个窗口的计数
+type windowState struct {
+	idx  int64 // 当前窗口的序号，nowMs / windowMs
+	cur  float64
+	prev float64
+}
+
+// 与 slidingWindowScript 的逻辑相同
+// 估算的请求数 = 上一个窗口的计数 * 上一个窗口在滑动窗口中的占比 + 当前窗口的计数
+func takeSlidingWindow(state *windowState, limit int, windowMs, nowMs float64) (*windowState, *Result) {
+	idx := int64(math.Floor(nowMs / windowMs))
+	s := &windowState{idx: idx}
+	if state != nil {
+		switch state.idx {
+		case idx:
+			s.cur, s.prev = state.cur, state.prev
+		case idx - 1:
+			s.prev = state.cur
+		}
+	}
+
+	elapsed := nowMs - float64(idx)*windowMs
+	count := s.prev*(windowMs-elapsed)/windowMs + s.cur
+	ret := &Result{
+		Limit: limit,
+		Reset: msDuration(windowMs - elapsed),
+	}
+	if count+1 <= float64(limit) {
+		s.cur++
+		ret.Allowed = true
+		ret.Remaining = int(math.Floor(float64(limit) - count - 1))
+		return s, ret
+	}
+
+	// 需要等到估算的请求数降到 limit - 1
+	free := float64(limit) - 1
+	if s.cur > free {
+		// 当前窗口已经用完，等到下一个窗口中当前窗口的占比足够小
+		ret.RetryAfter = msDuration(windowMs - elapsed + windowMs*(1-free/s.cur))
+	} else {
+		ret.RetryAfter = msDuration(windowMs - (free-s.cur)*windowMs/s.prev - elapsed)
+	}
+	return s, ret
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	. "github.com/leyle/ginbase/consolelog"
+	"sync"
+	"time"
+)
+
+const keyPrefix = "RATELIMIT-"
+
+var ErrTooManyRequests = errors.New("请求过于频繁，请稍后再试")
+
+// 限流器，使用 redis 脚本保证多个实例之间计数一致
+// redis 不可用时退回到本地计数，此时每个实例分别限流
+type Limiter struct {
+	r     *redis.Client
+	local *memoryStore
+
+	lock      sync.Mutex
+	lastWarn  time.Time
+	downUntil time.Time // 在此之前不使用 redis
+}
+
+// r 为 nil 时只使用本地计数
+func NewLimiter(r *redis.Client) *Limiter {
+	return &Limiter{
+		r:     r,
+		local: newMemoryStore(),
+	}
+}
+
+// redis 错误日志的最小间隔，避免 redis 故障时每个请求都打印
+const warnInterval = time.Minute
+
+// redis 出错后的这段时间内直接使用本地计数，避免 redis 故障时每个请求都等待连接或读取超时
+var RedisRetryInterval = 5 * time.Second
+
+func (l *Limiter) redisAvailable(now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return !now.Before(l.downUntil)
+}
+
+// 记录 redis 错误，暂停使用 redis 并按间隔打印日志
+func (l *Limiter) markRedisDown(err error, now time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.downUntil = now.Add(RedisRetryInterval)
+	if now.Sub(l.lastWarn) < warnInterval {
+		return
+	}
+	l.lastWarn = now
+	Logger.Warnf("", "限流使用redis失败，%v 内退回到本地计数, %s", RedisRetryInterval, err.Error())
+}
+
+func checkRule(rule *Rule) {
+	if rule.Name == "" || rule.Limit <= 0 || rule.Period < time.Millisecond {
+		panic(fmt.Sprintf("限流规则[%s]配置错误，需要 Name、Limit 与不小于 1ms 的 Period", rule.Name))
+	}
+	if alg := rule.algorithm(); alg != AlgTokenBucket && alg != AlgSlidingWindow {
+		panic(fmt.Sprintf("限流规则[%s]的算法[%s]不支持", rule.Name, alg))
+	}
+}
+
+// 对 key 按 rule 计数一次
+func (l *Limiter) Take(rule *Rule, key string) *Result {
+	now := time.Now()
+	if l.r != nil && l.redisAvailable(now) {
+		ret, err := l.takeRedis(rule, key)
+		if err == nil {
+			return ret
+		}
+		l.markRedisDown(err, now)
+	}
+	return l.local.take(rule, key, now)
+}
+
+func (l *Limiter) takeRedis(rule *Rule, key string) (*Result, error) {
+	script := tokenBucketScript
+	if rule.algorithm() == AlgSlidingWindow {
+		script = slidingWindowScript
+	}
+
+	rkey := keyPrefix + rule.Name + "-" + key
+	periodMs := int64(rule.Period / time.Millisecond)
+	val, err := script.Run(l.r, []string{rkey}, rule.Limit, periodMs).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	vals, ok := val.([]interface{})
+	if !ok || len(vals) != 4 {
+		return nil, fmt.Errorf("unexpected script result %v", val)
+	}
+	nums := make([]int64, 4)
+	for i, v := range vals {
+		if nums[i], ok = v.(int64); !ok {
+			return nil, fmt.Errorf("unexpected script result %v", val)
+		}
+	}
+
+	return &Result{
+		Allowed:    nums[0] == 1,
+		Limit:      rule.Limit,
+		Remaining:  int(nums[1]),
+		RetryAfter: time.Duration(nums[2]) * time.Millisecond,
+		Reset:      time.Duration(nums[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// redis 不可用时使用的本地计数，只对当前进程生效
+type memoryStore struct {
+	lock    sync.Mutex
+	buckets map[string]*bucketState
+	windows map[string]*windowState
+	expires map[string]float64 // key 的过期时间，毫秒
+	calls   int
+}
+
+// 每处理这么多次请求清理一次过期的 key
+const memorySweepEvery = 1024
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		buckets: make(map[string]*bucketState),
+		windows: make(map[string]*windowState),
+		expires: make(map[string]float64),
+	}
+}
+
+func nowMs(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Millisecond)
+}
+
+func (m *memoryStore) take(rule *Rule, key string, now time.Time) *Result {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ms := nowMs(now)
+	periodMs := float64(rule.Period / time.Millisecond)
+	m.calls++
+	if m.calls%memorySweepEvery == 0 {
+		m.sweep(ms)
+	}
+
+	// 与 redis 一样按规则区分，同一个 key 在不同规则下分别计数
+	key = rule.Name + "-" + key
+
+	var ret *Result
+	if rule.algorithm() == AlgSlidingWindow {
+		var s *windowState
+		s, ret = takeSlidingWindow(m.windows[key], rule.Limit, periodMs, ms)
+		m.windows[key] = s
+		m.expires[key] = ms + 2*periodMs
+	} else {
+		var s *bucketState
+		s, ret = takeTokenBucket(m.buckets[key], rule.Limit, periodMs, ms)
+		m.buckets[key] = s
+		m.expires[key] = ms + periodMs
+	}
+	return ret
+}
+
+func (m *memoryStore) sweep(ms float64) {
+	for key, exp := range m.expires {
+		if exp < ms {
+			delete(m.expires, key)
+			delete(m.buckets, key)
+			delete(m.windows, key)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"math"
+	"strconv"
+	"time"
+)
+
+// 响应 header，https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+const (
+	HeaderLimit      = "RateLimit-Limit"
+	HeaderRemaining  = "RateLimit-Remaining"
+	HeaderReset      = "RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+// 在 route group 上声明限流规则，比如
+// g.Use(limiter.Middleware(&ratelimit.Rule{Name: "order", Limit: 100, Period: time.Minute, Key: ratelimit.KeyByUser}))
+// 多条规则都会计数，header 返回剩余最少的一条，任意一条超限时返回 429
+func (l *Limiter) Middleware(rules ...*Rule) gin.HandlerFunc {
+	for _, rule := range rules {
+		checkRule(rule)
+	}
+
+	return func(c *gin.Context) {
+		var ret *Result
+		var hit *Rule
+		for _, rule := range rules {
+			key := rule.key(c)
+			if key == "" {
+				continue
+			}
+			r := l.Take(rule, key)
+			if ret == nil || moreRestrictive(r, ret) {
+				ret, hit = r, rule
+			}
+		}
+		if ret == nil {
+			c.Next()
+			return
+		}
+
+		setHeaders(c, ret)
+		if !ret.Allowed {
+			Logger.Warnf(middleware.GetReqId(c), "触发限流规则[%s], %s %s, %d秒后重试",
+				hit.Name, c.Request.Method, c.Request.URL.Path, seconds(ret.RetryAfter))
+			returnfun.Return429Json(c, ErrTooManyRequests.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+// 拒绝优先，都拒绝时等待时间长的优先，都允许时剩余少的优先
+func moreRestrictive(a, b *Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+// 向上取整的秒数
+func seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+func setHeaders(c *gin.Context, r *Result) {
+	c.Header(HeaderLimit, strconv.Itoa(r.Limit))
+	c.Header(HeaderRemaining, strconv.Itoa(r.Remaining))
+	c.Header(HeaderReset, strconv.FormatInt(seconds(r.Reset), 10))
+	if !r.Allowed {
+		c.Header(HeaderRetryAfter, strconv.FormatInt(seconds(r.RetryAfter), 10))
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/leyle/ginbase/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	// 容量 5，每秒恢复 5 个
+	var s *bucketState
+	var r *Result
+	for i := 0; i < 5; i++ {
+		s, r = takeTokenBucket(s, 5, 1000, 0)
+		if !r.Allowed || r.Remaining != 4-i {
+			t.Fatal("burst should be allowed", i, r)
+		}
+	}
+	s, r = takeTokenBucket(s, 5, 1000, 0)
+	if r.Allowed || r.RetryAfter != 200*time.Millisecond {
+		t.Fatal("empty bucket should be rejected", r)
+	}
+	if s, r = takeTokenBucket(s, 5, 1000, 200); !r.Allowed {
+		t.Fatal("token should be refilled", r)
+	}
+	if _, r = takeTokenBucket(s, 5, 1000, 10000); !r.Allowed || r.Remaining != 4 {
+		t.Fatal("bucket should not exceed capacity", r)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	// 每秒 10 个
+	var s *windowState
+	var r *Result
+	for i := 0; i < 10; i++ {
+		s, r = takeSlidingWindow(s, 10, 1000, 500)
+		if !r.Allowed {
+			t.Fatal("should be allowed", i)
+		}
+	}
+	s, r = takeSlidingWindow(s, 10, 1000, 500)
+	if r.Allowed || r.Reset != 500*time.Millisecond {
+		t.Fatal("should be rejected", r)
+	}
+
+	// 下一个窗口的一半，上一个窗口还占 5 个
+	s, r = takeSlidingWindow(s, 10, 1000, 1500)
+	if !r.Allowed || r.Remaining != 4 {
+		t.Fatal("half of the previous window should be counted", r)
+	}
+	for i := 0; i < 4; i++ {
+		s, _ = takeSlidingWindow(s, 10, 1000, 1500)
+	}
+	_, r = takeSlidingWindow(s, 10, 1000, 1500)
+	if r.Allowed || r.RetryAfter <= 0 {
+		t.Fatal("should be rejected with retry", r)
+	}
+
+	// 两个窗口之后清零
+	if _, r = takeSlidingWindow(s, 10, 1000, 3000); !r.Allowed || r.Remaining != 9 {
+		t.Fatal("old windows should be dropped", r)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	// redis 不可用时退回到本地计数
+	r := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: 0, DialTimeout: 100 * time.Millisecond})
+	l := NewLimiter(r)
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware())
+	g := e.Group("/api")
+	g.Use(l.Middleware(&Rule{Name: "test", Limit: 2, Period: time.Minute, Algorithm: AlgSlidingWindow}))
+	g.GET("/data", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	for _, remaining := range []string{"1", "0"} {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", "/api/data", nil))
+		if w.Code != http.StatusOK || w.Header().Get(HeaderLimit) != "2" || w.Header().Get(HeaderRemaining) != remaining {
+			t.Fatal("request should be allowed", w.Code, w.Header())
+		}
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/api/data", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(HeaderRetryAfter) == "" {
+		t.Fatal("request should be rejected", w.Code, w.Header())
+	}
+
+	// redis 出错后暂停使用 redis，不再等待超时
+	if l.redisAvailable(time.Now()) || !l.redisAvailable(time.Now().Add(RedisRetryInterval)) {
+		t.Error("redis should be skipped for RedisRetryInterval after an error")
+	}
+}
+
+func TestMemoryStoreRuleKey(t *testing.T) {
+	m := newMemoryStore()
+	now := time.Now()
+	a := &Rule{Name: "a", Limit: 1, Period: time.Minute}
+	b := &Rule{Name: "b", Limit: 1, Period: time.Minute}
+	if !m.take(a, "k", now).Allowed || !m.take(b, "k", now).Allowed {
+		t.Fatal("rules should be counted separately")
+	}
+	if m.take(a, "k", now).Allowed {
+		t.Fatal("rule a should be exhausted")
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/apikey"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/util"
+	"strings"
+	"time"
+)
+
+// 限流算法
+const (
+	AlgTokenBucket   = "tokenbucket"   // 令牌桶，允许 Limit 个请求的突发，之后按 Limit/Period 的速度恢复
+	AlgSlidingWindow = "slidingwindow" // 滑动窗口计数，按上一个窗口的计数加权估算，任意 Period 内大约不超过 Limit 个请求
+)
+
+// 从请求中生成限流的 key，返回空字符串时不限流
+type KeyFunc func(c *gin.Context) string
+
+// 一条限流规则，一般在 route group 上通过 Limiter.Middleware 声明
+type Rule struct {
+	Name      string        // 规则名，作为 key 的一部分，不同规则的计数互不影响
+	Algorithm string        // 默认 AlgTokenBucket
+	Limit     int           // 窗口内允许的请求数，或者令牌桶的容量
+	Period    time.Duration // 窗口长度，或者令牌桶从空到满的时间
+	Key       KeyFunc       // 默认 KeyByIp
+}
+
+func (r *Rule) algorithm() string {
+	if r.Algorithm == "" {
+		return AlgTokenBucket
+	}
+	return r.Algorithm
+}
+
+func (r *Rule) key(c *gin.Context) string {
+	if r.Key == nil {
+		return KeyByIp(c)
+	}
+	return r.Key(c)
+}
+
+func KeyByIp(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// 需要放在用户验证之后，没有登录用户时不限流
+func KeyByUser(c *gin.Context) string {
+	ar := roleapp.GetCurUser(c)
+	if ar == nil || ar.UserId == "" {
+		return ""
+	}
+	return "user:" + ar.UserId
+}
+
+// 通过验证的 key 使用 principal，未验证时使用 key 的 hash，不带 key 的请求不限流
+func KeyByApiKey(c *gin.Context) string {
+	key := c.GetHeader(apikey.ApiKeyHeader)
+	if key == "" {
+		return ""
+	}
+	if apikey.AuthedByApiKey(c) {
+		return "apikey:" + roleapp.GetCurUser(c).UserId
+	}
+	return "apikey:" + util.Sha256(key)[:32]
+}
+
+// gin 1.4 没有路由模板，使用 method 与 handler 名字区分路由
+func KeyByRoute(c *gin.Context) string {
+	return "route:" + c.Request.Method + " " + c.HandlerName()
+}
+
+// 组合多个 key，比如 Keys(KeyByRoute, KeyByIp) 按路由与 ip 分别计数
+// 任意一个为空时不限流
+func Keys(fs ...KeyFunc) KeyFunc {
+	return func(c *gin.Context) string {
+		parts := make([]string, 0, len(fs))
+		for _, f := range fs {
+			k := f(c)
+			if k == "" {
+				return ""
+			}
+			parts = append(parts, k)
+		}
+		return strings.Join(parts, "|")
+	}
+}
+
+// 返回第一个不为空的 key，比如 FirstKey(KeyByApiKey, KeyByUser, KeyByIp)
+func FirstKey(fs ...KeyFunc) KeyFunc {
+	return func(c *gin.Context) string {
+		for _, f := range fs {
+			if k := f(c); k != "" {
+				return k
+			}
+		}
+		return ""
+	}
+}
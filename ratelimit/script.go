@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// 脚本中使用 redis 的时间，避免多台服务器时钟不一致
+// redis 5 之前需要 replicate_commands 才能在 TIME 之后写入
+const scriptNow = `
+if redis.replicate_commands then redis.replicate_commands() end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + tonumber(t[2]) / 1000
+`
+
+// 与 takeTokenBucket 的逻辑相同
+// KEYS[1] 桶，ARGV[1] 容量，ARGV[2] 从空到满的毫秒数
+// 返回 {是否允许, 剩余令牌, 重试毫秒, 恢复满的毫秒}
+var tokenBucketScript = redis.NewScript(scriptNow + `
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local rate = capacity / period
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = capacity
+if data[1] then
+	tokens = math.min(capacity, tonumber(data[1]) + math.max(0, now - tonumber(data[2])) * rate)
+end
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(period))
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) / rate)}
+`)
+
+// 与 takeSlidingWindow 的逻辑相同
+// KEYS[1] 计数，ARGV[1] 窗口内允许的请求数，ARGV[2] 窗口毫秒数
+// 返回 {是否允许, 剩余请求数, 重试毫秒, 当前窗口结束的毫秒}
+var slidingWindowScript = redis.NewScript(scriptNow + `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local idx = math.floor(now / window)
+local data = redis.call('HMGET', KEYS[1], 'idx', 'cur', 'prev')
+local cur = 0
+local prev = 0
+if data[1] then
+	local sidx = tonumber(data[1])
+	if sidx == idx then
+		cur = tonumber(data[2])
+		prev = tonumber(data[3])
+	elseif sidx == idx - 1 then
+		prev = tonumber(data[2])
+	end
+end
+local elapsed = now - idx * window
+local count = prev * (window - elapsed) / window + cur
+local allowed = 0
+local remaining = 0
+local retry = 0
+if count + 1 <= limit then
+	cur = cur + 1
+	allowed = 1
+	remaining = math.floor(limit - count - 1)
+else
+	local free = limit - 1
+	if cur > free then
+		retry = window - elapsed + window * (1 - free / cur)
+	else
+		retry = window - (free - cur) * window / prev - elapsed
+	end
+end
+redis.call('HMSET', KEYS[1], 'idx', tostring(idx), 'cur', tostring(cur), 'prev', tostring(prev))
+redis.call('PEXPIRE', KEYS[1], math.ceil(2 * window))
+return {allowed, remaining, math.ceil(retry), math.ceil(window - elapsed)}
+`)
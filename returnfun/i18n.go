@@ -0,0 +1,33 @@
+package returnfun
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/i18n"
+)
+
+// 按请求的语言翻译消息
+func T(c *gin.Context, key string, args ...interface{}) string {
+	return i18n.T(i18n.Lang(c), key, args...)
+}
+
+// 错误信息，错误链中有 i18n.Message 时按请求的语言翻译
+func ErrMsg(c *gin.Context, err error) string {
+	var m *i18n.Message
+	if errors.As(err, &m) {
+		return m.In(i18n.Lang(c))
+	}
+	return err.Error()
+}
+
+func ReturnErrKeyJson(c *gin.Context, key string, args ...interface{}) {
+	ReturnErrJson(c, T(c, key, args...))
+}
+
+func Return403KeyJson(c *gin.Context, key string, args ...interface{}) {
+	Return403Json(c, T(c, key, args...))
+}
+
+func ReturnKeyJson(c *gin.Context, statusCode, code int, key string, data interface{}, args ...interface{}) {
+	ReturnJson(c, statusCode, code, T(c, key, args...), data)
+}
@@ -63,6 +63,10 @@ func Return403Json(c *gin.Context, msg string) {
 	ReturnJson(c, 403, 403, msg, "")
 }
 
+func Return429Json(c *gin.Context, msg string) {
+	ReturnJson(c, 429, 429, msg, "")
+}
+
 func ReturnJson(c *gin.Context, statusCode, code int, msg string, data interface{}) {
 	text := http.StatusText(statusCode)
 	if text == "" {
@@ -1,6 +1,10 @@
 package roleapp
 
-import "github.com/leyle/ginbase/dbandmq"
+import (
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/metrics"
+	"strings"
+)
 
 // 引用这个包的功能，需要调用这里的一些方法，来进行初始化
 func InitRoleApp(ds *dbandmq.Ds, dfName, adminId, adminName, uriPrefix string) error {
@@ -41,17 +45,90 @@ func InitRoleApp(ds *dbandmq.Ds, dfName, adminId, adminName, uriPrefix string) e
 // 验证用户是否有某权限
 // 根据 uid 读取用户角色和 api list
 // 检查是否可以调用对应的 method/api
-func AuthUser(ds *dbandmq.Ds, uid, method, uri string) *AuthResult {
+func AuthUser(ds *dbandmq.Ds, uid, method, uri string) (ar *AuthResult) {
+	defer func() {
+		metrics.AuthDecisions.Inc(AuthResultName(ar.Result))
+	}()
+
+	ar, items := authUserItems(ds, uid)
+	if ar.Result == AuthResultInternalError {
+		return ar
+	}
+
+	// 一个用户至少有一个角色，那就是默认用户
+	if !hasPermission(items, method, uri) {
+		ar.Result = AuthResultNoPermission
+		ar.Msg = "No permission to call this api"
+		return ar
+	}
+
+	ar.Result = AuthResultOK
+	ar.Msg = "OK"
+
+	return ar
+}
+
+// 验证用户是否拥有某个非 api 资源，比如菜单、按钮
+// 与 AuthUser 使用同样的 role/permission 聚合逻辑
+func AuthUserResource(ds *dbandmq.Ds, uid, typ, key string) *AuthResult {
+	ar, items := authUserItems(ds, uid)
+	if ar.Result == AuthResultInternalError {
+		return ar
+	}
+
+	if !hasResource(items, strings.ToUpper(typ), key) {
+		ar.Result = AuthResultNoPermission
+		ar.Msg = "No permission to access this resource"
+		return ar
+	}
+
+	ar.Result = AuthResultOK
+	ar.Msg = "OK"
+
+	return ar
+}
+
+// 只读取用户的角色信息，不检查 api 权限
+// 用于只要求登录、不要求具体权限的接口
+func LoadUser(ds *dbandmq.Ds, uid string) *AuthResult {
+	ar, _ := authUserItems(ds, uid)
+	if ar.Result == AuthResultInternalError {
+		return ar
+	}
+
+	ar.Result = AuthResultOK
+	ar.Msg = "OK"
+	return ar
+}
+
+// 读取用户拥有的指定类型的全部资源，比如前端读取当前用户的菜单列表
+func GetUserResources(ds *dbandmq.Ds, uid, typ string) ([]*Item, error) {
+	roles, err := GetUserRoles(ds, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	items := unWrapRoles(roles)
+	return filterResources(items, strings.ToUpper(typ)), nil
+}
+
+// 读取用户的 roles，并展开为 item 列表
+// 返回的 AuthResult 只填充了用户的角色信息
+func authUserItems(ds *dbandmq.Ds, uid string) (*AuthResult, []*Item) {
 	ar := &AuthResult{
 		Result: AuthResultInit,
 		Msg:    "init",
 		UserId: uid,
 	}
+
+	// 回滚快照时会短暂阻塞
+	policyLock.RLock()
 	roles, err := GetUserRoles(ds, uid)
+	policyLock.RUnlock()
 	if err != nil {
 		ar.Result = AuthResultInternalError
 		ar.Msg = "Internal error, maybe db execute failed"
-		return ar
+		return ar, nil
 	}
 
 	// 展开用户的 roles
@@ -68,16 +145,6 @@ func AuthUser(ds *dbandmq.Ds, uid, method, uri string) *AuthResult {
 	subRoles := UnWrapSubRoles(roles)
 	ar.SubRoles = subRoles
 
-	// 一个用户至少有一个角色，那就是默认用户
 	items := unWrapRoles(roles)
-	if !hasPermission(items, method, uri) {
-		ar.Result = AuthResultNoPermission
-		ar.Msg = "No permission to call this api"
-		return ar
-	}
-
-	ar.Result = AuthResultOK
-	ar.Msg = "OK"
-
-	return ar
+	return ar, items
 }
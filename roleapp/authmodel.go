@@ -1,11 +1,11 @@
 package roleapp
 
 import (
-	"errors"
 	"github.com/gin-gonic/gin"
 	jsoniter "github.com/json-iterator/go"
 	. "github.com/leyle/ginbase/consolelog"
 	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/i18n"
 	"github.com/leyle/ginbase/middleware"
 	"github.com/leyle/ginbase/util"
 	"gopkg.in/mgo.v2"
@@ -16,6 +16,7 @@ import (
 
 func init() {
 	dbandmq.AddIndexKey(IKRoleAndUser)
+	middleware.CurUserIdFunc = curUserId
 }
 
 var AuthResultCtxKey = "AUTHRESULT"
@@ -27,6 +28,21 @@ const (
 	AuthResultOK            = 9 // 验证成功
 )
 
+// 验证结果的名字，用于日志与指标
+func AuthResultName(result int) string {
+	switch result {
+	case AuthResultInit:
+		return "init"
+	case AuthResultInternalError:
+		return "internal_error"
+	case AuthResultNoPermission:
+		return "no_permission"
+	case AuthResultOK:
+		return "ok"
+	}
+	return "unknown"
+}
+
 // user and roleid
 const CollectionNameRoleAndUser = DbPrefix + "roleanduser"
 
@@ -79,6 +95,14 @@ func GetCurUser(c *gin.Context) *AuthResult {
 	return result
 }
 
+// panic 报告中的用户 id，未登录时为空
+func curUserId(c *gin.Context) string {
+	if user := GetCurUser(c); user != nil {
+		return user.UserId
+	}
+	return ""
+}
+
 // 这是一个全量检测，要求  subroleids 都在 user 的 subroles 里面
 func IdInSubRoles(user *AuthResult, subRoleIds []string) bool {
 	// 管理员 ok
@@ -207,7 +231,7 @@ func GetRoleAndUserByUserId(ds *dbandmq.Ds, uid string) (*RoleAndUser, error) {
 	}
 
 	var rau *RoleAndUser
-	err := ds.C(CollectionNameRoleAndUser).Find(f).One(&rau)
+	err := ds.TC(CollectionNameRoleAndUser).Find(f).One(&rau)
 	if err != nil && err != mgo.ErrNotFound {
 		return nil, middleware.ErrDbExec.Append(err.Error())
 	}
@@ -223,6 +247,9 @@ func hasPermission(items []*Item, method, path string) bool {
 	// 按照 method 分组 key 是 method， value 是 uri 的列表
 	infos := make(map[string][]string)
 	for _, item := range items {
+		if !item.IsApi() {
+			continue
+		}
 		ps, ok := infos[item.Method]
 		if ok {
 			ps = append(ps, item.Path)
@@ -272,6 +299,46 @@ func hasPermission(items []*Item, method, path string) bool {
 	return false
 }
 
+// 是否拥有指定类型的资源
+// key 为 * 的 item 拥有该类型的全部资源
+// method/path 都是 * 的 api item（即管理员）拥有全部资源
+func hasResource(items []*Item, typ, key string) bool {
+	for _, item := range items {
+		if item.IsApi() {
+			if item.Method == "*" && item.Path == "*" {
+				return true
+			}
+			continue
+		}
+
+		if item.Type != typ {
+			continue
+		}
+
+		if item.Key == "*" || item.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 过滤出指定类型的资源
+func filterResources(items []*Item, typ string) []*Item {
+	var ret []*Item
+	for _, item := range items {
+		if item.IsApi() {
+			if typ == ItemTypeApi {
+				ret = append(ret, item)
+			}
+			continue
+		}
+		if item.Type == typ {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
 // path 是目标路径
 // uri 是基准
 // 对比 path 是否与 uri 一致
@@ -304,20 +371,20 @@ func AddOrUpdateRoleAndRole(ds *dbandmq.Ds, uid, rid, rname string) error {
 	roleId := rid
 	if rid == "" {
 		if rname == "" {
-			return errors.New("rid 与 rname 必须至少一个有值")
+			return i18n.New(msgRidOrRname)
 		}
 		dbrole, err := GetRoleByName(ds, rname, false)
 		if err != nil {
 			return err
 		}
 		if dbrole == nil {
-			return errors.New("没有指定rname的role")
+			return i18n.New(msgRnameNotFound)
 		}
 		roleId = dbrole.Id
 	}
 
 	if roleId == "" {
-		return errors.New("缺少roleId数据")
+		return i18n.New(msgMissingRoleId)
 	}
 
 	rau, err := GetRoleAndUserByUserId(ds, uid)
@@ -333,7 +400,7 @@ func AddOrUpdateRoleAndRole(ds *dbandmq.Ds, uid, rid, rname string) error {
 			CreateT: util.GetCurTime(),
 		}
 		rau.UpdateT = rau.CreateT
-		err = ds.C(CollectionNameRoleAndUser).Insert(rau)
+		err = ds.TC(CollectionNameRoleAndUser).Insert(rau)
 		return err
 	}
 
@@ -346,7 +413,7 @@ func AddOrUpdateRoleAndRole(ds *dbandmq.Ds, uid, rid, rname string) error {
 		},
 	}
 
-	err = ds.C(CollectionNameRoleAndUser).UpdateId(rau.Id, update)
+	err = ds.TC(CollectionNameRoleAndUser).UpdateId(rau.Id, update)
 
 	return err
 }
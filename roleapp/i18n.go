@@ -0,0 +1,77 @@
+package roleapp
+
+import "github.com/leyle/ginbase/i18n"
+
+// 返回给客户端的信息
+const (
+	msgNameExists        = "roleapp.nameExists"
+	msgItemApiFields     = "roleapp.itemApiFields"
+	msgItemKeyRequired   = "roleapp.itemKeyRequired"
+	msgCannotDelete      = "roleapp.cannotDelete"
+	msgRoleNotFound      = "roleapp.roleNotFound"
+	msgRoleDeleted       = "roleapp.roleDeleted"
+	msgSubRolesInvalid   = "roleapp.subRolesInvalid"
+	msgMissingFrom       = "roleapp.missingFrom"
+	msgRoleIdOrName      = "roleapp.roleIdOrName"
+	msgRolesInvalid      = "roleapp.rolesInvalid"
+	msgAuthNotConfigured = "roleapp.authNotConfigured"
+	msgGrantForbidden    = "roleapp.grantForbidden"
+	msgNoGrantRecord     = "roleapp.noGrantRecord"
+	msgMissingType       = "roleapp.missingType"
+	msgMissingTypeOrKey  = "roleapp.missingTypeOrKey"
+	msgTemplateRoleName  = "roleapp.templateRoleName"
+	msgTemplateParams    = "roleapp.templateParams"
+	msgTemplatePNotFound = "roleapp.templatePermissionNotFound"
+	msgRidOrRname        = "roleapp.ridOrRname"
+	msgRnameNotFound     = "roleapp.rnameNotFound"
+	msgMissingRoleId     = "roleapp.missingRoleId"
+)
+
+func init() {
+	i18n.Register(i18n.LangZh, map[string]string{
+		msgNameExists:        "name已存在",
+		msgItemApiFields:     "api 类型的 item 必须有 method 和 path",
+		msgItemKeyRequired:   "非 api 类型的 item 必须有 key",
+		msgCannotDelete:      "不能删除此数据",
+		msgRoleNotFound:      "无指定id的role信息",
+		msgRoleDeleted:       "角色已被删除，要修改请先恢复此角色",
+		msgSubRolesInvalid:   "要添加的子角色全部无效",
+		msgMissingFrom:       "缺少from参数",
+		msgRoleIdOrName:      "roleId 与 roleName 必须要有一个存在",
+		msgRolesInvalid:      "传递的 role 相关数据全部不合法",
+		msgAuthNotConfigured: "服务器配置错误，未正确配置用户验证",
+		msgGrantForbidden:    "当前用户无权给用户赋予某些角色",
+		msgNoGrantRecord:     "用户无赋予权限记录",
+		msgMissingType:       "缺少type参数",
+		msgMissingTypeOrKey:  "缺少type或key参数",
+		msgTemplateRoleName:  "模板[%s]无法生成role name",
+		msgTemplateParams:    "缺少模板参数: %s",
+		msgTemplatePNotFound: "模板引用的permission[%s]不存在",
+		msgRidOrRname:        "rid 与 rname 必须至少一个有值",
+		msgRnameNotFound:     "没有指定rname的role",
+		msgMissingRoleId:     "缺少roleId数据",
+	})
+	i18n.Register(i18n.LangEn, map[string]string{
+		msgNameExists:        "name already exists",
+		msgItemApiFields:     "api item requires method and path",
+		msgItemKeyRequired:   "non-api item requires key",
+		msgCannotDelete:      "cannot delete this data",
+		msgRoleNotFound:      "no role for this id",
+		msgRoleDeleted:       "role has been deleted, restore it before modifying",
+		msgSubRolesInvalid:   "all sub roles to add are invalid",
+		msgMissingFrom:       "missing from parameter",
+		msgRoleIdOrName:      "either roleId or roleName is required",
+		msgRolesInvalid:      "all roles are invalid",
+		msgAuthNotConfigured: "server misconfigured, user authentication is not set up",
+		msgGrantForbidden:    "current user is not allowed to grant some of the roles",
+		msgNoGrantRecord:     "user has no grant record",
+		msgMissingType:       "missing type parameter",
+		msgMissingTypeOrKey:  "missing type or key parameter",
+		msgTemplateRoleName:  "template [%s] cannot generate role name",
+		msgTemplateParams:    "missing template parameters: %s",
+		msgTemplatePNotFound: "permission [%s] referenced by the template does not exist",
+		msgRidOrRname:        "either rid or rname is required",
+		msgRnameNotFound:     "no role for this rname",
+		msgMissingRoleId:     "missing roleId",
+	})
+}
@@ -0,0 +1,280 @@
+package roleapp
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// 修改 role/permission 前的影响分析
+// 对受影响的用户，分别计算修改前后的 item 列表，
+// 再使用与 AuthUser 相同的 hasPermission 判断每一个 method+path 是否有变化
+
+// 请求中带有 ?dryRun=true 时，只返回影响分析，不写数据库
+func isDryRun(c *gin.Context) bool {
+	return strings.ToUpper(c.Query("dryRun")) == "TRUE"
+}
+
+type Capability struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+type UserImpact struct {
+	UserId   string        `json:"userId"`
+	UserName string        `json:"userName"`
+	Gain     []*Capability `json:"gain"`
+	Lose     []*Capability `json:"lose"`
+}
+
+type ImpactResult struct {
+	DryRun   bool          `json:"dryRun"`
+	AllUsers bool          `json:"allUsers"` // 修改涉及默认角色，所有用户都会受影响
+	Users    []*UserImpact `json:"users"`    // 只包含有变化的用户
+}
+
+// 模拟的修改，未保存到数据库
+// role 的 Permissions，permission 的 Items 必须已填充
+type policyChange struct {
+	roles       map[string]*Role
+	permissions map[string]*Permission
+	items       map[string]*Item // 删除的 item 的 Deleted 为 true
+}
+
+// 把修改应用到用户当前的 roles 上，返回新的 roles，不修改原数据
+func (pc *policyChange) apply(roles []*Role) []*Role {
+	var ret []*Role
+	for _, role := range roles {
+		if nr, ok := pc.roles[role.Id]; ok {
+			role = nr
+		}
+		if role.Deleted {
+			continue
+		}
+
+		nr := *role
+		nr.Permissions = nil
+		for _, p := range role.Permissions {
+			if np, ok := pc.permissions[p.Id]; ok {
+				p = np
+			}
+			if p.Deleted {
+				continue
+			}
+			if len(pc.items) > 0 {
+				p = pc.applyItems(p)
+			}
+			nr.Permissions = append(nr.Permissions, p)
+		}
+		ret = append(ret, &nr)
+	}
+	return ret
+}
+
+// 替换 permission 中修改过的 item，不修改原数据
+func (pc *policyChange) applyItems(p *Permission) *Permission {
+	np := *p
+	np.Items = nil
+	for _, item := range p.Items {
+		if ni, ok := pc.items[item.Id]; ok {
+			item = ni
+		}
+		if item.Deleted {
+			continue
+		}
+		np.Items = append(np.Items, item)
+	}
+	return &np
+}
+
+// 分析修改 role 的影响，role 是修改后的数据
+func RoleChangeImpact(ds *dbandmq.Ds, role *Role) (*ImpactResult, error) {
+	nr := *role
+	ps, err := GetPermissionsByPermissionIds(ds, role.PermissionIds)
+	if err != nil {
+		return nil, err
+	}
+	nr.Permissions = ps
+
+	pc := &policyChange{
+		roles: map[string]*Role{role.Id: &nr},
+	}
+	return analyzeImpact(ds, pc, []string{role.Id})
+}
+
+// 分析修改 permission 的影响，p 是修改后的数据
+func PermissionChangeImpact(ds *dbandmq.Ds, p *Permission) (*ImpactResult, error) {
+	np := *p
+	items, err := GetItemsByItemIds(ds, p.ItemIds)
+	if err != nil {
+		return nil, err
+	}
+	np.Items = items
+
+	roles, err := getRolesByPermissionId(ds, p.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var roleIds []string
+	for _, role := range roles {
+		roleIds = append(roleIds, role.Id)
+	}
+
+	pc := &policyChange{
+		permissions: map[string]*Permission{p.Id: &np},
+	}
+	return analyzeImpact(ds, pc, roleIds)
+}
+
+// 分析修改或删除 item 的影响，item 是修改后的数据，删除时 Deleted 为 true
+func ItemChangeImpact(ds *dbandmq.Ds, item *Item) (*ImpactResult, error) {
+	f := bson.M{
+		"itemIds": item.Id,
+		"deleted": false,
+	}
+	var ps []*Permission
+	err := ds.TC(CollectionNamePermission).Find(f).All(&ps)
+	if err != nil {
+		Logger.Errorf("", "根据itemId[%s]读取permission列表失败, %s", item.Id, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+
+	var roleIds []string
+	for _, p := range ps {
+		roles, err := getRolesByPermissionId(ds, p.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range roles {
+			roleIds = append(roleIds, role.Id)
+		}
+	}
+	if len(roleIds) > 1 {
+		roleIds = util.UniqueStringArray(roleIds)
+	}
+
+	pc := &policyChange{
+		items: map[string]*Item{item.Id: item},
+	}
+	return analyzeImpact(ds, pc, roleIds)
+}
+
+func getRolesByPermissionId(ds *dbandmq.Ds, pid string) ([]*Role, error) {
+	f := bson.M{
+		"permissionIds": pid,
+		"deleted":       false,
+	}
+
+	var roles []*Role
+	err := ds.TC(CollectionNameRole).Find(f).All(&roles)
+	if err != nil {
+		Logger.Errorf("", "根据permissionId[%s]读取role列表失败, %s", pid, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return roles, nil
+}
+
+func analyzeImpact(ds *dbandmq.Ds, pc *policyChange, roleIds []string) (*ImpactResult, error) {
+	ret := &ImpactResult{
+		DryRun: true,
+	}
+	if len(roleIds) == 0 {
+		return ret, nil
+	}
+
+	f := bson.M{
+		"roleIds": bson.M{"$in": roleIds},
+	}
+	for _, rid := range roleIds {
+		if rid == DefaultRoleId {
+			// 默认角色属于所有用户
+			ret.AllUsers = true
+			f = bson.M{}
+			break
+		}
+	}
+
+	var raus []*RoleAndUser
+	err := ds.TC(CollectionNameRoleAndUser).Find(f).All(&raus)
+	if err != nil {
+		Logger.Errorf("", "影响分析时读取用户列表失败, %s", err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+
+	// 没有 rau 记录的用户只拥有默认角色，用 * 表示
+	if ret.AllUsers {
+		raus = append(raus, &RoleAndUser{UserId: "*"})
+	}
+
+	for _, rau := range raus {
+		var before []*Role
+		if rau.UserId == "*" {
+			before, err = GetRolesByRoleIds(ds, []string{DefaultRoleId}, true)
+		} else {
+			before, err = GetUserRoles(ds, rau.UserId)
+		}
+		if err != nil {
+			return nil, err
+		}
+		after := pc.apply(before)
+
+		ui := diffCapabilities(unWrapRoles(before), unWrapRoles(after))
+		if len(ui.Gain) == 0 && len(ui.Lose) == 0 {
+			continue
+		}
+		ui.UserId = rau.UserId
+		ui.UserName = rau.UserName
+		ret.Users = append(ret.Users, ui)
+	}
+
+	return ret, nil
+}
+
+// 对比前后两组 item 的 api 能力变化
+func diffCapabilities(before, after []*Item) *UserImpact {
+	key := func(item *Item) string {
+		return item.Method + " " + item.Path
+	}
+
+	candidates := make(map[string]*Capability)
+	beforeKeys := make(map[string]bool)
+	for _, item := range before {
+		if item.IsApi() {
+			beforeKeys[key(item)] = true
+		}
+	}
+	afterKeys := make(map[string]bool)
+	for _, item := range after {
+		if item.IsApi() {
+			afterKeys[key(item)] = true
+			if !beforeKeys[key(item)] {
+				candidates[key(item)] = &Capability{Method: item.Method, Path: item.Path}
+			}
+		}
+	}
+	for _, item := range before {
+		if item.IsApi() && !afterKeys[key(item)] {
+			candidates[key(item)] = &Capability{Method: item.Method, Path: item.Path}
+		}
+	}
+
+	ui := &UserImpact{}
+	for _, cp := range candidates {
+		// 数据库中的 path 可能带有 * 通配符，替换为一个具体值再判断
+		path := strings.ReplaceAll(cp.Path, "*", "0")
+		b := hasPermission(before, cp.Method, path)
+		a := hasPermission(after, cp.Method, path)
+		if !b && a {
+			ui.Gain = append(ui.Gain, cp)
+		} else if b && !a {
+			ui.Lose = append(ui.Lose, cp)
+		}
+	}
+
+	return ui
+}
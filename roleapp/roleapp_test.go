@@ -67,3 +67,128 @@ func auth(c *gin.Context, db *dbandmq.Ds) {
 func TestInsureroleitem(t *testing.T) {
 	insureRoleAppItems(nil, "/api")
 }
+
+func TestHasResource(t *testing.T) {
+	items := []*Item{
+		{Method: "GET", Path: "/api/hello"},
+		{Type: ItemTypeMenu, Key: "report"},
+		{Type: ItemTypeButton, Key: "*"},
+	}
+
+	if !hasResource(items, ItemTypeMenu, "report") {
+		t.Error("should have menu report")
+	}
+	if hasResource(items, ItemTypeMenu, "user") {
+		t.Error("should not have menu user")
+	}
+	if !hasResource(items, ItemTypeButton, "delete") {
+		t.Error("should have all buttons")
+	}
+	if hasPermission(items[1:], "GET", "report") {
+		t.Error("resource item should not grant api permission")
+	}
+	if !hasResource([]*Item{{Method: "*", Path: "*"}}, ItemTypeData, "any") {
+		t.Error("admin item should have all resources")
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	tpl := &RoleTemplate{
+		Params:   []string{"tenant"},
+		RoleName: "{tenant}:editor",
+	}
+
+	if err := tpl.checkParams(map[string]string{}); err == nil {
+		t.Error("missing params should fail")
+	}
+
+	name := renderTemplateStr(tpl.RoleName, map[string]string{"tenant": "acme"})
+	if name != "acme:editor" {
+		t.Error("unexpected role name", name)
+	}
+}
+
+func TestDiffCapabilities(t *testing.T) {
+	before := []*Item{
+		{Method: "GET", Path: "/api/user/*"},
+		{Method: "DELETE", Path: "/api/user/*"},
+	}
+	after := []*Item{
+		{Method: "*", Path: "/api/user/*"},
+		{Method: "POST", Path: "/api/user/*"},
+	}
+
+	ui := diffCapabilities(before, after)
+	if len(ui.Lose) != 0 {
+		t.Error("wildcard method should cover old items", ui.Lose)
+	}
+	if len(ui.Gain) != 2 {
+		t.Error("unexpected gain", ui.Gain)
+	}
+
+	ui = diffCapabilities(after, before[:1])
+	if len(ui.Lose) != 2 {
+		t.Error("unexpected lose", ui.Lose)
+	}
+}
+
+func TestApplyItemChange(t *testing.T) {
+	items := []*Item{
+		{Id: "i1", Method: "GET", Path: "/api/user/*"},
+		{Id: "i2", Method: "DELETE", Path: "/api/user/*"},
+	}
+	roles := []*Role{
+		{Id: "r1", Permissions: []*Permission{{Id: "p1", Items: items}}},
+	}
+
+	pc := &policyChange{
+		items: map[string]*Item{
+			"i1": {Id: "i1", Method: "POST", Path: "/api/user/*"},
+			"i2": {Id: "i2", Deleted: true},
+		},
+	}
+	after := pc.apply(roles)
+	ps := after[0].Permissions
+	if len(ps) != 1 || len(ps[0].Items) != 1 || ps[0].Items[0].Method != "POST" {
+		t.Error("unexpected items after apply", ps)
+	}
+	if roles[0].Permissions[0].Items[0].Method != "GET" {
+		t.Error("apply should not modify original permission")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	from := &Snapshot{
+		Id:    "a",
+		Items: []*Item{{Id: "1", Name: "i1", Method: "GET"}, {Id: "2", Name: "i2"}},
+	}
+	to := &Snapshot{
+		Id:    "b",
+		Items: []*Item{{Id: "1", Name: "i1", Method: "POST"}, {Id: "3", Name: "i3"}},
+	}
+
+	diff := DiffSnapshots(from, to)
+	if len(diff.Items.Added) != 1 || len(diff.Items.Removed) != 1 || len(diff.Items.Changed) != 1 {
+		t.Error("unexpected diff", diff.Items)
+	}
+}
+
+func TestSnapshotChunks(t *testing.T) {
+	old := SnapshotChunkSize
+	SnapshotChunkSize = 2
+	defer func() { SnapshotChunkSize = old }()
+
+	s := &Snapshot{
+		Id:    "a",
+		Items: []*Item{{Id: "1"}, {Id: "2"}, {Id: "3"}},
+		Roles: []*Role{{Id: "r1"}},
+	}
+	chunks := s.chunks()
+	if len(chunks) != 3 {
+		t.Fatal("unexpected chunk count", len(chunks))
+	}
+	last := chunks[2].(*snapshotChunk)
+	if last.SnapshotId != "a" || last.Seq != 2 || len(last.Roles) != 1 || len(chunks[1].(*snapshotChunk).Items) != 1 {
+		t.Error("unexpected chunk", last)
+	}
+}
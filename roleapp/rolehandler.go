@@ -3,6 +3,7 @@ package roleapp
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/i18n"
 	"github.com/leyle/ginbase/middleware"
 	"github.com/leyle/ginbase/returnfun"
 	"github.com/leyle/ginbase/util"
@@ -12,11 +13,35 @@ import (
 
 // item manage handlers
 // 新建 item
+// type 为空或者 API 时，method path 必填，否则 key 必填
 type CreateItemForm struct {
-	Name   string `json:"name" binding:"required"`
-	Method string `json:"method" binding:"required"`
-	Path   string `json:"path" binding:"required"`
-	Group  string `json:"group" binding:"required"` // 属于哪个分组
+	Name   string                 `json:"name" binding:"required"`
+	Type   string                 `json:"type"`
+	Method string                 `json:"method" binding:"omitempty,httpmethod"`
+	Path   string                 `json:"path" binding:"omitempty,rolepath"`
+	Key    string                 `json:"key"`
+	Meta   map[string]interface{} `json:"meta"`
+	Group  string                 `json:"group" binding:"required"` // 属于哪个分组
+}
+
+// 检查 item 的类型与对应的必填字段，返回规范化后的 type
+func checkItemType(typ, method, path, key string) (string, error) {
+	typ = strings.ToUpper(strings.TrimSpace(typ))
+	if typ == "" {
+		typ = ItemTypeApi
+	}
+
+	if typ == ItemTypeApi {
+		if method == "" || path == "" {
+			return "", i18n.New(msgItemApiFields)
+		}
+		return typ, nil
+	}
+
+	if key == "" {
+		return "", i18n.New(msgItemKeyRequired)
+	}
+	return typ, nil
 }
 
 func CreateItemHandler(c *gin.Context, db *dbandmq.Ds) {
@@ -25,7 +50,7 @@ func CreateItemHandler(c *gin.Context, db *dbandmq.Ds) {
 	err = c.BindJSON(&form)
 	middleware.StopExec(err)
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	name := strings.TrimSpace(form.Name)
@@ -34,7 +59,13 @@ func CreateItemHandler(c *gin.Context, db *dbandmq.Ds) {
 	middleware.StopExec(err)
 
 	if dbitem != nil {
-		returnfun.ReturnErrJson(c, "name已存在")
+		returnfun.ReturnErrKeyJson(c, msgNameExists)
+		return
+	}
+
+	typ, err := checkItemType(form.Type, form.Method, form.Path, form.Key)
+	if err != nil {
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
 		return
 	}
 
@@ -48,13 +79,16 @@ func CreateItemHandler(c *gin.Context, db *dbandmq.Ds) {
 		Method:  strings.ToUpper(form.Method),
 		Path:    form.Path,
 		Group:   form.Group,
+		Type:    typ,
+		Key:     form.Key,
+		Meta:    form.Meta,
 		Deleted: false,
 		Source:  RoleDataSourceApi,
 		CreateT: util.GetCurTime(),
 	}
 	item.UpdateT = item.CreateT
 
-	err = ds.C(CollectionNameItem).Insert(item)
+	err = ds.TC(CollectionNameItem).Insert(item)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -65,10 +99,13 @@ func CreateItemHandler(c *gin.Context, db *dbandmq.Ds) {
 
 // 修改 item
 type UpdateItemForm struct {
-	Name   string `json:"name" binding:"required"`
-	Method string `json:"method" binding:"required"`
-	Path   string `json:"path" binding:"required"`
-	Group  string `json:"group" binding:"required"` // 属于哪个分组
+	Name   string                 `json:"name" binding:"required"`
+	Type   string                 `json:"type"`
+	Method string                 `json:"method" binding:"omitempty,httpmethod"`
+	Path   string                 `json:"path" binding:"omitempty,rolepath"`
+	Key    string                 `json:"key"`
+	Meta   map[string]interface{} `json:"meta"`
+	Group  string                 `json:"group" binding:"required"` // 属于哪个分组
 }
 
 func UpdateItemHandler(c *gin.Context, db *dbandmq.Ds) {
@@ -79,7 +116,7 @@ func UpdateItemHandler(c *gin.Context, db *dbandmq.Ds) {
 
 	id := c.Param("id")
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	dbitem, err := GetItemById(ds, id)
@@ -89,23 +126,39 @@ func UpdateItemHandler(c *gin.Context, db *dbandmq.Ds) {
 		middleware.StopExec(middleware.ErrNoIdData.Append(id))
 	}
 
+	typ, err := checkItemType(form.Type, form.Method, form.Path, form.Key)
+	if err != nil {
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
+		return
+	}
+
 	if strings.Contains(form.Path, ":id") {
 		form.Path = strings.ReplaceAll(form.Path, ":id", "*")
 	}
 
 	dbitem.Name = form.Name
-	dbitem.Method = form.Method
+	dbitem.Method = strings.ToUpper(form.Method)
 	dbitem.Path = form.Path
 	dbitem.Group = form.Group
+	dbitem.Type = typ
+	dbitem.Key = form.Key
+	dbitem.Meta = form.Meta
 	dbitem.Deleted = false
 	dbitem.UpdateT = util.GetCurTime()
 
+	if isDryRun(c) {
+		ret, err := ItemChangeImpact(ds, dbitem)
+		middleware.StopExec(err)
+		returnfun.ReturnOKJson(c, ret)
+		return
+	}
+
 	filter := bson.M{
 		"_id":    id,
 		"source": RoleDataSourceApi,
 	}
 
-	err = ds.C(CollectionNameItem).Update(filter, dbitem)
+	err = ds.TC(CollectionNameItem).Update(filter, dbitem)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -117,9 +170,22 @@ func UpdateItemHandler(c *gin.Context, db *dbandmq.Ds) {
 // 删除 item
 func DeleteItemHandler(c *gin.Context, db *dbandmq.Ds) {
 	id := c.Param("id")
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
+	if isDryRun(c) {
+		dbitem, err := GetItemById(ds, id)
+		middleware.StopExec(err)
+		if dbitem == nil {
+			middleware.StopExec(middleware.ErrNoIdData.Append(id))
+		}
+		dbitem.Deleted = true
+		ret, err := ItemChangeImpact(ds, dbitem)
+		middleware.StopExec(err)
+		returnfun.ReturnOKJson(c, ret)
+		return
+	}
+
 	filter := bson.M{
 		"_id":    id,
 		"source": RoleDataSourceApi,
@@ -132,7 +198,7 @@ func DeleteItemHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	err := ds.C(CollectionNameItem).Update(filter, update)
+	err := ds.TC(CollectionNameItem).Update(filter, update)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -143,7 +209,7 @@ func DeleteItemHandler(c *gin.Context, db *dbandmq.Ds) {
 // 根据 id 读取 item 信息
 func GetItemInfoHandler(c *gin.Context, db *dbandmq.Ds) {
 	id := c.Param("id")
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	item, err := GetItemById(ds, id)
@@ -179,6 +245,22 @@ func QueryItemHandler(c *gin.Context, db *dbandmq.Ds) {
 		andCondition = append(andCondition, bson.M{"group": group})
 	}
 
+	// 旧数据没有 type 字段，视为 api
+	typ := c.Query("type")
+	if typ != "" {
+		typ = strings.ToUpper(typ)
+		if typ == ItemTypeApi {
+			andCondition = append(andCondition, bson.M{"type": bson.M{"$in": []interface{}{ItemTypeApi, "", nil}}})
+		} else {
+			andCondition = append(andCondition, bson.M{"type": typ})
+		}
+	}
+
+	key := c.Query("key")
+	if key != "" {
+		andCondition = append(andCondition, bson.M{"key": bson.M{"$regex": key}})
+	}
+
 	deleted := c.Query("deleted")
 	if deleted != "" {
 		deleted = strings.ToUpper(deleted)
@@ -196,10 +278,10 @@ func QueryItemHandler(c *gin.Context, db *dbandmq.Ds) {
 		}
 	}
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
-	Q := ds.C(CollectionNameItem).Find(query)
+	Q := ds.TC(CollectionNameItem).Find(query)
 	total, err := Q.Count()
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
@@ -236,7 +318,7 @@ func CreatePermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 	middleware.StopExec(err)
 
 	// 检查名字是否存在，不加锁
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	name := strings.TrimSpace(form.Name)
@@ -244,7 +326,7 @@ func CreatePermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 	middleware.StopExec(err)
 
 	if dbp != nil {
-		returnfun.ReturnErrJson(c, "name已存在")
+		returnfun.ReturnErrKeyJson(c, msgNameExists)
 		return
 	}
 
@@ -258,7 +340,7 @@ func CreatePermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 	}
 	permission.UpdateT = permission.CreateT
 
-	err = ds.C(CollectionNamePermission).Insert(permission)
+	err = ds.TC(CollectionNamePermission).Insert(permission)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -269,7 +351,7 @@ func CreatePermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 
 // 给 permission 添加 items
 type AddItemsToPermissionForm struct {
-	ItemIds []string `json:"itemIds" binding:"required"`
+	ItemIds []string `json:"itemIds" binding:"required,dive,objectid"`
 }
 
 func AddItemsToPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
@@ -279,7 +361,7 @@ func AddItemsToPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 
 	id := c.Param("id")
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	dbp, err := GetPermissionById(ds, id, false)
@@ -293,7 +375,14 @@ func AddItemsToPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 	dbp.ItemIds = util.UniqueStringArray(dbp.ItemIds)
 	dbp.UpdateT = util.GetCurTime()
 
-	err = ds.C(CollectionNamePermission).UpdateId(dbp.Id, dbp)
+	if isDryRun(c) {
+		ret, err := PermissionChangeImpact(ds, dbp)
+		middleware.StopExec(err)
+		returnfun.ReturnOKJson(c, ret)
+		return
+	}
+
+	err = ds.TC(CollectionNamePermission).UpdateId(dbp.Id, dbp)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -304,7 +393,7 @@ func AddItemsToPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 
 // 把 items 从 permission 中移除
 type RemoveItemFromPermissionForm struct {
-	ItemIds []string `json:"itemIds" binding:"required"`
+	ItemIds []string `json:"itemIds" binding:"required,dive,objectid"`
 }
 
 func RemoveItemsFromPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
@@ -314,7 +403,7 @@ func RemoveItemsFromPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 
 	id := c.Param("id")
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	dbp, err := GetPermissionById(ds, id, false)
@@ -341,7 +430,14 @@ func RemoveItemsFromPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 	dbp.ItemIds = remainIds
 	dbp.UpdateT = util.GetCurTime()
 
-	err = ds.C(CollectionNamePermission).UpdateId(dbp.Id, dbp)
+	if isDryRun(c) {
+		ret, err := PermissionChangeImpact(ds, dbp)
+		middleware.StopExec(err)
+		returnfun.ReturnOKJson(c, ret)
+		return
+	}
+
+	err = ds.TC(CollectionNamePermission).UpdateId(dbp.Id, dbp)
 	middleware.StopExec(err)
 
 	returnfun.ReturnOKJson(c, dbp)
@@ -361,7 +457,7 @@ func UpdatePermissionInfoHandler(c *gin.Context, db *dbandmq.Ds) {
 	id := c.Param("id")
 	name := strings.TrimSpace(form.Name)
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	update := bson.M{
@@ -372,7 +468,7 @@ func UpdatePermissionInfoHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	err = ds.C(CollectionNamePermission).UpdateId(id, update)
+	err = ds.TC(CollectionNamePermission).UpdateId(id, update)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -383,9 +479,25 @@ func UpdatePermissionInfoHandler(c *gin.Context, db *dbandmq.Ds) {
 // 删除 permission
 func DeletePermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 	id := c.Param("id")
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
+	if isDryRun(c) {
+		dbp, err := GetPermissionById(ds, id, false)
+		middleware.StopExec(err)
+		if dbp == nil {
+			middleware.StopExec(middleware.ErrNoIdData.Append(id))
+		}
+		// 只有用户添加的数据才能删除
+		if dbp.Source == RoleDataSourceApi {
+			dbp.Deleted = true
+		}
+		ret, err := PermissionChangeImpact(ds, dbp)
+		middleware.StopExec(err)
+		returnfun.ReturnOKJson(c, ret)
+		return
+	}
+
 	filter := bson.M{
 		"_id":    id,
 		"source": RoleDataSourceApi,
@@ -398,7 +510,7 @@ func DeletePermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	err := ds.C(CollectionNamePermission).Update(filter, update)
+	err := ds.TC(CollectionNamePermission).Update(filter, update)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -409,7 +521,7 @@ func DeletePermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 // 读取 permission 信息，包含 items
 func GetPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 	id := c.Param("id")
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	p, err := GetPermissionById(ds, id, true)
@@ -448,10 +560,10 @@ func QueryPermissionHandler(c *gin.Context, db *dbandmq.Ds) {
 		}
 	}
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
-	Q := ds.C(CollectionNamePermission).Find(query)
+	Q := ds.TC(CollectionNamePermission).Find(query)
 	total, err := Q.Count()
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
@@ -487,7 +599,7 @@ func CreateRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 	err := c.BindJSON(&form)
 	middleware.StopExec(err)
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	name := strings.TrimSpace(form.Name)
@@ -495,7 +607,7 @@ func CreateRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 	middleware.StopExec(err)
 
 	if dbrole != nil {
-		returnfun.ReturnErrJson(c, "name已存在")
+		returnfun.ReturnErrKeyJson(c, msgNameExists)
 		return
 	}
 
@@ -510,7 +622,58 @@ func CreateRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 	}
 	role.UpdateT = role.CreateT
 
-	err = ds.C(CollectionNameRole).Insert(role)
+	err = ds.TC(CollectionNameRole).Insert(role)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	returnfun.ReturnOKJson(c, role)
+	return
+}
+
+// 复制 role，包括其 permission 和 subrole，使用新的名字
+// 复制出来的 role 不再关联模板
+type CloneRoleForm struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func CloneRoleHandler(c *gin.Context, db *dbandmq.Ds) {
+	var form CloneRoleForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	id := c.Param("id")
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	srcRole, err := GetRoleById(ds, id, false)
+	middleware.StopExec(err)
+	if srcRole == nil || srcRole.Deleted {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	name := strings.TrimSpace(form.Name)
+	dbrole, err := GetRoleByName(ds, name, false)
+	middleware.StopExec(err)
+
+	if dbrole != nil {
+		returnfun.ReturnErrKeyJson(c, msgNameExists)
+		return
+	}
+
+	role := &Role{
+		Id:            util.GenerateDataId(),
+		Name:          name,
+		PermissionIds: srcRole.PermissionIds,
+		SubRoles:      srcRole.SubRoles,
+		Deleted:       false,
+		Source:        RoleDataSourceApi,
+		CreateT:       util.GetCurTime(),
+	}
+	role.UpdateT = role.CreateT
+
+	err = ds.TC(CollectionNameRole).Insert(role)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -521,7 +684,7 @@ func CreateRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 
 // 给 role 添加 permission
 type AddPToRoleForm struct {
-	Pids []string `json:"pids" binding:"required"`
+	Pids []string `json:"pids" binding:"required,dive,objectid"`
 }
 
 func AddPermissionsToRoleHandler(c *gin.Context, db *dbandmq.Ds) {
@@ -531,7 +694,7 @@ func AddPermissionsToRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 
 	id := c.Param("id")
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	dbrole, err := GetRoleById(ds, id, false)
@@ -546,7 +709,14 @@ func AddPermissionsToRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 	dbrole.PermissionIds = util.UniqueStringArray(dbrole.PermissionIds)
 	dbrole.UpdateT = util.GetCurTime()
 
-	err = ds.C(CollectionNameRole).UpdateId(id, dbrole)
+	if isDryRun(c) {
+		ret, err := RoleChangeImpact(ds, dbrole)
+		middleware.StopExec(err)
+		returnfun.ReturnOKJson(c, ret)
+		return
+	}
+
+	err = ds.TC(CollectionNameRole).UpdateId(id, dbrole)
 	middleware.StopExec(err)
 	returnfun.ReturnOKJson(c, dbrole)
 	return
@@ -554,7 +724,7 @@ func AddPermissionsToRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 
 // 从 role 中移除 permission
 type RemovePFromRoleForm struct {
-	Pids []string `json:"pids" binding:"required"`
+	Pids []string `json:"pids" binding:"required,dive,objectid"`
 }
 
 func RemovePermissionsFromRoleHandler(c *gin.Context, db *dbandmq.Ds) {
@@ -564,7 +734,7 @@ func RemovePermissionsFromRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 
 	id := c.Param("id")
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	dbrole, err := GetRoleById(ds, id, false)
@@ -593,7 +763,14 @@ func RemovePermissionsFromRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 	dbrole.PermissionIds = remainPids
 	dbrole.UpdateT = util.GetCurTime()
 
-	err = ds.C(CollectionNameRole).UpdateId(id, dbrole)
+	if isDryRun(c) {
+		ret, err := RoleChangeImpact(ds, dbrole)
+		middleware.StopExec(err)
+		returnfun.ReturnOKJson(c, ret)
+		return
+	}
+
+	err = ds.TC(CollectionNameRole).UpdateId(id, dbrole)
 	middleware.StopExec(err)
 	returnfun.ReturnOKJson(c, dbrole)
 	return
@@ -612,7 +789,7 @@ func UpdateRoleInfoHandler(c *gin.Context, db *dbandmq.Ds) {
 	id := c.Param("id")
 	name := strings.TrimSpace(form.Name)
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	update := bson.M{
@@ -623,7 +800,7 @@ func UpdateRoleInfoHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	err = ds.C(CollectionNameRole).UpdateId(id, update)
+	err = ds.TC(CollectionNameRole).UpdateId(id, update)
 	middleware.StopExec(err)
 
 	returnfun.ReturnOKJson(c, "")
@@ -635,7 +812,7 @@ func DeleteRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 	id := c.Param("id")
 
 	if id == DefaultRoleId {
-		returnfun.Return403Json(c, "cannot delete this data")
+		returnfun.Return403KeyJson(c, msgCannotDelete)
 		return
 	}
 
@@ -651,10 +828,26 @@ func DeleteRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
-	err := ds.C(CollectionNameRole).Update(filter, update)
+	if isDryRun(c) {
+		dbrole, err := GetRoleById(ds, id, false)
+		middleware.StopExec(err)
+		if dbrole == nil {
+			middleware.StopExec(middleware.ErrNoIdData.Append(id))
+		}
+		// 只有用户添加的数据才能删除
+		if dbrole.Source == RoleDataSourceApi {
+			dbrole.Deleted = true
+		}
+		ret, err := RoleChangeImpact(ds, dbrole)
+		middleware.StopExec(err)
+		returnfun.ReturnOKJson(c, ret)
+		return
+	}
+
+	err := ds.TC(CollectionNameRole).Update(filter, update)
 	middleware.StopExec(err)
 	returnfun.ReturnOKJson(c, "")
 	return
@@ -671,17 +864,17 @@ func AddSubRolesToRoleHandler(c *gin.Context, ds *dbandmq.Ds) {
 	middleware.StopExec(err)
 
 	roleId := c.Param("id")
-	db := ds.CopyDs()
+	db := ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	dbRole, err := GetRoleById(db, roleId, false)
 	middleware.StopExec(err)
 	if dbRole == nil {
-		returnfun.ReturnErrJson(c, "无指定id的role信息")
+		returnfun.ReturnErrKeyJson(c, msgRoleNotFound)
 		return
 	}
 	if dbRole.Deleted {
-		returnfun.ReturnErrJson(c, "角色已被删除，要修改请先恢复此角色")
+		returnfun.ReturnErrKeyJson(c, msgRoleDeleted)
 		return
 	}
 
@@ -714,7 +907,7 @@ func AddSubRolesToRoleHandler(c *gin.Context, ds *dbandmq.Ds) {
 	}
 
 	if len(validRoles) == 0 {
-		returnfun.ReturnErrJson(c, "要添加的子角色全部无效")
+		returnfun.ReturnErrKeyJson(c, msgSubRolesInvalid)
 		return
 	}
 
@@ -741,7 +934,7 @@ func AddSubRolesToRoleHandler(c *gin.Context, ds *dbandmq.Ds) {
 		},
 	}
 
-	err = db.C(CollectionNameRole).UpdateId(dbRole.Id, update)
+	err = db.TC(CollectionNameRole).UpdateId(dbRole.Id, update)
 	middleware.StopExec(err)
 
 	retData := gin.H{
@@ -760,17 +953,17 @@ func DelSubRolesFromRoleHandler(c *gin.Context, ds *dbandmq.Ds) {
 	middleware.StopExec(err)
 
 	roleId := c.Param("id")
-	db := ds.CopyDs()
+	db := ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	dbRole, err := GetRoleById(db, roleId, false)
 	middleware.StopExec(err)
 	if dbRole == nil {
-		returnfun.ReturnErrJson(c, "无指定id的role信息")
+		returnfun.ReturnErrKeyJson(c, msgRoleNotFound)
 		return
 	}
 	if dbRole.Deleted {
-		returnfun.ReturnErrJson(c, "角色已被删除，要修改请先恢复此角色")
+		returnfun.ReturnErrKeyJson(c, msgRoleDeleted)
 		return
 	}
 
@@ -804,7 +997,7 @@ func DelSubRolesFromRoleHandler(c *gin.Context, ds *dbandmq.Ds) {
 		},
 	}
 
-	err = db.C(CollectionNameRole).UpdateId(dbRole.Id, update)
+	err = db.TC(CollectionNameRole).UpdateId(dbRole.Id, update)
 	middleware.StopExec(err)
 
 	returnfun.ReturnOKJson(c, "")
@@ -814,7 +1007,7 @@ func DelSubRolesFromRoleHandler(c *gin.Context, ds *dbandmq.Ds) {
 // 查看 role 明细
 func GetRoleInfoHandler(c *gin.Context, ds *dbandmq.Ds) {
 	id := c.Param("id")
-	db := ds.CopyDs()
+	db := ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
 	role, err := GetRoleById(db, id, true)
@@ -836,6 +1029,12 @@ func QueryRoleHandler(c *gin.Context, ds *dbandmq.Ds) {
 		andCondition = append(andCondition, bson.M{"name": bson.M{"$regex": name}})
 	}
 
+	// 某个模板的实例
+	templateId := c.Query("templateId")
+	if templateId != "" {
+		andCondition = append(andCondition, bson.M{"templateId": templateId})
+	}
+
 	deleted := c.Query("deleted")
 	if deleted != "" {
 		deleted = strings.ToUpper(deleted)
@@ -853,10 +1052,10 @@ func QueryRoleHandler(c *gin.Context, ds *dbandmq.Ds) {
 		}
 	}
 
-	db := ds.CopyDs()
+	db := ds.CopyDs().WithContext(c.Request.Context())
 	defer db.Close()
 
-	Q := db.C(CollectionNameRole).Find(query)
+	Q := db.TC(CollectionNameRole).Find(query)
 	total, err := Q.Count()
 	middleware.StopExec(err)
 
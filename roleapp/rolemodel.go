@@ -76,10 +76,19 @@ const CollectionNameItem = DbPrefix + "item"
 
 var IKItem = &dbandmq.IndexKey{
 	Collection: CollectionNameItem,
-	SingleKey:  []string{"method", "path", "group", "source", "deleted"},
+	SingleKey:  []string{"method", "path", "group", "type", "key", "source", "deleted"},
 	UniqueKey:  []string{"name"},
 }
 
+// item 的资源类型，api 之外的类型主要给前端 ui 使用
+// 除了下面这些，也可以自定义其他类型
+const (
+	ItemTypeApi    = "API"
+	ItemTypeMenu   = "MENU"   // 菜单
+	ItemTypeButton = "BUTTON" // 按钮
+	ItemTypeData   = "DATA"   // 数据范围，比如报表
+)
+
 type Item struct {
 	Id   string `json:"id" bson:"_id"`
 	Name string `json:"name" bson:"name"` // 名字要求唯一，目的是避免在系统内造成脏数据
@@ -89,6 +98,12 @@ type Item struct {
 	Path   string `json:"path" bson:"path"`
 	Group  string `json:"group" bson:"group"` // 分组名字，属于哪一个功能模块
 
+	// 资源类型，旧数据无此值，视为 api
+	// 非 api 类型使用 key 标记资源，meta 存储任意附加信息，比如菜单的图标、排序
+	Type string                 `json:"type" bson:"type"`
+	Key  string                 `json:"key" bson:"key"`
+	Meta map[string]interface{} `json:"meta,omitempty" bson:"meta,omitempty"`
+
 	Deleted bool `json:"deleted" bson:"deleted"`
 
 	Source  string        `json:"source" bson:"source"`
@@ -96,6 +111,10 @@ type Item struct {
 	UpdateT *util.CurTime `json:"-" bson:"updateT"`
 }
 
+func (i *Item) IsApi() bool {
+	return i.Type == "" || i.Type == ItemTypeApi
+}
+
 // permission
 const CollectionNamePermission = DbPrefix + "permission"
 
@@ -124,7 +143,7 @@ const CollectionNameRole = DbPrefix + "role"
 
 var IKRole = &dbandmq.IndexKey{
 	Collection: CollectionNameRole,
-	SingleKey:  []string{"permissionIds", "deleted", "source"},
+	SingleKey:  []string{"permissionIds", "templateId", "deleted", "source"},
 	UniqueKey:  []string{"name"},
 }
 
@@ -138,6 +157,11 @@ type Role struct {
 	// 包含的下属 role 列表，当前 role 所属用户可以给自己的下属用户赋予的权限
 	SubRoles []*SubRole `json:"subRoles" bson:"subRoles"`
 
+	// 从模板实例化的 role 记录模板信息，模板更新时可以据此同步
+	TemplateId      string            `json:"templateId,omitempty" bson:"templateId,omitempty"`
+	TemplateVersion int               `json:"templateVersion,omitempty" bson:"templateVersion,omitempty"`
+	TemplateParams  map[string]string `json:"templateParams,omitempty" bson:"templateParams,omitempty"`
+
 	Deleted bool `json:"deleted" bson:"deleted"`
 
 	Source  string        `json:"source" bson:"source"`
@@ -154,7 +178,7 @@ type SubRole struct {
 // 根据 id 读取 item
 func GetItemById(ds *dbandmq.Ds, id string) (*Item, error) {
 	var item *Item
-	err := ds.C(CollectionNameItem).FindId(id).One(&item)
+	err := ds.TC(CollectionNameItem).FindId(id).One(&item)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "根据id[%s]读取 item 信息失败, %s", id, err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
@@ -169,7 +193,7 @@ func GetItemByName(ds *dbandmq.Ds, name string) (*Item, error) {
 	}
 
 	var item *Item
-	err := ds.C(CollectionNameItem).Find(f).One(&item)
+	err := ds.TC(CollectionNameItem).Find(f).One(&item)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "根据name[%s]读取 role item 失败, %s", name, err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
@@ -192,7 +216,7 @@ func GetItemsByItemIds(db *dbandmq.Ds, itemIds []string) ([]*Item, error) {
 	}
 
 	var items []*Item
-	err := db.C(CollectionNameItem).Find(f).All(&items)
+	err := db.TC(CollectionNameItem).Find(f).All(&items)
 	if err != nil {
 		Logger.Errorf("", "根据itemIds读取item信息失败, %s", err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
@@ -208,7 +232,7 @@ func GetPermissionByName(db *dbandmq.Ds, name string, more bool) (*Permission, e
 	}
 
 	var p *Permission
-	err := db.C(CollectionNamePermission).Find(f).One(&p)
+	err := db.TC(CollectionNamePermission).Find(f).One(&p)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "根据permission name[%s]读取permission信息失败, %s", name, err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
@@ -230,7 +254,7 @@ func GetPermissionByName(db *dbandmq.Ds, name string, more bool) (*Permission, e
 
 func GetPermissionById(db *dbandmq.Ds, id string, more bool) (*Permission, error) {
 	var p *Permission
-	err := db.C(CollectionNamePermission).FindId(id).One(&p)
+	err := db.TC(CollectionNamePermission).FindId(id).One(&p)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "根据 permission id[%s]读取permission信息失败, %s", id, err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
@@ -260,7 +284,7 @@ func GetPermissionsByPermissionIds(db *dbandmq.Ds, pids []string) ([]*Permission
 	}
 
 	var ps []*Permission
-	err := db.C(CollectionNamePermission).Find(f).All(&ps)
+	err := db.TC(CollectionNamePermission).Find(f).All(&ps)
 	if err != nil {
 		Logger.Errorf("", "根据permissionIds读取permission信息失败, %s", err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
@@ -312,7 +336,7 @@ func GetRoleByName(db *dbandmq.Ds, name string, more bool) (*Role, error) {
 	}
 
 	var role *Role
-	err := db.C(CollectionNameRole).Find(f).One(&role)
+	err := db.TC(CollectionNameRole).Find(f).One(&role)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "根据role name[%s]读取role信息失败, %s", name, err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
@@ -334,7 +358,7 @@ func GetRoleByName(db *dbandmq.Ds, name string, more bool) (*Role, error) {
 
 func GetRoleById(db *dbandmq.Ds, id string, more bool) (*Role, error) {
 	var role *Role
-	err := db.C(CollectionNameRole).FindId(id).One(&role)
+	err := db.TC(CollectionNameRole).FindId(id).One(&role)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "根据role id[%s]读取role信息失败, %s", id, err.Error())
 		return nil, err
@@ -368,7 +392,7 @@ func GetRolesByRoleIds(db *dbandmq.Ds, roleIds []string, more bool) ([]*Role, er
 	}
 
 	var roles []*Role
-	err := db.C(CollectionNameRole).Find(f).All(&roles)
+	err := db.TC(CollectionNameRole).Find(f).All(&roles)
 	if err != nil {
 		Logger.Errorf("", "根据roleIds读取role信息失败, %s", err.Error())
 		return nil, err
@@ -7,9 +7,15 @@ import (
 
 // role 自身数据管理
 func RoleRouter(g *gin.RouterGroup, ds *dbandmq.Ds) {
-	roleR := g.Group("/role/m/", func(c *gin.Context) {
+	baseR := g.Group("/role/m/", func(c *gin.Context) {
 		PreCheckAuth(c)
 	})
+
+	// 修改数据前自动保存快照
+	roleR := baseR.Group("", func(c *gin.Context) {
+		AutoSnapshotMiddleware(c, ds)
+	})
+
 	// item manage
 	itemR := roleR.Group("/item")
 	{
@@ -106,6 +112,11 @@ func RoleRouter(g *gin.RouterGroup, ds *dbandmq.Ds) {
 			DeleteRoleHandler(c, ds)
 		})
 
+		// 复制 role
+		rR.POST("/:id/clone", func(c *gin.Context) {
+			CloneRoleHandler(c, ds)
+		})
+
 		// 给 role 添加 subrole
 		rR.POST("/:id/addsubroles", func(c *gin.Context) {
 			AddSubRolesToRoleHandler(c, ds)
@@ -126,6 +137,74 @@ func RoleRouter(g *gin.RouterGroup, ds *dbandmq.Ds) {
 			QueryRoleHandler(c, ds)
 		})
 	}
+
+	// role template manage
+	tR := roleR.Group("/template")
+	{
+		// 新建模板
+		tR.POST("", func(c *gin.Context) {
+			CreateRoleTemplateHandler(c, ds)
+		})
+
+		// 修改模板，可选同步到实例
+		tR.PUT("/:id", func(c *gin.Context) {
+			UpdateRoleTemplateHandler(c, ds)
+		})
+
+		// 删除模板
+		tR.DELETE("/:id", func(c *gin.Context) {
+			DeleteRoleTemplateHandler(c, ds)
+		})
+
+		// 读取模板明细及其实例
+		tR.GET("/:id", func(c *gin.Context) {
+			GetRoleTemplateHandler(c, ds)
+		})
+
+		// 实例化模板
+		tR.POST("/:id/instantiate", func(c *gin.Context) {
+			InstantiateRoleTemplateHandler(c, ds)
+		})
+
+		// 同步模板到所有实例
+		tR.POST("/:id/propagate", func(c *gin.Context) {
+			PropagateRoleTemplateHandler(c, ds)
+		})
+
+		// 搜索模板
+		roleR.GET("/templates", func(c *gin.Context) {
+			QueryRoleTemplateHandler(c, ds)
+		})
+	}
+
+	// snapshot manage
+	sR := baseR.Group("/snapshot")
+	{
+		// 手动保存快照
+		sR.POST("", func(c *gin.Context) {
+			CreateSnapshotHandler(c, ds)
+		})
+
+		// 读取快照明细
+		sR.GET("/:id", func(c *gin.Context) {
+			GetSnapshotHandler(c, ds)
+		})
+
+		// 回滚到指定快照
+		sR.POST("/:id/rollback", func(c *gin.Context) {
+			RollbackSnapshotHandler(c, ds)
+		})
+
+		// 搜索快照
+		baseR.GET("/snapshots", func(c *gin.Context) {
+			QuerySnapshotHandler(c, ds)
+		})
+
+		// 对比快照
+		baseR.GET("/snapshots/diff", func(c *gin.Context) {
+			DiffSnapshotHandler(c, ds)
+		})
+	}
 }
 
 // 管理用户与 role 的关系
@@ -162,5 +241,15 @@ func NoNeedAuthRouter(g *gin.RouterGroup, ds *dbandmq.Ds) {
 		nR.GET("/rau/user/:id", func(c *gin.Context) {
 			GetUserRoleHandler(c, ds)
 		})
+
+		// 读取用户拥有的指定类型的资源列表，?type=MENU
+		nR.GET("/rau/user/:id/resources", func(c *gin.Context) {
+			GetUserResourcesHandler(c, ds)
+		})
+
+		// 检查用户是否拥有指定资源，?type=BUTTON&key=xxx
+		nR.GET("/rau/user/:id/resource", func(c *gin.Context) {
+			CheckUserResourceHandler(c, ds)
+		})
 	}
 }
@@ -0,0 +1,446 @@
+package roleapp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"sync"
+)
+
+func init() {
+	dbandmq.AddIndexKey(IKSnapshot)
+	dbandmq.AddIndexKey(IKSnapshotChunk)
+}
+
+// 修改类请求成功后是否自动保存快照
+var AutoSnapshot = true
+
+// 每个快照分块最多保存的数据条数，避免单个文档超过 16MB
+var SnapshotChunkSize = 500
+
+// 自动快照最多保留的数量，超过后删除最旧的，0 表示不限制
+var MaxAutoSnapshots = 200
+
+// 回滚时替换集合期间加写锁，AuthUser 读取权限时加读锁
+// 保证同一个进程内不会读取到回滚了一半的数据
+var policyLock sync.RWMutex
+
+// item permission role 的快照，subrole 关系保存在 role 中
+const CollectionNameSnapshot = DbPrefix + "snapshot"
+
+var IKSnapshot = &dbandmq.IndexKey{
+	Collection: CollectionNameSnapshot,
+	SingleKey:  []string{"auto", "hash"},
+}
+
+// 快照的数据按分块保存，每块只包含 item permission role 中的一种
+const CollectionNameSnapshotChunk = DbPrefix + "snapshotchunk"
+
+var IKSnapshotChunk = &dbandmq.IndexKey{
+	Collection: CollectionNameSnapshotChunk,
+	SingleKey:  []string{"snapshotId"},
+}
+
+type snapshotChunk struct {
+	Id          string        `bson:"_id"`
+	SnapshotId  string        `bson:"snapshotId"`
+	Seq         int           `bson:"seq"`
+	Items       []*Item       `bson:"items,omitempty"`
+	Permissions []*Permission `bson:"permissions,omitempty"`
+	Roles       []*Role       `bson:"roles,omitempty"`
+}
+
+type Snapshot struct {
+	Id       string `json:"id" bson:"_id"`
+	Reason   string `json:"reason" bson:"reason"`
+	Auto     bool   `json:"auto" bson:"auto"`         // 是否自动生成
+	Operator string `json:"operator" bson:"operator"` // 操作人 userId
+	Hash     string `json:"hash" bson:"hash"`         // 数据内容的 hash，内容未变化时不重复保存自动快照
+
+	// 数据保存在 CollectionNameSnapshotChunk 中，早期版本的快照直接保存在快照文档中
+	Items       []*Item       `json:"items,omitempty" bson:"items,omitempty"`
+	Permissions []*Permission `json:"permissions,omitempty" bson:"permissions,omitempty"`
+	Roles       []*Role       `json:"roles,omitempty" bson:"roles,omitempty"`
+
+	CreateT *util.CurTime `json:"createT" bson:"createT"`
+}
+
+// 读取当前线上的全部数据
+func loadLiveSnapshot(ds *dbandmq.Ds) (*Snapshot, error) {
+	s := &Snapshot{}
+	err := ds.TC(CollectionNameItem).Find(nil).Sort("_id").All(&s.Items)
+	if err != nil {
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	err = ds.TC(CollectionNamePermission).Find(nil).Sort("_id").All(&s.Permissions)
+	if err != nil {
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	err = ds.TC(CollectionNameRole).Find(nil).Sort("_id").All(&s.Roles)
+	if err != nil {
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return s, nil
+}
+
+func (s *Snapshot) calcHash() string {
+	data, _ := bson.Marshal(bson.M{
+		"items":       s.Items,
+		"permissions": s.Permissions,
+		"roles":       s.Roles,
+	})
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// 保存当前数据的快照
+// 自动快照在内容与最近一次快照相同时不重复保存，返回最近的那一次
+func TakeSnapshot(ds *dbandmq.Ds, reason, operator string, auto bool) (*Snapshot, error) {
+	s, err := loadLiveSnapshot(ds)
+	if err != nil {
+		return nil, err
+	}
+	s.Hash = s.calcHash()
+
+	if auto {
+		var last *Snapshot
+		err = ds.TC(CollectionNameSnapshot).Find(nil).Sort("-_id").Select(bson.M{"hash": 1, "createT": 1, "reason": 1, "auto": 1}).One(&last)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, middleware.ErrDbExec.Append(err.Error())
+		}
+		if last != nil && last.Hash == s.Hash {
+			return last, nil
+		}
+	}
+
+	s.Id = util.GenerateDataId()
+	s.Reason = reason
+	s.Operator = operator
+	s.Auto = auto
+	s.CreateT = util.GetCurTime()
+
+	// 先保存数据分块，再保存快照文档，快照文档存在时数据一定是完整的
+	chunks := s.chunks()
+	if len(chunks) > 0 {
+		err = ds.TC(CollectionNameSnapshotChunk).Insert(chunks...)
+	}
+	if err == nil {
+		meta := *s
+		meta.Items, meta.Permissions, meta.Roles = nil, nil, nil
+		err = ds.TC(CollectionNameSnapshot).Insert(&meta)
+	}
+	if err != nil {
+		Logger.Errorf("", "保存role快照失败, %s", err.Error())
+		_, _ = ds.TC(CollectionNameSnapshotChunk).RemoveAll(bson.M{"snapshotId": s.Id})
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	Logger.Infof("", "保存role快照[%s][%s]成功", s.Id, reason)
+
+	if auto {
+		pruneAutoSnapshots(ds)
+	}
+
+	return s, nil
+}
+
+// 按 SnapshotChunkSize 拆分数据
+func (s *Snapshot) chunks() []interface{} {
+	size := SnapshotChunkSize
+	if size <= 0 {
+		size = 500
+	}
+
+	var chunks []interface{}
+	newChunk := func() *snapshotChunk {
+		chunk := &snapshotChunk{
+			Id:         util.GenerateDataId(),
+			SnapshotId: s.Id,
+			Seq:        len(chunks),
+		}
+		chunks = append(chunks, chunk)
+		return chunk
+	}
+	for i := 0; i < len(s.Items); i += size {
+		newChunk().Items = s.Items[i:minInt(i+size, len(s.Items))]
+	}
+	for i := 0; i < len(s.Permissions); i += size {
+		newChunk().Permissions = s.Permissions[i:minInt(i+size, len(s.Permissions))]
+	}
+	for i := 0; i < len(s.Roles); i += size {
+		newChunk().Roles = s.Roles[i:minInt(i+size, len(s.Roles))]
+	}
+	return chunks
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// 删除多余的自动快照，失败只记录日志
+func pruneAutoSnapshots(ds *dbandmq.Ds) {
+	if MaxAutoSnapshots <= 0 {
+		return
+	}
+
+	var olds []*Snapshot
+	err := ds.TC(CollectionNameSnapshot).Find(bson.M{"auto": true}).Sort("-_id").Skip(MaxAutoSnapshots).Select(bson.M{"_id": 1}).All(&olds)
+	if err != nil {
+		Logger.Errorf("", "读取过期的role快照失败, %s", err.Error())
+		return
+	}
+	if len(olds) == 0 {
+		return
+	}
+
+	var ids []string
+	for _, old := range olds {
+		ids = append(ids, old.Id)
+	}
+	_, err = ds.TC(CollectionNameSnapshot).RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		Logger.Errorf("", "删除过期的role快照失败, %s", err.Error())
+		return
+	}
+	_, err = ds.TC(CollectionNameSnapshotChunk).RemoveAll(bson.M{"snapshotId": bson.M{"$in": ids}})
+	if err != nil {
+		Logger.Errorf("", "删除过期的role快照数据失败, %s", err.Error())
+	}
+}
+
+func GetSnapshotById(ds *dbandmq.Ds, id string) (*Snapshot, error) {
+	var s *Snapshot
+	err := ds.TC(CollectionNameSnapshot).FindId(id).One(&s)
+	if err != nil && err != mgo.ErrNotFound {
+		Logger.Errorf("", "根据id[%s]读取role快照失败, %s", id, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	if s == nil {
+		return nil, nil
+	}
+
+	var chunks []*snapshotChunk
+	err = ds.TC(CollectionNameSnapshotChunk).Find(bson.M{"snapshotId": id}).Sort("seq").All(&chunks)
+	if err != nil {
+		Logger.Errorf("", "根据id[%s]读取role快照数据失败, %s", id, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	for _, chunk := range chunks {
+		s.Items = append(s.Items, chunk.Items...)
+		s.Permissions = append(s.Permissions, chunk.Permissions...)
+		s.Roles = append(s.Roles, chunk.Roles...)
+	}
+	return s, nil
+}
+
+// 快照对比
+type DiffEntry struct {
+	Id     string      `json:"id"`
+	Name   string      `json:"name"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type DiffSet struct {
+	Added   []*DiffEntry `json:"added"`
+	Removed []*DiffEntry `json:"removed"`
+	Changed []*DiffEntry `json:"changed"`
+}
+
+type SnapshotDiff struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Items       *DiffSet `json:"items"`
+	Permissions *DiffSet `json:"permissions"`
+	Roles       *DiffSet `json:"roles"`
+}
+
+// 按 id 对比两组数据，忽略时间字段
+func diffById(from, to map[string]interface{}, name func(interface{}) string) *DiffSet {
+	ds := &DiffSet{}
+	for id, f := range from {
+		t, ok := to[id]
+		if !ok {
+			ds.Removed = append(ds.Removed, &DiffEntry{Id: id, Name: name(f), Before: f})
+			continue
+		}
+		if !reflect.DeepEqual(f, t) {
+			ds.Changed = append(ds.Changed, &DiffEntry{Id: id, Name: name(t), Before: f, After: t})
+		}
+	}
+	for id, t := range to {
+		if _, ok := from[id]; !ok {
+			ds.Added = append(ds.Added, &DiffEntry{Id: id, Name: name(t), After: t})
+		}
+	}
+	return ds
+}
+
+func DiffSnapshots(from, to *Snapshot) *SnapshotDiff {
+	itemMap := func(items []*Item) map[string]interface{} {
+		m := make(map[string]interface{})
+		for _, item := range items {
+			v := *item
+			v.CreateT, v.UpdateT = nil, nil
+			m[item.Id] = &v
+		}
+		return m
+	}
+	pMap := func(ps []*Permission) map[string]interface{} {
+		m := make(map[string]interface{})
+		for _, p := range ps {
+			v := *p
+			v.CreateT, v.UpdateT = nil, nil
+			m[p.Id] = &v
+		}
+		return m
+	}
+	roleMap := func(roles []*Role) map[string]interface{} {
+		m := make(map[string]interface{})
+		for _, role := range roles {
+			v := *role
+			v.CreateT, v.UpdateT = nil, nil
+			m[role.Id] = &v
+		}
+		return m
+	}
+
+	diff := &SnapshotDiff{
+		From: from.Id,
+		To:   to.Id,
+	}
+	diff.Items = diffById(itemMap(from.Items), itemMap(to.Items), func(v interface{}) string { return v.(*Item).Name })
+	diff.Permissions = diffById(pMap(from.Permissions), pMap(to.Permissions), func(v interface{}) string { return v.(*Permission).Name })
+	diff.Roles = diffById(roleMap(from.Roles), roleMap(to.Roles), func(v interface{}) string { return v.(*Role).Name })
+
+	return diff
+}
+
+// 回滚到指定快照
+// 先把快照数据写入临时集合并建立索引，再在写锁内使用 renameCollection 替换线上集合
+// 替换时线上集合先改名为备份，任何一步失败都按相反的顺序恢复，保证三个集合要么全部替换，要么全部保持原样
+// policyLock 只在本进程内有效，多实例部署时其他实例在替换的瞬间仍可能读到新旧混合的数据
+// 回滚前会自动保存当前数据的快照，方便撤销回滚
+func RollbackToSnapshot(ds *dbandmq.Ds, s *Snapshot, operator string) error {
+	_, err := TakeSnapshot(ds, fmt.Sprintf("before rollback to %s", s.Id), operator, true)
+	if err != nil {
+		return err
+	}
+
+	const (
+		stageSuffix  = "_rollback"
+		backupSuffix = "_rollback_old"
+	)
+	stages := []struct {
+		name string
+		ik   *dbandmq.IndexKey
+		docs []interface{}
+	}{
+		{CollectionNameItem, IKItem, nil},
+		{CollectionNamePermission, IKPermission, nil},
+		{CollectionNameRole, IKRole, nil},
+	}
+	for _, item := range s.Items {
+		stages[0].docs = append(stages[0].docs, item)
+	}
+	for _, p := range s.Permissions {
+		stages[1].docs = append(stages[1].docs, p)
+	}
+	for _, role := range s.Roles {
+		stages[2].docs = append(stages[2].docs, role)
+	}
+
+	for _, stage := range stages {
+		sc := ds.TC(stage.name + stageSuffix)
+		_ = sc.DropCollection()
+		_ = ds.TC(stage.name + backupSuffix).DropCollection()
+		if len(stage.docs) == 0 {
+			err = sc.Create(&mgo.CollectionInfo{})
+		} else {
+			err = sc.Insert(stage.docs...)
+		}
+		if err == nil {
+			// 索引在替换之前建立，renameCollection 会保留索引
+			err = ds.InsureIndexKey(stage.ik, sc.Name)
+		}
+		if err != nil {
+			Logger.Errorf("", "回滚role快照[%s]时写入临时集合[%s]失败, %s", s.Id, sc.Name, err.Error())
+			return middleware.ErrDbExec.Append(err.Error())
+		}
+	}
+
+	db := ds.TC(CollectionNameItem).Database
+	names, err := db.CollectionNames()
+	if err != nil {
+		return middleware.ErrDbExec.Append(err.Error())
+	}
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[name] = true
+	}
+
+	type renameStep struct {
+		from, to string
+	}
+	var done []renameStep
+	rename := func(from, to string) error {
+		err := renameCollection(ds, db.Name, from, to)
+		if err == nil {
+			done = append(done, renameStep{from, to})
+		}
+		return err
+	}
+
+	policyLock.Lock()
+	for _, stage := range stages {
+		if exists[stage.name] {
+			err = rename(stage.name, stage.name+backupSuffix)
+			if err != nil {
+				break
+			}
+		}
+		err = rename(stage.name+stageSuffix, stage.name)
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		for i := len(done) - 1; i >= 0; i-- {
+			step := done[i]
+			if uerr := renameCollection(ds, db.Name, step.to, step.from); uerr != nil {
+				Logger.Errorf("", "回滚role快照[%s]失败后恢复集合[%s]失败, %s", s.Id, step.from, uerr.Error())
+			}
+		}
+	}
+	policyLock.Unlock()
+	if err != nil {
+		Logger.Errorf("", "回滚role快照[%s]时替换集合失败, %s", s.Id, err.Error())
+		return middleware.ErrDbExec.Append(err.Error())
+	}
+
+	for _, stage := range stages {
+		_ = ds.TC(stage.name + backupSuffix).DropCollection()
+	}
+
+	Logger.Infof("", "回滚到role快照[%s]成功, operator[%s]", s.Id, operator)
+	return nil
+}
+
+// 同一个数据库内的集合改名，目标集合存在时删除
+func renameCollection(ds *dbandmq.Ds, dbName, from, to string) error {
+	cmd := bson.D{
+		{Name: "renameCollection", Value: dbName + "." + from},
+		{Name: "to", Value: dbName + "." + to},
+		{Name: "dropTarget", Value: true},
+	}
+	return ds.Se.Run(cmd, nil)
+}
@@ -0,0 +1,197 @@
+package roleapp
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/util"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+)
+
+func curOperator(c *gin.Context) string {
+	user := GetCurUser(c)
+	if user == nil {
+		return ""
+	}
+	return user.UserId
+}
+
+// 修改类的请求执行前后自动保存快照，dryRun 的请求不处理
+// 修改前总是保存一份，其他途径(比如其他服务启动时注册的 item)的修改也会被记录，回滚时不会丢失
+// 内容与最新的快照相同时按 hash 去重，不会重复保存
+// 执行后请求已经完成，快照失败只记录日志
+func AutoSnapshotMiddleware(c *gin.Context, db *dbandmq.Ds) {
+	if !AutoSnapshot || c.Request.Method == http.MethodGet || isDryRun(c) {
+		c.Next()
+		return
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	operator := curOperator(c)
+	reason := fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path)
+
+	_, err := TakeSnapshot(ds, "before "+reason, operator, true)
+	middleware.StopExec(err)
+
+	c.Next()
+
+	if c.IsAborted() || c.Writer.Status() >= http.StatusBadRequest {
+		return
+	}
+	_, err = TakeSnapshot(ds, reason, operator, true)
+	if err != nil {
+		Logger.Errorf(middleware.GetReqId(c), "[%s]执行后自动保存role快照失败, %s", reason, err.Error())
+	}
+}
+
+// 手动保存快照
+type CreateSnapshotForm struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+func CreateSnapshotHandler(c *gin.Context, db *dbandmq.Ds) {
+	var form CreateSnapshotForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	s, err := TakeSnapshot(ds, strings.TrimSpace(form.Reason), curOperator(c), false)
+	middleware.StopExec(err)
+
+	s.Items, s.Permissions, s.Roles = nil, nil, nil
+	returnfun.ReturnOKJson(c, s)
+	return
+}
+
+// 读取快照明细
+func GetSnapshotHandler(c *gin.Context, db *dbandmq.Ds) {
+	id := c.Param("id")
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	s, err := GetSnapshotById(ds, id)
+	middleware.StopExec(err)
+	if s == nil {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	returnfun.ReturnOKJson(c, s)
+	return
+}
+
+// 搜索快照列表，不包含数据内容
+func QuerySnapshotHandler(c *gin.Context, db *dbandmq.Ds) {
+	var andCondition []bson.M
+
+	auto := c.Query("auto")
+	if auto != "" {
+		auto = strings.ToUpper(auto)
+		if auto == "TRUE" {
+			andCondition = append(andCondition, bson.M{"auto": true})
+		} else {
+			andCondition = append(andCondition, bson.M{"auto": false})
+		}
+	}
+
+	reason := c.Query("reason")
+	if reason != "" {
+		andCondition = append(andCondition, bson.M{"reason": bson.M{"$regex": reason}})
+	}
+
+	query := bson.M{}
+	if len(andCondition) > 0 {
+		query = bson.M{
+			"$and": andCondition,
+		}
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	Q := ds.TC(CollectionNameSnapshot).Find(query)
+	total, err := Q.Count()
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	var ss []*Snapshot
+	page, size, skip := util.GetPageAndSize(c)
+	err = Q.Sort("-_id").Skip(skip).Limit(size).Select(bson.M{"items": 0, "permissions": 0, "roles": 0}).All(&ss)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	ret := returnfun.QueryListData{
+		Total: total,
+		Page:  page,
+		Size:  size,
+		Data:  ss,
+	}
+
+	returnfun.ReturnOKJson(c, ret)
+	return
+}
+
+// 对比两个快照，?from=xxx&to=xxx
+// to 为空时与当前线上数据对比
+func DiffSnapshotHandler(c *gin.Context, db *dbandmq.Ds) {
+	fromId := c.Query("from")
+	toId := c.Query("to")
+	if fromId == "" {
+		returnfun.ReturnErrKeyJson(c, msgMissingFrom)
+		return
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	from, err := GetSnapshotById(ds, fromId)
+	middleware.StopExec(err)
+	if from == nil {
+		middleware.StopExec(middleware.ErrNoIdData.Append(fromId))
+	}
+
+	var to *Snapshot
+	if toId == "" {
+		to, err = loadLiveSnapshot(ds)
+		middleware.StopExec(err)
+		to.Id = "live"
+	} else {
+		to, err = GetSnapshotById(ds, toId)
+		middleware.StopExec(err)
+		if to == nil {
+			middleware.StopExec(middleware.ErrNoIdData.Append(toId))
+		}
+	}
+
+	returnfun.ReturnOKJson(c, DiffSnapshots(from, to))
+	return
+}
+
+// 回滚到指定快照
+func RollbackSnapshotHandler(c *gin.Context, db *dbandmq.Ds) {
+	id := c.Param("id")
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	s, err := GetSnapshotById(ds, id)
+	middleware.StopExec(err)
+	if s == nil {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	err = RollbackToSnapshot(ds, s, curOperator(c))
+	middleware.StopExec(err)
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
@@ -0,0 +1,287 @@
+package roleapp
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// 新建 role 模板
+type CreateRoleTemplateForm struct {
+	Name            string     `json:"name" binding:"required"`
+	Params          []string   `json:"params"`
+	RoleName        string     `json:"roleName" binding:"required"` // 支持 {param} 占位符
+	PermissionIds   []string   `json:"permissionIds"`
+	PermissionNames []string   `json:"permissionNames"` // 支持 {param} 占位符
+	SubRoles        []*SubRole `json:"subRoles"`
+}
+
+func CreateRoleTemplateHandler(c *gin.Context, db *dbandmq.Ds) {
+	var form CreateRoleTemplateForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	name := strings.TrimSpace(form.Name)
+	dbt, err := GetRoleTemplateByName(ds, name)
+	middleware.StopExec(err)
+
+	if dbt != nil {
+		returnfun.ReturnErrKeyJson(c, msgNameExists)
+		return
+	}
+
+	t := &RoleTemplate{
+		Id:              util.GenerateDataId(),
+		Name:            name,
+		Params:          form.Params,
+		RoleName:        strings.TrimSpace(form.RoleName),
+		PermissionIds:   form.PermissionIds,
+		PermissionNames: form.PermissionNames,
+		SubRoles:        form.SubRoles,
+		Version:         1,
+		Deleted:         false,
+		CreateT:         util.GetCurTime(),
+	}
+	t.UpdateT = t.CreateT
+
+	err = ds.TC(CollectionNameRoleTemplate).Insert(t)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	returnfun.ReturnOKJson(c, t)
+	return
+}
+
+// 修改 role 模板，版本号递增
+// propagate 为 true 时，同时同步到所有实例
+type UpdateRoleTemplateForm struct {
+	CreateRoleTemplateForm
+	Propagate bool `json:"propagate"`
+}
+
+func UpdateRoleTemplateHandler(c *gin.Context, db *dbandmq.Ds) {
+	var form UpdateRoleTemplateForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	id := c.Param("id")
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	dbt, err := GetRoleTemplateById(ds, id)
+	middleware.StopExec(err)
+	if dbt == nil || dbt.Deleted {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	name := strings.TrimSpace(form.Name)
+	if name != dbt.Name {
+		nt, err := GetRoleTemplateByName(ds, name)
+		middleware.StopExec(err)
+		if nt != nil {
+			returnfun.ReturnErrKeyJson(c, msgNameExists)
+			return
+		}
+	}
+
+	dbt.Name = name
+	dbt.Params = form.Params
+	dbt.RoleName = strings.TrimSpace(form.RoleName)
+	dbt.PermissionIds = form.PermissionIds
+	dbt.PermissionNames = form.PermissionNames
+	dbt.SubRoles = form.SubRoles
+	dbt.Version++
+	dbt.UpdateT = util.GetCurTime()
+
+	err = ds.TC(CollectionNameRoleTemplate).UpdateId(dbt.Id, dbt)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	if !form.Propagate {
+		returnfun.ReturnOKJson(c, dbt)
+		return
+	}
+
+	ret, err := PropagateRoleTemplate(ds, dbt)
+	middleware.StopExec(err)
+
+	retData := gin.H{
+		"template":  dbt,
+		"propagate": ret,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
+
+// 删除 role 模板，已实例化的 role 不受影响
+func DeleteRoleTemplateHandler(c *gin.Context, db *dbandmq.Ds) {
+	id := c.Param("id")
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	update := bson.M{
+		"$set": bson.M{
+			"deleted": true,
+			"updateT": util.GetCurTime(),
+		},
+	}
+
+	err := ds.TC(CollectionNameRoleTemplate).UpdateId(id, update)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
+
+// 读取 role 模板明细，包含所有实例
+func GetRoleTemplateHandler(c *gin.Context, db *dbandmq.Ds) {
+	id := c.Param("id")
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	t, err := GetRoleTemplateById(ds, id)
+	middleware.StopExec(err)
+	if t == nil {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	roles, err := GetRolesByTemplateId(ds, id)
+	middleware.StopExec(err)
+
+	retData := gin.H{
+		"template":  t,
+		"instances": roles,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
+
+// 搜索 role 模板
+func QueryRoleTemplateHandler(c *gin.Context, db *dbandmq.Ds) {
+	var andCondition []bson.M
+
+	name := c.Query("name")
+	if name != "" {
+		andCondition = append(andCondition, bson.M{"name": bson.M{"$regex": name}})
+	}
+
+	deleted := c.Query("deleted")
+	if deleted != "" {
+		deleted = strings.ToUpper(deleted)
+		if deleted == "TRUE" {
+			andCondition = append(andCondition, bson.M{"deleted": true})
+		} else {
+			andCondition = append(andCondition, bson.M{"deleted": false})
+		}
+	}
+
+	query := bson.M{}
+	if len(andCondition) > 0 {
+		query = bson.M{
+			"$and": andCondition,
+		}
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	Q := ds.TC(CollectionNameRoleTemplate).Find(query)
+	total, err := Q.Count()
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	var ts []*RoleTemplate
+	page, size, skip := util.GetPageAndSize(c)
+	err = Q.Sort("-_id").Skip(skip).Limit(size).All(&ts)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	ret := returnfun.QueryListData{
+		Total: total,
+		Page:  page,
+		Size:  size,
+		Data:  ts,
+	}
+
+	returnfun.ReturnOKJson(c, ret)
+	return
+}
+
+// 实例化 role 模板
+// name 可选，不传时使用模板的 roleName 渲染
+type InstantiateRoleTemplateForm struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params"`
+}
+
+func InstantiateRoleTemplateHandler(c *gin.Context, db *dbandmq.Ds) {
+	var form InstantiateRoleTemplateForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	id := c.Param("id")
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	t, err := GetRoleTemplateById(ds, id)
+	middleware.StopExec(err)
+	if t == nil || t.Deleted {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	role, err := t.NewRole(ds, form.Name, form.Params)
+	if err != nil {
+		returnfun.ReturnErrJson(c, returnfun.ErrMsg(c, err))
+		return
+	}
+
+	dbrole, err := GetRoleByName(ds, role.Name, false)
+	middleware.StopExec(err)
+	if dbrole != nil {
+		returnfun.ReturnErrKeyJson(c, msgNameExists)
+		return
+	}
+
+	err = SaveRole(ds, role)
+	if err != nil {
+		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
+	}
+
+	returnfun.ReturnOKJson(c, role)
+	return
+}
+
+// 把模板同步到所有实例
+func PropagateRoleTemplateHandler(c *gin.Context, db *dbandmq.Ds) {
+	id := c.Param("id")
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	t, err := GetRoleTemplateById(ds, id)
+	middleware.StopExec(err)
+	if t == nil || t.Deleted {
+		middleware.StopExec(middleware.ErrNoIdData.Append(id))
+	}
+
+	ret, err := PropagateRoleTemplate(ds, t)
+	middleware.StopExec(err)
+
+	returnfun.ReturnOKJson(c, ret)
+	return
+}
@@ -0,0 +1,218 @@
+package roleapp
+
+import (
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/i18n"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+func init() {
+	dbandmq.AddIndexKey(IKRoleTemplate)
+}
+
+// role 模板，参数化的 permission/subrole 集合
+// 可以按租户、项目等维度实例化为具体的 role
+const CollectionNameRoleTemplate = DbPrefix + "roletemplate"
+
+var IKRoleTemplate = &dbandmq.IndexKey{
+	Collection: CollectionNameRoleTemplate,
+	SingleKey:  []string{"deleted"},
+	UniqueKey:  []string{"name"},
+}
+
+type RoleTemplate struct {
+	Id   string `json:"id" bson:"_id"`
+	Name string `json:"name" bson:"name"`
+
+	// 参数名列表，实例化时必须全部提供
+	Params []string `json:"params" bson:"params"`
+
+	// 实例化后的 role 名字，支持 {param} 形式的占位符，比如 {tenant}:editor
+	RoleName string `json:"roleName" bson:"roleName"`
+
+	// 固定的 permission id
+	PermissionIds []string `json:"permissionIds" bson:"permissionIds"`
+
+	// 参数化的 permission name，实例化时替换参数后按 name 查找，比如 {project}:reader
+	PermissionNames []string `json:"permissionNames" bson:"permissionNames"`
+
+	SubRoles []*SubRole `json:"subRoles" bson:"subRoles"`
+
+	// 每次修改递增，实例记录自己生成时的版本
+	Version int `json:"version" bson:"version"`
+
+	Deleted bool `json:"deleted" bson:"deleted"`
+
+	CreateT *util.CurTime `json:"-" bson:"createT"`
+	UpdateT *util.CurTime `json:"-" bson:"updateT"`
+}
+
+// 替换字符串中的 {param} 占位符
+func renderTemplateStr(src string, params map[string]string) string {
+	for k, v := range params {
+		src = strings.ReplaceAll(src, "{"+k+"}", v)
+	}
+	return src
+}
+
+// 检查参数是否完整
+func (t *RoleTemplate) checkParams(params map[string]string) error {
+	var missing []string
+	for _, p := range t.Params {
+		if strings.TrimSpace(params[p]) == "" {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return i18n.New(msgTemplateParams, strings.Join(missing, ","))
+	}
+	return nil
+}
+
+// 根据参数计算实例的 permission ids
+func (t *RoleTemplate) resolvePermissionIds(ds *dbandmq.Ds, params map[string]string) ([]string, error) {
+	pids := append([]string{}, t.PermissionIds...)
+	for _, pn := range t.PermissionNames {
+		name := renderTemplateStr(pn, params)
+		p, err := GetPermissionByName(ds, name, false)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil || p.Deleted {
+			return nil, i18n.New(msgTemplatePNotFound, name)
+		}
+		pids = append(pids, p.Id)
+	}
+
+	if len(pids) > 1 {
+		pids = util.UniqueStringArray(pids)
+	}
+	return pids, nil
+}
+
+// 根据模板生成一个新的 role，未保存到数据库
+// name 为空时使用模板的 RoleName 渲染
+func (t *RoleTemplate) NewRole(ds *dbandmq.Ds, name string, params map[string]string) (*Role, error) {
+	err := t.checkParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = renderTemplateStr(t.RoleName, params)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, i18n.New(msgTemplateRoleName, t.Name)
+	}
+
+	pids, err := t.resolvePermissionIds(ds, params)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &Role{
+		Id:              util.GenerateDataId(),
+		Name:            name,
+		PermissionIds:   pids,
+		SubRoles:        t.SubRoles,
+		TemplateId:      t.Id,
+		TemplateVersion: t.Version,
+		TemplateParams:  params,
+		Deleted:         false,
+		Source:          RoleDataSourceApi,
+		CreateT:         util.GetCurTime(),
+	}
+	role.UpdateT = role.CreateT
+
+	return role, nil
+}
+
+func GetRoleTemplateById(ds *dbandmq.Ds, id string) (*RoleTemplate, error) {
+	var t *RoleTemplate
+	err := ds.TC(CollectionNameRoleTemplate).FindId(id).One(&t)
+	if err != nil && err != mgo.ErrNotFound {
+		Logger.Errorf("", "根据id[%s]读取role template失败, %s", id, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return t, nil
+}
+
+func GetRoleTemplateByName(ds *dbandmq.Ds, name string) (*RoleTemplate, error) {
+	f := bson.M{
+		"name": name,
+	}
+
+	var t *RoleTemplate
+	err := ds.TC(CollectionNameRoleTemplate).Find(f).One(&t)
+	if err != nil && err != mgo.ErrNotFound {
+		Logger.Errorf("", "根据name[%s]读取role template失败, %s", name, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return t, nil
+}
+
+// 读取模板的所有未删除的实例
+func GetRolesByTemplateId(ds *dbandmq.Ds, tid string) ([]*Role, error) {
+	f := bson.M{
+		"templateId": tid,
+		"deleted":    false,
+	}
+
+	var roles []*Role
+	err := ds.TC(CollectionNameRole).Find(f).All(&roles)
+	if err != nil {
+		Logger.Errorf("", "根据templateId[%s]读取role列表失败, %s", tid, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return roles, nil
+}
+
+// 同步结果
+type PropagateResult struct {
+	Updated []*SimpleRole     `json:"updated"`
+	Failed  map[string]string `json:"failed"` // role name -> 错误信息
+}
+
+// 把模板当前的 permission/subrole 同步到所有实例
+// role 名字不变，单个实例失败不影响其他实例
+func PropagateRoleTemplate(ds *dbandmq.Ds, t *RoleTemplate) (*PropagateResult, error) {
+	roles, err := GetRolesByTemplateId(ds, t.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &PropagateResult{
+		Failed: make(map[string]string),
+	}
+	for _, role := range roles {
+		pids, err := t.resolvePermissionIds(ds, role.TemplateParams)
+		if err != nil {
+			ret.Failed[role.Name] = err.Error()
+			continue
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"permissionIds":   pids,
+				"subRoles":        t.SubRoles,
+				"templateVersion": t.Version,
+				"updateT":         util.GetCurTime(),
+			},
+		}
+		err = ds.TC(CollectionNameRole).UpdateId(role.Id, update)
+		if err != nil {
+			ret.Failed[role.Name] = err.Error()
+			continue
+		}
+		ret.Updated = append(ret.Updated, &SimpleRole{Id: role.Id, Name: role.Name})
+	}
+
+	Logger.Infof("", "同步role template[%s]v%d完成, 成功[%d], 失败[%d]", t.Name, t.Version, len(ret.Updated), len(ret.Failed))
+	return ret, nil
+}
@@ -24,10 +24,10 @@ func AddRoleToUserHandler(c *gin.Context, db *dbandmq.Ds) {
 	err := c.BindJSON(&form)
 	middleware.StopExec(err)
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 	if len(form.RoleIds) == 0 && len(form.RoleNames) == 0 {
-		returnfun.ReturnErrJson(c, "roleId 与 roleName 必须要有一个存在")
+		returnfun.ReturnErrKeyJson(c, msgRoleIdOrName)
 		return
 	}
 
@@ -54,19 +54,19 @@ func AddRoleToUserHandler(c *gin.Context, db *dbandmq.Ds) {
 	}
 
 	if len(roleIds) == 0 {
-		returnfun.ReturnErrJson(c, "传递的 role 相关数据全部不合法")
+		returnfun.ReturnErrKeyJson(c, msgRolesInvalid)
 		return
 	}
 
 	// 检查当前操作用户是否能够给别人分配对应的 role
 	curUser := GetCurUser(c)
 	if curUser == nil {
-		returnfun.ReturnJson(c, 417, 417, "服务器配置错误，未正确配置用户验证", "")
+		returnfun.ReturnKeyJson(c, 417, 417, msgAuthNotConfigured, "")
 		return
 	}
 
 	if !IdInSubRoles(curUser, roleIds) {
-		returnfun.Return403Json(c, "当前用户无权给用户赋予某些角色")
+		returnfun.Return403KeyJson(c, msgGrantForbidden)
 		return
 	}
 
@@ -83,7 +83,7 @@ func AddRoleToUserHandler(c *gin.Context, db *dbandmq.Ds) {
 			CreateT:  util.GetCurTime(),
 		}
 		rau.UpdateT = rau.CreateT
-		err = ds.C(CollectionNameRoleAndUser).Insert(rau)
+		err = ds.TC(CollectionNameRoleAndUser).Insert(rau)
 		middleware.StopExec(err)
 		returnfun.ReturnOKJson(c, rau)
 		return
@@ -99,7 +99,7 @@ func AddRoleToUserHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	err = ds.C(CollectionNameRoleAndUser).UpdateId(rau.Id, update)
+	err = ds.TC(CollectionNameRoleAndUser).UpdateId(rau.Id, update)
 	middleware.StopExec(err)
 
 	returnfun.ReturnOKJson(c, rau)
@@ -118,10 +118,10 @@ func RemoveRoleFromUserHandler(c *gin.Context, db *dbandmq.Ds) {
 	err := c.BindJSON(&form)
 	middleware.StopExec(err)
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 	if len(form.RoleIds) == 0 && len(form.RoleNames) == 0 {
-		returnfun.ReturnErrJson(c, "roleId 与 roleName 必须要有一个存在")
+		returnfun.ReturnErrKeyJson(c, msgRoleIdOrName)
 		return
 	}
 
@@ -148,26 +148,26 @@ func RemoveRoleFromUserHandler(c *gin.Context, db *dbandmq.Ds) {
 	}
 
 	if len(roleIds) == 0 {
-		returnfun.ReturnErrJson(c, "传递的 role 相关数据全部不合法")
+		returnfun.ReturnErrKeyJson(c, msgRolesInvalid)
 		return
 	}
 
 	// 检查当前操作用户是否能够给别人分配对应的 role
 	curUser := GetCurUser(c)
 	if curUser == nil {
-		returnfun.ReturnJson(c, 417, 417, "服务器配置错误，未正确配置用户验证", "")
+		returnfun.ReturnKeyJson(c, 417, 417, msgAuthNotConfigured, "")
 		return
 	}
 
 	if !IdInSubRoles(curUser, roleIds) {
-		returnfun.Return403Json(c, "当前用户无权给用户赋予某些角色")
+		returnfun.Return403KeyJson(c, msgGrantForbidden)
 		return
 	}
 
 	rau, err := GetRoleAndUserByUserId(ds, strings.TrimSpace(form.UserId))
 	middleware.StopExec(err)
 	if rau == nil {
-		returnfun.ReturnErrJson(c, "用户无赋予权限记录")
+		returnfun.ReturnErrKeyJson(c, msgNoGrantRecord)
 		return
 	}
 
@@ -193,7 +193,7 @@ func RemoveRoleFromUserHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	err = ds.C(CollectionNameRoleAndUser).UpdateId(rau.Id, update)
+	err = ds.TC(CollectionNameRoleAndUser).UpdateId(rau.Id, update)
 	middleware.StopExec(err)
 
 	returnfun.ReturnOKJson(c, "")
@@ -225,10 +225,10 @@ func QueryRoleAndUserHandler(c *gin.Context, db *dbandmq.Ds) {
 		}
 	}
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
-	Q := ds.C(CollectionNameRoleAndUser).Find(query)
+	Q := ds.TC(CollectionNameRoleAndUser).Find(query)
 	total, err := Q.Count()
 	middleware.StopExec(err)
 
@@ -285,7 +285,7 @@ func QueryRoleAndUserHandler(c *gin.Context, db *dbandmq.Ds) {
 func GetUserRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 	uid := c.Param("id")
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	rau, err := GetRoleAndUserByUserId(ds, uid)
@@ -316,3 +316,46 @@ func GetUserRoleHandler(c *gin.Context, db *dbandmq.Ds) {
 	returnfun.ReturnOKJson(c, rau)
 	return
 }
+
+// 读取用户拥有的指定类型的资源，比如菜单、按钮
+// 本接口无需权限
+func GetUserResourcesHandler(c *gin.Context, db *dbandmq.Ds) {
+	uid := c.Param("id")
+	typ := c.Query("type")
+	if typ == "" {
+		returnfun.ReturnErrKeyJson(c, msgMissingType)
+		return
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	items, err := GetUserResources(ds, uid, typ)
+	middleware.StopExec(err)
+
+	returnfun.ReturnOKJson(c, items)
+	return
+}
+
+// 检查用户是否拥有指定类型的指定资源
+// 本接口无需权限
+func CheckUserResourceHandler(c *gin.Context, db *dbandmq.Ds) {
+	uid := c.Param("id")
+	typ := c.Query("type")
+	key := c.Query("key")
+	if typ == "" || key == "" {
+		returnfun.ReturnErrKeyJson(c, msgMissingTypeOrKey)
+		return
+	}
+
+	ds := db.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	ar := AuthUserResource(ds, uid, typ, key)
+	if ar.Result == AuthResultInternalError {
+		middleware.StopExec(middleware.ErrDbExec.Append(ar.Msg))
+	}
+
+	returnfun.ReturnOKJson(c, ar)
+	return
+}
@@ -69,7 +69,7 @@ func insureDefaultRole(ds *dbandmq.Ds) error {
 			CreateT: util.GetCurTime(),
 		}
 		role.UpdateT = role.CreateT
-		err = ds.C(CollectionNameRole).Insert(role)
+		err = ds.TC(CollectionNameRole).Insert(role)
 		return err
 	}
 
@@ -81,27 +81,27 @@ func insureDefaultRole(ds *dbandmq.Ds) error {
 			},
 		}
 
-		err = ds.C(CollectionNameRole).UpdateId(dbrole.Id, update)
+		err = ds.TC(CollectionNameRole).UpdateId(dbrole.Id, update)
 		return err
 	}
 	return nil
 }
 
 func SaveItem(ds *dbandmq.Ds, item *Item) error {
-	err := ds.C(CollectionNameItem).Insert(item)
+	err := ds.TC(CollectionNameItem).Insert(item)
 	return err
 }
 
 func SavePermission(ds *dbandmq.Ds, p *Permission) error {
-	return ds.C(CollectionNamePermission).Insert(p)
+	return ds.TC(CollectionNamePermission).Insert(p)
 }
 
 func SaveRole(ds *dbandmq.Ds, role *Role) error {
-	return ds.C(CollectionNameRole).Insert(role)
+	return ds.TC(CollectionNameRole).Insert(role)
 }
 
 func SaveRoleAndUser(ds *dbandmq.Ds, r *RoleAndUser) error {
-	return ds.C(CollectionNameRoleAndUser).Insert(r)
+	return ds.TC(CollectionNameRoleAndUser).Insert(r)
 }
 
 // 管理员那一套
@@ -118,6 +118,7 @@ func insureAdmin(ds *dbandmq.Ds) error {
 		Method:  "*",
 		Path:    "*",
 		Group:   ItemGroupSystem,
+		Type:    ItemTypeApi,
 		Deleted: false,
 		Source:  RoleDataSourceInternal,
 		CreateT: curT,
@@ -366,6 +367,58 @@ func insureRoleAppItems(ds *dbandmq.Ds, uriPrefix string) error {
 	item = GenerateItem(curT, "roleapp:queryrole", "GET", uriPrefix+"/role/m/roles")
 	items = append(items, item)
 
+	// 复制 role
+	item = GenerateItem(curT, "roleapp:clonerole", "POST", uriPrefix+"/role/m/role/:id/clone")
+	items = append(items, item)
+
+	// 新建 role 模板
+	item = GenerateItem(curT, "roleapp:createroletemplate", "POST", uriPrefix+"/role/m/template")
+	items = append(items, item)
+
+	// 修改 role 模板
+	item = GenerateItem(curT, "roleapp:updateroletemplate", "PUT", uriPrefix+"/role/m/template/:id")
+	items = append(items, item)
+
+	// 删除 role 模板
+	item = GenerateItem(curT, "roleapp:deleteroletemplate", "DELETE", uriPrefix+"/role/m/template/:id")
+	items = append(items, item)
+
+	// 读取 role 模板明细
+	item = GenerateItem(curT, "roleapp:getroletemplate", "GET", uriPrefix+"/role/m/template/:id")
+	items = append(items, item)
+
+	// 实例化 role 模板
+	item = GenerateItem(curT, "roleapp:instantiateroletemplate", "POST", uriPrefix+"/role/m/template/:id/instantiate")
+	items = append(items, item)
+
+	// 同步 role 模板到实例
+	item = GenerateItem(curT, "roleapp:propagateroletemplate", "POST", uriPrefix+"/role/m/template/:id/propagate")
+	items = append(items, item)
+
+	// 搜索 role 模板
+	item = GenerateItem(curT, "roleapp:queryroletemplate", "GET", uriPrefix+"/role/m/templates")
+	items = append(items, item)
+
+	// 手动保存快照
+	item = GenerateItem(curT, "roleapp:createsnapshot", "POST", uriPrefix+"/role/m/snapshot")
+	items = append(items, item)
+
+	// 读取快照明细
+	item = GenerateItem(curT, "roleapp:getsnapshot", "GET", uriPrefix+"/role/m/snapshot/:id")
+	items = append(items, item)
+
+	// 回滚到快照
+	item = GenerateItem(curT, "roleapp:rollbacksnapshot", "POST", uriPrefix+"/role/m/snapshot/:id/rollback")
+	items = append(items, item)
+
+	// 搜索快照
+	item = GenerateItem(curT, "roleapp:querysnapshot", "GET", uriPrefix+"/role/m/snapshots")
+	items = append(items, item)
+
+	// 对比快照
+	item = GenerateItem(curT, "roleapp:diffsnapshot", "GET", uriPrefix+"/role/m/snapshots/diff")
+	items = append(items, item)
+
 	// 给 userid 添加 role
 	item = GenerateItem(curT, "roleapp:addroletouser", "POST", uriPrefix+"/rau/addroles")
 	items = append(items, item)
@@ -434,6 +487,7 @@ func GenerateItem(t *util.CurTime, name, method, path string) *Item {
 		Method:  method,
 		Path:    path,
 		Group:   ItemGroupSystem,
+		Type:    ItemTypeApi,
 		Deleted: false,
 		Source:  RoleDataSourceInternal,
 		CreateT: t,
@@ -24,7 +24,7 @@ func CreateSimpleDataHandler(c *gin.Context, ds *dbandmq.Ds) {
 		middleware.StopExec(ErrEmptyValue)
 	}
 
-	nds := ds.CopyDs()
+	nds := ds.CopyDs().WithContext(c.Request.Context())
 	defer nds.Close()
 
 	kp := getKeyPointer(c)
@@ -42,7 +42,7 @@ func CreateSimpleDataHandler(c *gin.Context, ds *dbandmq.Ds) {
 		Key:   kp.Key,
 		Value: value,
 	}
-	err = nds.C(CollectionNameSimpleData).Insert(sd)
+	err = nds.TC(CollectionNameSimpleData).Insert(sd)
 	middleware.StopExec(err)
 
 	returnfun.ReturnOKJson(c, sd)
@@ -64,7 +64,7 @@ func UpdateSimpleDataHandler(c *gin.Context, db *dbandmq.Ds) {
 
 	kp := getKeyPointer(c)
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	dbSd := &SimpleData{}
@@ -86,7 +86,7 @@ func UpdateSimpleDataHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	err = ds.C(CollectionNameSimpleData).UpdateId(dbSd.Id, update)
+	err = ds.TC(CollectionNameSimpleData).UpdateId(dbSd.Id, update)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -107,7 +107,7 @@ func DeleteSimpleDataHandler(c *gin.Context, db *dbandmq.Ds) {
 	middleware.StopExec(err)
 
 	kp := getKeyPointer(c)
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	dbSd := &SimpleData{}
@@ -129,7 +129,7 @@ func DeleteSimpleDataHandler(c *gin.Context, db *dbandmq.Ds) {
 		},
 	}
 
-	err = ds.C(CollectionNameSimpleData).UpdateId(dbSd.Id, update)
+	err = ds.TC(CollectionNameSimpleData).UpdateId(dbSd.Id, update)
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
 	}
@@ -142,7 +142,7 @@ func GetSimpleDataByIdHandler(c *gin.Context, db *dbandmq.Ds) {
 	id := c.Param("id")
 	kp := getKeyPointer(c)
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
 	sd, err := kp.GetSimpleDataById(ds, id)
@@ -167,10 +167,10 @@ func QuerySimpleDataHandler(c *gin.Context, db *dbandmq.Ds) {
 		"$and": andCondition,
 	}
 
-	ds := db.CopyDs()
+	ds := db.CopyDs().WithContext(c.Request.Context())
 	defer ds.Close()
 
-	Q := ds.C(CollectionNameSimpleData).Find(query)
+	Q := ds.TC(CollectionNameSimpleData).Find(query)
 	total, err := Q.Count()
 	if err != nil {
 		middleware.StopExec(middleware.ErrDbExec.Append(err.Error()))
@@ -0,0 +1,20 @@
+package simplecrud
+
+import "github.com/leyle/ginbase/i18n"
+
+// 错误信息，Append 追加的内容会原样拼接在后面
+const (
+	msgEmptyValue    = "simplecrud.emptyValue"
+	msgValueHasExist = "simplecrud.valueHasExist"
+)
+
+func init() {
+	i18n.Register(i18n.LangZh, map[string]string{
+		msgEmptyValue:    "值为空",
+		msgValueHasExist: "值已存在: ",
+	})
+	i18n.Register(i18n.LangEn, map[string]string{
+		msgEmptyValue:    ErrEmptyValue.Msg,
+		msgValueHasExist: ErrValueHasExist.Msg,
+	})
+}
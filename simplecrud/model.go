@@ -8,6 +8,7 @@ import (
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	. "github.com/leyle/ginbase/consolelog"
+	"net/http"
 )
 
 func init() {
@@ -17,16 +18,20 @@ func init() {
 var DbPrefix = "simplecrud_"
 
 // error code
-var ErrEmptyValue = &middleware.CustomErrStruct{
-	Code: 30001,
-	Msg:  "Value is null",
-}
+var ErrEmptyValue = middleware.RegisterErr(&middleware.CustomErrStruct{
+	Code:   30001,
+	Msg:    "Value is null",
+	Status: http.StatusBadRequest,
+	MsgKey: msgEmptyValue,
+})
 
 // name exist
-var ErrValueHasExist = &middleware.CustomErrStruct{
-	Code: 30002,
-	Msg:  "Name has exist: ",
-}
+var ErrValueHasExist = middleware.RegisterErr(&middleware.CustomErrStruct{
+	Code:   30002,
+	Msg:    "Name has exist: ",
+	Status: http.StatusConflict,
+	MsgKey: msgValueHasExist,
+})
 
 var CollectionNameSimpleData = DbPrefix + "simpledata"
 var IKSimpleData = &dbandmq.IndexKey{
@@ -58,7 +63,7 @@ func (k *KeyPointer) GetSimpleDataByName(ds *dbandmq.Ds, name string) (*SimpleDa
 		"deleted": false,
 	}
 
-	err := ds.C(CollectionNameSimpleData).Find(f).One(&sd)
+	err := ds.TC(CollectionNameSimpleData).Find(f).One(&sd)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "按name[%s]查询simpledata失败, %s", name, err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
@@ -74,7 +79,7 @@ func (k *KeyPointer) GetSimpleDataById(ds *dbandmq.Ds, id string) (*SimpleData,
 		"_id": id,
 		"deleted": false,
 	}
-	err := ds.C(CollectionNameSimpleData).Find(f).One(&sd)
+	err := ds.TC(CollectionNameSimpleData).Find(f).One(&sd)
 	if err != nil && err != mgo.ErrNotFound {
 		Logger.Errorf("", "按id[%s]查询simpledata失败, %s", id, err.Error())
 		return nil, middleware.ErrDbExec.Append(err.Error())
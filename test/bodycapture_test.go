@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/middleware"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyCapture(t *testing.T) {
+	var buf bytes.Buffer
+	consolelog.Logger.SetOutput(&buf)
+	defer consolelog.Logger.SetOutput(nil)
+
+	oldMax := middleware.MaxLogBodySize
+	middleware.MaxLogBodySize = 16
+	defer func() { middleware.MaxLogBodySize = oldMax }()
+
+	middleware.AddIgnoreBodyRule("GET", "/file/:id")
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.GinLogMiddleware())
+	e.POST("/echo", func(c *gin.Context) {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	e.GET("/file/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "file content not logged")
+	})
+	e.GET("/sse", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.String(http.StatusOK, "data: hello\n\n")
+	})
+
+	long := strings.Repeat("a", 100)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader(long))
+	req.Header.Set("Content-Type", "text/plain")
+	e.ServeHTTP(w, req)
+	if w.Body.String() != long {
+		t.Fatal("handler should read the full body", w.Body.Len())
+	}
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/file/1", nil))
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/sse", nil))
+
+	out := buf.String()
+	t.Log(out)
+	if strings.Contains(out, long) || !strings.Contains(out, "truncated, total 100 bytes") {
+		t.Error("body should be truncated")
+	}
+	if strings.Contains(out, "file content not logged") {
+		t.Error("ignored path body should not be logged")
+	}
+	if strings.Contains(out, "data: hello") || !strings.Contains(out, "[stream body") {
+		t.Error("sse body should not be logged")
+	}
+}
+
+func TestTruncatedJsonRedact(t *testing.T) {
+	var buf bytes.Buffer
+	consolelog.Logger.SetOutput(&buf)
+	defer consolelog.Logger.SetOutput(nil)
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.GinLogMiddleware())
+	e.POST("/login", func(c *gin.Context) {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/json", body)
+	})
+
+	// 超过 MaxLogBodySize 的 json，password 在截断之前，截断位置在另一个 password 的值中间
+	pad := strings.Repeat("x", middleware.MaxLogBodySize)
+	body := `{"loginId":"alice","password":"plain-secret-1","list":[{"token":"plain-secret-2"}],"pad":"` + pad + `"}`
+	cut := `{"a":"` + strings.Repeat("y", middleware.MaxLogBodySize-40) + `","password":"plain-secret-3-abcdefghijklmn"}`
+	for _, b := range []string{body, cut} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(w, req)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "plain-secret") {
+		t.Error("truncated json body leaks password", out)
+	}
+	if !strings.Contains(out, `"loginId":"alice","password":"***","list":[{"token":"***"}]`) || !strings.Contains(out, "truncated") {
+		t.Error("truncated json body should be redacted by field", out)
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.NewCORSMiddleware(&middleware.CORSOption{
+		AllowOrigins:       []string{"https://app.example.com", "https://*.example.org"},
+		AllowOriginRegexps: []string{`https://pr-\d+\.preview\.example\.net`},
+		AllowHeaders:       []string{"Content-Type", "Authorization"},
+		ExposeHeaders:      []string{"X-Request-Id"},
+		AllowCredentials:   true,
+		MaxAge:             time.Hour,
+	}))
+	e.GET("/api/data", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	public := e.Group("/public")
+	public.GET("/data", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	if err := middleware.GroupCORS(public, middleware.DefaultCORSOption()); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, origin string, preflight bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	allowed := []string{"https://app.example.com", "https://a.example.org", "https://a.b.example.org", "https://pr-12.preview.example.net"}
+	for _, origin := range allowed {
+		w := do("GET", "/api/data", origin, false)
+		if w.Header().Get("Access-Control-Allow-Origin") != origin || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Error("origin should be allowed", origin, w.Header())
+		}
+		if w.Header().Get("Vary") != "Origin" || w.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+			t.Error("should set Vary and expose headers", w.Header())
+		}
+	}
+
+	denied := []string{"https://example.org", "https://evil.com", "https://evil.com/.example.org", "https://pr-x.preview.example.net", "https://pr-1.preview.example.net.evil.com"}
+	for _, origin := range denied {
+		w := do("GET", "/api/data", origin, false)
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Error("origin should be denied", origin)
+		}
+	}
+
+	w := do("OPTIONS", "/api/data", "https://app.example.com", true)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Max-Age") != "3600" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "Content-Type,Authorization" {
+		t.Error("unexpected preflight response", w.Code, w.Header())
+	}
+	if w = do("OPTIONS", "/api/data", "https://evil.com", true); w.Code != http.StatusForbidden {
+		t.Error("preflight from denied origin should be rejected", w.Code)
+	}
+
+	// group 覆盖
+	w = do("GET", "/public/data", "https://evil.com", false)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("group override should allow all origins without credentials", w.Header())
+	}
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrCodeRegistry(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("duplicated code should panic")
+			}
+		}()
+		middleware.RegisterErr(&middleware.CustomErrStruct{Code: middleware.ErrDbExec.Code, Msg: "dup"})
+	}()
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.RecoveryMiddleware(middleware.DefaultStopExecHandler))
+	e.GET("/db", func(c *gin.Context) {
+		middleware.StopExec(middleware.ErrDbExec.Append("connection lost"))
+	})
+	e.GET("/nil", func(c *gin.Context) {
+		var m map[string]int
+		m["a"] = 1
+	})
+	e.GET("/unregistered", func(c *gin.Context) {
+		middleware.StopExec(ErrInvalidMonth)
+	})
+	middleware.ErrCodeRouter(e.Group(""))
+
+	cases := []struct {
+		path   string
+		status int
+		code   int
+	}{
+		{"/db", http.StatusInternalServerError, 5000},
+		{"/nil", http.StatusInternalServerError, middleware.ErrInternal.Code},
+		{"/unregistered", http.StatusBadRequest, 4002},
+	}
+	for _, cs := range cases {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", cs.path, nil))
+		var ret struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &ret)
+		if w.Code != cs.status || ret.Code != cs.code {
+			t.Error("unexpected response", cs.path, w.Code, w.Body.String())
+		}
+		if strings.Contains(ret.Msg, "runtime") {
+			t.Error("runtime error should not be returned to client", ret.Msg)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/errcodes?format=markdown", nil))
+	if !strings.Contains(w.Body.String(), "| 5000 | 500 | Database execute failed |") {
+		t.Error("markdown should list registered codes", w.Body.String())
+	}
+}
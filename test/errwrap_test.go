@@ -0,0 +1,75 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errMgoNotFound = errors.New("not found")
+
+func TestErrWrap(t *testing.T) {
+	err := middleware.ErrDbExec.Wrap(errMgoNotFound)
+	wrapped := fmt.Errorf("load user: %w", err)
+
+	if !errors.Is(wrapped, middleware.ErrDbExec) || !errors.Is(wrapped, errMgoNotFound) {
+		t.Error("errors.Is should match sentinel and cause")
+	}
+	if errors.Is(wrapped, middleware.ErrNoIdData) {
+		t.Error("errors.Is should not match other codes")
+	}
+	if middleware.ErrDbExec.Cause != nil {
+		t.Error("sentinel should not be modified")
+	}
+	if !strings.Contains(middleware.ErrStack(wrapped), "TestErrWrap") {
+		t.Error("stack should be captured at creation", middleware.ErrStack(wrapped))
+	}
+	if chain := middleware.ErrChain(middleware.ErrNoIdData.Wrap(err)); !strings.HasPrefix(chain, "40000|No data for this id:  -> 5000|") ||
+		!strings.HasSuffix(chain, "not found(*errors.errorString)") {
+		t.Error("unexpected chain", chain)
+	}
+
+	cerr := middleware.ParseCustomErr(wrapped)
+	if cerr.Code != middleware.ErrDbExec.Code || cerr.Msg != middleware.ErrDbExec.Msg {
+		t.Error("ParseCustomErr should use errors.As", cerr)
+	}
+	// 旧的字符串格式仍然兼容，| 前面不是数字时整体作为 msg
+	if cerr := middleware.ParseCustomErr(errors.New("4003|bad month")); cerr.Code != 4003 || cerr.Msg != "bad month" {
+		t.Error("legacy format should be parsed", cerr)
+	}
+	if cerr := middleware.ParseCustomErr(errors.New("a|b")); cerr.Code != middleware.DefaultCustomErrCode || cerr.Msg != "a|b" {
+		t.Error("message with | should be kept", cerr)
+	}
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.RecoveryMiddleware(middleware.DefaultStopExecHandler))
+	e.GET("/detail", func(c *gin.Context) {
+		middleware.StopExec(fmt.Errorf("check: %w", middleware.ErrDefault.
+			WithDetail("limit", 10).
+			WithFields(&middleware.FieldError{Field: "name", Rule: "required", Msg: "name is required"})))
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/detail", nil))
+	var ret struct {
+		Code int `json:"code"`
+		Data struct {
+			Details map[string]interface{}   `json:"details"`
+			Fields  []*middleware.FieldError `json:"fields"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+	if w.Code != http.StatusBadRequest || ret.Code != middleware.ErrDefault.Code ||
+		ret.Data.Details["limit"] != float64(10) || len(ret.Data.Fields) != 1 || ret.Data.Fields[0].Field != "name" {
+		t.Error("unexpected response", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/i18n"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestI18n(t *testing.T) {
+	i18n.Register(i18n.LangZh, map[string]string{"test.notFound": "找不到 %s"})
+	i18n.Register(i18n.LangEn, map[string]string{"test.notFound": "%s not found"})
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.RecoveryMiddleware(middleware.DefaultStopExecHandler))
+	e.GET("/db", func(c *gin.Context) {
+		middleware.StopExec(middleware.ErrDbExec.Append("timeout"))
+	})
+	e.GET("/override", func(c *gin.Context) {
+		middleware.StopExec(middleware.ErrDefault.WithMsg("custom"))
+	})
+	e.GET("/message", func(c *gin.Context) {
+		middleware.StopExec(i18n.New("test.notFound", "a"))
+	})
+	e.GET("/key", func(c *gin.Context) {
+		returnfun.ReturnErrKeyJson(c, "test.notFound", "b")
+	})
+
+	cases := []struct {
+		uri, lang, msg string
+	}{
+		{"/db", "", "Database execute failed: timeout"},
+		{"/db", "fr", "Database execute failed: timeout"},
+		{"/db", "zh-CN", "数据库执行失败: timeout"},
+		{"/db", "en-US,en;q=0.9", "Database execute failed: timeout"},
+		{"/db?lang=zh", "en", "数据库执行失败: timeout"},
+		{"/override", "en", "custom"},
+		{"/message", "en", "a not found"},
+		{"/message", "", "找不到 a"},
+		{"/key", "en", "b not found"},
+	}
+	for _, cs := range cases {
+		req := httptest.NewRequest("GET", cs.uri, nil)
+		req.Header.Set("Accept-Language", cs.lang)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		var ret struct {
+			Msg string `json:"msg"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &ret)
+		if ret.Msg != cs.msg {
+			t.Error("unexpected msg", cs.uri, cs.lang, ret.Msg)
+		}
+	}
+}
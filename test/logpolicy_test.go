@@ -0,0 +1,91 @@
+package test
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/middleware"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogPolicy(t *testing.T) {
+	var buf bytes.Buffer
+	consolelog.Logger.SetOutput(&buf)
+	defer consolelog.Logger.SetOutput(nil)
+
+	middleware.AddRouteLogPolicy("POST", "/policy/:status", &middleware.LogPolicy{
+		SlowThreshold: 50 * time.Millisecond,
+		SampleRate:    0,
+	})
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.GinLogMiddleware())
+	e.POST("/policy/:status", func(c *gin.Context) {
+		if c.Query("force") != "" {
+			middleware.ForceLog(c)
+		}
+		if c.Query("slow") != "" {
+			time.Sleep(60 * time.Millisecond)
+		}
+		if c.Param("status") == "ok" {
+			c.String(http.StatusOK, "ok-resp-body")
+			return
+		}
+		c.String(http.StatusBadRequest, "bad-resp-body")
+	})
+
+	do := func(uri, body string) string {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", uri, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		e.ServeHTTP(w, req)
+		return buf.String()
+	}
+
+	// 统计脱敏的次数，不记录的 body 不需要脱敏
+	redactN := 0
+	oldRedactor := middleware.LogRedactor
+	middleware.LogRedactor = middleware.NewRedactor()
+	middleware.LogRedactor.AddPatterns(&middleware.RedactPattern{
+		Name:  "count",
+		Re:    regexp.MustCompile(`-body$`),
+		Check: func(s string) bool { redactN++; return false },
+	})
+	defer func() { middleware.LogRedactor = oldRedactor }()
+
+	out := do("/policy/ok", "ok-req-body")
+	if strings.Contains(out, "ok-req-body") || strings.Contains(out, "ok-resp-body") {
+		t.Error("2xx body should not be logged", out)
+	}
+	if redactN != 0 {
+		t.Error("suppressed body should not be redacted", redactN)
+	}
+	if !strings.Contains(out, "[Req]") || !strings.Contains(out, "[Resp]") {
+		t.Error("summary should be logged", out)
+	}
+
+	out = do("/policy/bad", "bad-req-body")
+	if !strings.Contains(out, "bad-req-body") || !strings.Contains(out, "bad-resp-body") {
+		t.Error("non-2xx body should be logged", out)
+	}
+	if redactN != 2 {
+		t.Error("logged bodies should be redacted", redactN)
+	}
+
+	out = do("/policy/ok?slow=1", "slow-req-body")
+	if !strings.Contains(out, "slow-req-body") {
+		t.Error("slow request body should be logged", out)
+	}
+
+	out = do("/policy/ok?force=1", "force-req-body")
+	if !strings.Contains(out, "force-req-body") {
+		t.Error("forced request body should be logged", out)
+	}
+}
@@ -0,0 +1,158 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/metrics"
+	"github.com/leyle/ginbase/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type chanAlertHook chan *middleware.PanicReport
+
+func (h chanAlertHook) Name() string {
+	return "chan"
+}
+
+func (h chanAlertHook) Alert(r *middleware.PanicReport) error {
+	h <- r
+	return nil
+}
+
+func TestPanicReport(t *testing.T) {
+	var buf bytes.Buffer
+	consolelog.Logger.SetOutput(&buf)
+	consolelog.Logger.SetFormat(consolelog.FormatJson)
+	defer func() {
+		consolelog.Logger.SetOutput(nil)
+		consolelog.Logger.SetFormat(consolelog.FormatText)
+	}()
+
+	oldUserIdFunc, oldInterval := middleware.CurUserIdFunc, middleware.AlertInterval
+	middleware.CurUserIdFunc = func(c *gin.Context) string { return "u1" }
+	middleware.AlertInterval = time.Hour
+	defer func() {
+		middleware.CurUserIdFunc, middleware.AlertInterval = oldUserIdFunc, oldInterval
+	}()
+
+	hook := make(chanAlertHook, 10)
+	middleware.AddAlertHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.RecoveryMiddleware(middleware.DefaultStopExecHandler))
+	e.GET("/nil", func(c *gin.Context) {
+		var m map[string]int
+		m["a"] = 1
+	})
+	e.GET("/stop", func(c *gin.Context) {
+		middleware.StopExec(middleware.ErrDbExec.Append("x"))
+	})
+
+	get := func(uri string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", uri, nil))
+		return w
+	}
+
+	w := get("/nil")
+	if w.Code != http.StatusInternalServerError {
+		t.Error("unexpected status", w.Code)
+	}
+	reqId := w.Header().Get("X-Request-Id")
+
+	var r *middleware.PanicReport
+	select {
+	case r = <-hook:
+	case <-time.After(time.Second):
+		t.Fatal("alert not fired")
+	}
+	if r.ReqId != reqId || r.Method != "GET" || r.Path != "/nil" || r.UserId != "u1" || r.Kind != "runtime" ||
+		!strings.Contains(r.Location, "panicreport_test.go") || !strings.Contains(r.Stack, "TestPanicReport") {
+		t.Error("unexpected report", r.ReqId, r.Method, r.Path, r.UserId, r.Kind, r.Location)
+	}
+
+	var entry map[string]interface{}
+	line := strings.SplitN(buf.String(), "\n", 2)[0]
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatal(err, line)
+	}
+	if entry["reqId"] != reqId || entry["userId"] != "u1" || entry["path"] != "/nil" ||
+		!strings.Contains(entry["stack"].(string), "panicreport_test.go") {
+		t.Error("unexpected log", line)
+	}
+
+	// 重复的 panic 只记录日志，StopExec 的错误不告警
+	get("/nil")
+	get("/stop")
+	select {
+	case r = <-hook:
+		t.Error("duplicated alert", r.Path)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if strings.Count(buf.String(), "请求 panic") != 2 {
+		t.Error("every panic should be logged", buf.String())
+	}
+	var mbuf bytes.Buffer
+	_, _ = metrics.DefaultRegistry.WriteTo(&mbuf)
+	if strings.Contains(mbuf.String(), `ginbase_panics_total{kind="error"}`) {
+		t.Error("StopExec errors should not be counted as panics", mbuf.String())
+	}
+
+	middleware.AlertInterval = 0
+	get("/nil")
+	select {
+	case r = <-hook:
+		if r.Suppressed != 1 {
+			t.Error("suppressed count should be reported", r.Suppressed)
+		}
+	case <-time.After(time.Second):
+		t.Error("alert should be fired after interval")
+	}
+}
+
+func TestStopExecPanicError(t *testing.T) {
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !errors.Is(err, middleware.ErrDbExec) || !strings.Contains(err.Error(), "x") {
+			t.Error("StopExec panic should be an error wrapping the original", err)
+		}
+	}()
+	middleware.StopExec(middleware.ErrDbExec.Append("x"))
+}
+
+func TestNonStopExecPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.RecoveryMiddleware(middleware.DefaultStopExecHandler))
+	e.GET("/str", func(c *gin.Context) {
+		panic("secret detail")
+	})
+	e.GET("/err", func(c *gin.Context) {
+		panic(errors.New("secret detail"))
+	})
+	e.GET("/stop", func(c *gin.Context) {
+		middleware.StopExec(middleware.ErrNoIdData.Append("x"))
+	})
+
+	for _, uri := range []string{"/str", "/err"} {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", uri, nil))
+		if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "secret") {
+			t.Error("panic should be returned as internal error", uri, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/stop", nil))
+	if w.Code == http.StatusInternalServerError {
+		t.Error("StopExec error should keep its status", w.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package test
+
+import (
+	"github.com/leyle/ginbase/middleware"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r := middleware.NewDefaultRedactor()
+
+	body := `{"loginId":"alice","passwd":"123456789","user":{"phone":"13812345678","cards":[{"cardNo":"6222020200112233445"}]},"data":{"key":"gbk_0123456789ab_secret"}}`
+	ret := r.Body("application/json; charset=utf-8", []byte(body))
+	t.Log(ret)
+	for _, leak := range []string{"123456789", "13812345678", "6222020200112233445", "gbk_0123456789ab_secret"} {
+		if strings.Contains(ret, leak) {
+			t.Error("json body leaks", leak)
+		}
+	}
+	if !strings.Contains(ret, `"loginId":"alice"`) || !strings.Contains(ret, "138***5678") {
+		t.Error("bad json redaction", ret)
+	}
+
+	form := r.Body("application/x-www-form-urlencoded", []byte("loginId=alice&password=abc&mobile=13812345678"))
+	if strings.Contains(form, "abc") || strings.Contains(form, "13812345678") {
+		t.Error("form body leaks", form)
+	}
+
+	if r.Header("authorization", "Bearer xxx") != r.Mask {
+		t.Error("authorization header should be masked")
+	}
+
+	// 通过 Luhn 校验的才是银行卡号，时间戳与数字 id 不脱敏
+	text := r.Text("card 4111111111111111 id 1603782245123456 idcard 11010519491231002X")
+	if text != "card 411***1111 id 1603782245123456 idcard 110***002X" {
+		t.Error("bad text redaction", text)
+	}
+	if !middleware.LuhnValid("4111111111111111") || middleware.LuhnValid("1603782245123456") {
+		t.Error("bad luhn check")
+	}
+
+	uri := r.URI("/api/login?token=abc&page=1")
+	if strings.Contains(uri, "abc") || !strings.Contains(uri, "page=1") {
+		t.Error("bad uri redaction", uri)
+	}
+}
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/tracing"
+	"github.com/leyle/ginbase/util"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReqIdAndTrace(t *testing.T) {
+	// 下游服务，记录收到的 header
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer ts.Close()
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware())
+	e.GET("/call", func(c *gin.Context) {
+		resp, err := util.HttpGet(ts.URL, nil, nil, c)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp.Body.Close()
+		c.String(http.StatusOK, middleware.GetReqId(c))
+	})
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/call", nil)
+	req.Header.Set("X-Request-Id", "gw-123.abc")
+	req.Header.Set("traceparent", parent)
+	req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	e.ServeHTTP(w, req)
+
+	if w.Body.String() != "gw-123.abc" || w.Header().Get("X-Request-Id") != "gw-123.abc" {
+		t.Fatal("should accept inbound request id", w.Body.String())
+	}
+	if got.Get("X-Request-Id") != "gw-123.abc" {
+		t.Error("request id should be propagated", got)
+	}
+	tp := got.Get("traceparent")
+	if !strings.HasPrefix(tp, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || tp == parent || !strings.HasSuffix(tp, "-01") {
+		t.Error("trace id should be kept with a new span id", tp)
+	}
+	if got.Get("tracestate") != "congo=t61rcWkgMzE" {
+		t.Error("tracestate should be propagated", got.Get("tracestate"))
+	}
+
+	// 非法的请求号与 traceparent 重新生成
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/call", nil)
+	req.Header.Set("X-Request-Id", "bad id\nforged log line")
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	e.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), "bad") || len(w.Body.String()) != 24 {
+		t.Error("invalid request id should be replaced", w.Body.String())
+	}
+	if strings.Contains(got.Get("traceparent"), "00000000000000000000000000000000") || got.Get("tracestate") != "" {
+		t.Error("invalid traceparent should start a new trace", got)
+	}
+}
+
+type spanRecorder struct {
+	lock  sync.Mutex
+	spans []*tracing.Span
+}
+
+func (r *spanRecorder) Export(s *tracing.Span) error {
+	r.lock.Lock()
+	r.spans = append(r.spans, s)
+	r.lock.Unlock()
+	return nil
+}
+
+func (r *spanRecorder) Close() error {
+	return nil
+}
+
+func TestGinTracing(t *testing.T) {
+	rec := &spanRecorder{}
+	old := tracing.SetExporter(rec)
+	defer tracing.SetExporter(old)
+
+	var downstream string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstream = r.Header.Get("traceparent")
+	}))
+	defer ts.Close()
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware())
+	e.POST("/trace", func(c *gin.Context) {
+		resp, err := util.HttpPost(ts.URL+"?secret=1", nil, nil, c)
+		if err == nil {
+			resp.Body.Close()
+		}
+		c.Status(http.StatusInternalServerError)
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("POST", "/trace", nil))
+
+	if len(rec.spans) != 2 {
+		t.Fatal("should export server and client spans", len(rec.spans))
+	}
+	client, server := rec.spans[0], rec.spans[1]
+	if server.Kind != tracing.KindServer || server.Error == "" || server.Attrs["http.status"] != http.StatusInternalServerError {
+		t.Error("unexpected server span", server)
+	}
+	if client.Kind != tracing.KindClient || client.ParentId != server.SpanId || client.TraceId != server.TraceId {
+		t.Error("client span should be a child of the server span", client)
+	}
+	if downstream != client.TraceParent() {
+		t.Error("downstream should receive the client span id", downstream)
+	}
+	if strings.Contains(client.Attrs["http.url"].(string), "secret") {
+		t.Error("query should not be recorded", client.Attrs)
+	}
+}
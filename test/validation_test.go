@@ -0,0 +1,90 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/ginbase/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type validationItem struct {
+	Name string `json:"name" binding:"required,max=4"`
+}
+
+type validationForm struct {
+	Method string            `json:"method" binding:"required,httpmethod"`
+	Path   string            `json:"path" binding:"omitempty,rolepath"`
+	Ids    []string          `json:"ids" binding:"dive,objectid"`
+	Age    int               `json:"age" binding:"gte=18"`
+	Items  []*validationItem `json:"items" binding:"dive"`
+}
+
+func TestValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(middleware.ReqIdMiddleware(), middleware.RecoveryMiddleware(middleware.DefaultStopExecHandler))
+	e.POST("/form", func(c *gin.Context) {
+		var form validationForm
+		err := c.ShouldBindJSON(&form)
+		middleware.StopExec(err)
+		c.String(http.StatusOK, "ok")
+	})
+
+	type fieldErr struct {
+		Field string `json:"field"`
+		Rule  string `json:"rule"`
+		Param string `json:"param"`
+		Msg   string `json:"msg"`
+	}
+	post := func(body, lang string) (int, int, []fieldErr) {
+		req := httptest.NewRequest("POST", "/form", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		var ret struct {
+			Code int `json:"code"`
+			Data struct {
+				Fields []fieldErr `json:"fields"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &ret)
+		return w.Code, ret.Code, ret.Data.Fields
+	}
+
+	status, _, _ := post(`{"method":"get","path":"/api/role/*/items","ids":["5d7b3c1e2f8a4b0001a1b2c3"],"age":18,"items":[{"name":"ab"}]}`, "")
+	if status != http.StatusOK {
+		t.Fatal("valid form should pass", status)
+	}
+
+	status, code, fields := post(`{"method":"fetch","path":"api(","ids":["1"],"age":1,"items":[{"name":"abcde"}]}`, "zh-CN,zh;q=0.9")
+	if status != http.StatusBadRequest || code != middleware.ErrValidation.Code || len(fields) != 5 {
+		t.Fatal("unexpected response", status, code, fields)
+	}
+	// 按字段排序
+	expected := []fieldErr{
+		{Field: "age", Rule: "gte", Param: "18", Msg: "age 不能小于 18"},
+		{Field: "ids[0]", Rule: "objectid", Msg: "ids[0] 不是合法的 id"},
+		{Field: "items[0].name", Rule: "max", Param: "4", Msg: "items[0].name 长度不能大于 4"},
+		{Field: "method", Rule: "httpmethod", Msg: "method 不是合法的 http 方法"},
+		{Field: "path", Rule: "rolepath", Msg: "path 不是合法的路径，必须为 * 或者以 / 开头"},
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Error("unexpected field error", fields[i], expected[i])
+		}
+	}
+
+	_, _, fields = post(`{"path":"/a","age":20}`, "en-US")
+	if len(fields) != 1 || fields[0].Msg != "method is required" {
+		t.Error("unexpected english message", fields)
+	}
+
+	_, code, fields = post(`{"method":"GET","age":"x"}`, "en")
+	if code != middleware.ErrValidation.Code || len(fields) != 1 || fields[0].Field != "age" || fields[0].Rule != "type" {
+		t.Error("json type error should be a field error", code, fields)
+	}
+}
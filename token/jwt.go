@@ -0,0 +1,327 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/leyle/ginbase/roleapp"
+	"github.com/leyle/ginbase/util"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// 默认有效期
+const DefaultExpire = 2 * time.Hour
+
+var (
+	ErrNoExpire      = errors.New("token has no expiration")
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrUnknownKid    = errors.New("unknown key id")
+	ErrBadSignature  = errors.New("token signature is invalid")
+	ErrTokenExpired  = errors.New("token has expired")
+	ErrTokenNotValid = errors.New("token is not valid yet")
+	ErrBadIssuer     = errors.New("token issuer is invalid")
+	ErrBadAudience   = errors.New("token audience is invalid")
+	ErrTokenRevoked  = errors.New("token has been revoked")
+)
+
+type JwtOption struct {
+	Issuer   string   `json:"issuer" yaml:"issuer"`
+	Audience []string `json:"audience" yaml:"audience"` // 签发时写入，验证时要求至少匹配一个
+	Expire   int64    `json:"expire" yaml:"expire"`     // 签发的有效期，单位秒，为 0 时使用 DefaultExpire
+	Leeway   int64    `json:"leeway" yaml:"leeway"`     // 验证 exp nbf 时允许的时钟偏差，单位秒
+
+	// 为 true 时接受没有 exp 的 token，视为永不过期，默认拒绝
+	AllowNoExpire bool `json:"allowNoExpire" yaml:"allowNoExpire"`
+
+	// 签发使用的 kid，为空时使用 Keys 中第一个能签名的 key
+	// 轮换时新增 key 并修改 SigningKid，旧 key 保留到已签发的 token 全部过期
+	SigningKid string       `json:"signingKid" yaml:"signingKid"`
+	Keys       []*KeyOption `json:"keys" yaml:"keys"`
+}
+
+// 可以是单个字符串或者字符串数组
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return err
+	}
+	*a = ss
+	return nil
+}
+
+type Claims struct {
+	Id        string   `json:"jti,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"` // userId
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+
+	Name  string                 `json:"name,omitempty"`
+	Roles []*roleapp.SimpleRole  `json:"roles,omitempty"`
+	Extra map[string]interface{} `json:"ext,omitempty"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type JwtManager struct {
+	opt     *JwtOption
+	r       *redis.Client // 为 nil 时不检查吊销
+	keys    map[string]*signKey
+	signing *signKey
+}
+
+func NewJwtManager(opt *JwtOption, r *redis.Client) (*JwtManager, error) {
+	if len(opt.Keys) == 0 {
+		return nil, errors.New("no jwt key configured")
+	}
+
+	m := &JwtManager{
+		opt:  opt,
+		r:    r,
+		keys: make(map[string]*signKey),
+	}
+
+	for _, ko := range opt.Keys {
+		k, err := newSignKey(ko)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m.keys[k.kid]; ok {
+			return nil, fmt.Errorf("duplicate key id: %s", k.kid)
+		}
+		m.keys[k.kid] = k
+
+		if m.signing == nil && k.canSign() && (opt.SigningKid == "" || opt.SigningKid == k.kid) {
+			m.signing = k
+		}
+	}
+
+	if opt.SigningKid != "" && m.signing == nil {
+		return nil, fmt.Errorf("signing key[%s] not found or has no private key", opt.SigningKid)
+	}
+
+	return m, nil
+}
+
+// 签发的 jwt 的有效期
+func (m *JwtManager) Expire() time.Duration {
+	if m.opt.Expire <= 0 {
+		return DefaultExpire
+	}
+	return time.Duration(m.opt.Expire) * time.Second
+}
+
+func randomJti() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// 签发 token，未设置的 jti iss aud iat exp 使用配置补全
+func (m *JwtManager) Issue(c *Claims) (string, error) {
+	if m.signing == nil {
+		return "", errors.New("no signing key configured")
+	}
+
+	now := util.CurUnixTime()
+	if c.Id == "" {
+		c.Id = randomJti()
+	}
+	if c.Issuer == "" {
+		c.Issuer = m.opt.Issuer
+	}
+	if len(c.Audience) == 0 {
+		c.Audience = m.opt.Audience
+	}
+	if c.IssuedAt == 0 {
+		c.IssuedAt = now
+	}
+	if c.ExpiresAt == 0 {
+		c.ExpiresAt = now + int64(m.Expire()/time.Second)
+	}
+
+	k := m.signing
+	h, _ := json.Marshal(&header{Alg: k.alg, Kid: k.kid, Typ: "JWT"})
+	p, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	input := b64(h) + "." + b64(p)
+	sig, err := k.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64(sig), nil
+}
+
+// 验证签名与各项声明，通过后返回 claims
+func (m *JwtManager) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	if err = json.Unmarshal(hb, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	k, ok := m.keys[h.Kid]
+	if !ok {
+		return nil, ErrUnknownKid
+	}
+	// 算法必须与 key 配置一致，防止算法替换攻击
+	if h.Alg != k.alg {
+		return nil, ErrBadSignature
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !k.verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrBadSignature
+	}
+
+	pb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c *Claims
+	// Audience 的 UnmarshalJSON 兼容字符串与数组
+	if err = json.Unmarshal(pb, &c); err != nil || c == nil {
+		return nil, ErrInvalidToken
+	}
+
+	if err = m.validate(c); err != nil {
+		return nil, err
+	}
+
+	revoked, err := m.IsRevoked(c.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return c, nil
+}
+
+func (m *JwtManager) validate(c *Claims) error {
+	now := util.CurUnixTime()
+	leeway := m.opt.Leeway
+
+	if c.ExpiresAt <= 0 && !m.opt.AllowNoExpire {
+		return ErrNoExpire
+	}
+	if c.ExpiresAt > 0 && now > c.ExpiresAt+leeway {
+		return ErrTokenExpired
+	}
+	if c.NotBefore > 0 && now+leeway < c.NotBefore {
+		return ErrTokenNotValid
+	}
+	if m.opt.Issuer != "" && c.Issuer != m.opt.Issuer {
+		return ErrBadIssuer
+	}
+	if len(m.opt.Audience) > 0 {
+		matched := false
+		for _, aud := range c.Audience {
+			for _, want := range m.opt.Audience {
+				if aud == want {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return ErrBadAudience
+		}
+	}
+	return nil
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (k *signKey) sign(input []byte) ([]byte, error) {
+	hasher := k.hash.New()
+	switch k.alg[:2] {
+	case "HS":
+		mac := hmac.New(k.hash.New, k.secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case "RS":
+		if k.rsaPri == nil {
+			return nil, fmt.Errorf("key[%s] has no private key", k.kid)
+		}
+		hasher.Write(input)
+		return rsa.SignPKCS1v15(rand.Reader, k.rsaPri, k.hash, hasher.Sum(nil))
+	case "ES":
+		if k.ecPri == nil {
+			return nil, fmt.Errorf("key[%s] has no private key", k.kid)
+		}
+		hasher.Write(input)
+		r, s, err := ecdsa.Sign(rand.Reader, k.ecPri, hasher.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
+		// jws 使用定长的 r||s，而不是 asn.1
+		size := (k.ecPri.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rb):size], rb)
+		copy(sig[2*size-len(sb):], sb)
+		return sig, nil
+	}
+	return nil, fmt.Errorf("unsupported alg: %s", k.alg)
+}
+
+func (k *signKey) verify(input, sig []byte) bool {
+	hasher := k.hash.New()
+	switch k.alg[:2] {
+	case "HS":
+		mac := hmac.New(k.hash.New, k.secret)
+		mac.Write(input)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case "RS":
+		hasher.Write(input)
+		return rsa.VerifyPKCS1v15(k.rsaPub, k.hash, hasher.Sum(nil), sig) == nil
+	case "ES":
+		size := (k.ecPub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		hasher.Write(input)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k.ecPub, hasher.Sum(nil), r, s)
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// 支持的签名算法
+const (
+	AlgHS256 = "HS256"
+	AlgHS384 = "HS384"
+	AlgHS512 = "HS512"
+	AlgRS256 = "RS256"
+	AlgRS384 = "RS384"
+	AlgRS512 = "RS512"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+	AlgES512 = "ES512"
+)
+
+// 配置中的一个 key
+// HMAC 使用 secret，RSA/ECDSA 使用 pem 格式的 key，可以是 pem 内容或者文件路径
+// 只有公钥的 key 只能用于验证
+type KeyOption struct {
+	Kid        string `json:"kid" yaml:"kid"`
+	Alg        string `json:"alg" yaml:"alg"`
+	Secret     string `json:"secret" yaml:"secret"`
+	PrivateKey string `json:"privatekey" yaml:"privatekey"`
+	PublicKey  string `json:"publickey" yaml:"publickey"`
+}
+
+type signKey struct {
+	kid    string
+	alg    string
+	hash   crypto.Hash
+	secret []byte
+	rsaPri *rsa.PrivateKey
+	rsaPub *rsa.PublicKey
+	ecPri  *ecdsa.PrivateKey
+	ecPub  *ecdsa.PublicKey
+}
+
+func (k *signKey) canSign() bool {
+	return len(k.secret) > 0 || k.rsaPri != nil || k.ecPri != nil
+}
+
+func algHash(alg string) (crypto.Hash, error) {
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported alg: %s", alg)
+}
+
+// pem 内容或者文件路径
+func readPem(val string) ([]byte, error) {
+	var data []byte
+	if strings.HasPrefix(strings.TrimSpace(val), "-----BEGIN") {
+		data = []byte(val)
+	} else {
+		var err error
+		data, err = ioutil.ReadFile(val)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid pem data")
+	}
+	return block.Bytes, nil
+}
+
+func parsePrivateKey(val string) (crypto.PrivateKey, error) {
+	der, err := readPem(val)
+	if err != nil {
+		return nil, err
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(der); err == nil {
+		return k, nil
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+func parsePublicKey(val string) (crypto.PublicKey, error) {
+	der, err := readPem(val)
+	if err != nil {
+		return nil, err
+	}
+	if k, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return k, nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return cert.PublicKey, nil
+}
+
+func newSignKey(opt *KeyOption) (*signKey, error) {
+	alg := strings.ToUpper(opt.Alg)
+	if len(alg) != 5 {
+		return nil, fmt.Errorf("unsupported alg: %s", opt.Alg)
+	}
+	h, err := algHash(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &signKey{
+		kid:  opt.Kid,
+		alg:  alg,
+		hash: h,
+	}
+
+	switch alg[:2] {
+	case "HS":
+		if opt.Secret == "" {
+			return nil, fmt.Errorf("key[%s] missing secret", opt.Kid)
+		}
+		k.secret = []byte(opt.Secret)
+	case "RS", "ES":
+		if opt.PrivateKey != "" {
+			pri, err := parsePrivateKey(opt.PrivateKey)
+			if err != nil {
+				return nil, fmt.Errorf("key[%s] parse private key failed, %s", opt.Kid, err.Error())
+			}
+			switch pk := pri.(type) {
+			case *rsa.PrivateKey:
+				k.rsaPri, k.rsaPub = pk, &pk.PublicKey
+			case *ecdsa.PrivateKey:
+				k.ecPri, k.ecPub = pk, &pk.PublicKey
+			}
+		} else if opt.PublicKey != "" {
+			pub, err := parsePublicKey(opt.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("key[%s] parse public key failed, %s", opt.Kid, err.Error())
+			}
+			switch pk := pub.(type) {
+			case *rsa.PublicKey:
+				k.rsaPub = pk
+			case *ecdsa.PublicKey:
+				k.ecPub = pk
+			}
+		}
+
+		if alg[:2] == "RS" && k.rsaPub == nil {
+			return nil, fmt.Errorf("key[%s] missing rsa key", opt.Kid)
+		}
+		if alg[:2] == "ES" {
+			if k.ecPub == nil {
+				return nil, fmt.Errorf("key[%s] missing ecdsa key", opt.Kid)
+			}
+			if k.ecPub.Curve != ecCurve(alg) {
+				return nil, fmt.Errorf("key[%s] curve does not match %s", opt.Kid, alg)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg: %s", opt.Alg)
+	}
+
+	return k, nil
+}
+
+func ecCurve(alg string) elliptic.Curve {
+	switch alg {
+	case AlgES256:
+		return elliptic.P256()
+	case AlgES384:
+		return elliptic.P384()
+	case AlgES512:
+		return elliptic.P521()
+	}
+	return nil
+}
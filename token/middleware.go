@@ -0,0 +1,99 @@
+package token
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+	"strings"
+)
+
+// 验证通过的 claims 在 gin.Context 中的 key
+const CtxClaimsKey = "JWTCLAIMS"
+
+// 浏览器登录(比如 oidc)时保存 jwt 的 HttpOnly cookie
+// 没有 Authorization header 时从此 cookie 读取，默认为空，不读取 cookie
+// 开启后浏览器会自动携带 cookie，使用方需要自己做 SameSite/CSRF 防护
+var CookieName = ""
+
+func GetBearerToken(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if CookieName != "" {
+		val, _ := c.Cookie(CookieName)
+		return val
+	}
+	return ""
+}
+
+func GetClaims(c *gin.Context) *Claims {
+	v, ok := c.Get(CtxClaimsKey)
+	if !ok {
+		return nil
+	}
+	return v.(*Claims)
+}
+
+// 验证 Authorization: Bearer 或 CookieName cookie 中的 jwt，并把 claims 转换为 roleapp.AuthResult
+// ds 为 nil 时直接信任 claims 中的角色，不访问数据库
+// ds 不为 nil 时使用 roleapp.AuthUser 按 sub 检查 api 权限
+func (m *JwtManager) Middleware(ds *dbandmq.Ds) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 已经被其他方式验证过，比如 api key
+		if roleapp.GetCurUser(c) != nil {
+			c.Next()
+			return
+		}
+
+		claims, err := m.Verify(GetBearerToken(c))
+		if err != nil {
+			if isTokenError(err) {
+				Logger.Warnf(middleware.GetReqId(c), "jwt验证失败, %s", err.Error())
+				returnfun.Return401Json(c, err.Error())
+				return
+			}
+			middleware.StopExec(err)
+		}
+
+		var ar *roleapp.AuthResult
+		if ds == nil {
+			ar = &roleapp.AuthResult{
+				Result:   roleapp.AuthResultOK,
+				UserId:   claims.Subject,
+				UserName: claims.Name,
+				Roles:    claims.Roles,
+			}
+		} else {
+			nds := ds.CopyDs().WithContext(c.Request.Context())
+			ar = roleapp.AuthUser(nds, claims.Subject, c.Request.Method, c.Request.URL.Path)
+			nds.Close()
+			ar.UserName = claims.Name
+
+			if ar.Result == roleapp.AuthResultInternalError {
+				middleware.StopExec(middleware.ErrDbExec.Append(ar.Msg))
+			}
+			if ar.Result != roleapp.AuthResultOK {
+				Logger.Warnf(middleware.GetReqId(c), "用户[%s]无权调用[%s %s]", claims.Subject, c.Request.Method, c.Request.URL.Path)
+				returnfun.Return403Json(c, ar.Msg)
+				return
+			}
+		}
+
+		c.Set(CtxClaimsKey, claims)
+		roleapp.SetCurUser(c, ar)
+		c.Next()
+	}
+}
+
+func isTokenError(err error) bool {
+	switch err {
+	case ErrInvalidToken, ErrNoExpire, ErrUnknownKid, ErrBadSignature, ErrTokenExpired,
+		ErrTokenNotValid, ErrBadIssuer, ErrBadAudience, ErrTokenRevoked:
+		return true
+	}
+	return false
+}
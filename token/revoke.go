@@ -0,0 +1,56 @@
+package token
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/leyle/ginbase/util"
+	"time"
+)
+
+// 吊销列表保存在 redis 中，key 的有效期与 token 剩余有效期一致
+const revokedPrefix = "JWT-REVOKED-"
+
+// token 没有 exp 时吊销记录的保存时间
+var RevokeTTL = 30 * 24 * time.Hour
+
+// 吊销 token，之后 Verify 返回 ErrTokenRevoked
+func (m *JwtManager) Revoke(c *Claims) error {
+	if m.r == nil || c.Id == "" {
+		return nil
+	}
+
+	ttl := RevokeTTL
+	if c.ExpiresAt > 0 {
+		left := c.ExpiresAt - util.CurUnixTime() + m.opt.Leeway
+		if left <= 0 {
+			// 已经过期，不需要吊销
+			return nil
+		}
+		ttl = time.Duration(left) * time.Second
+	}
+
+	return m.r.Set(revokedPrefix+c.Id, 1, ttl).Err()
+}
+
+// 解析 token 并吊销，token 无效时不处理
+func (m *JwtManager) RevokeToken(token string) error {
+	c, err := m.Verify(token)
+	if err != nil {
+		return nil
+	}
+	return m.Revoke(c)
+}
+
+func (m *JwtManager) IsRevoked(jti string) (bool, error) {
+	if m.r == nil || jti == "" {
+		return false, nil
+	}
+
+	err := m.r.Get(revokedPrefix + jti).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,137 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestHmacRotation(t *testing.T) {
+	old, err := NewJwtManager(&JwtOption{
+		Issuer:   "ginbase",
+		Audience: []string{"api"},
+		Keys:     []*KeyOption{{Kid: "k1", Alg: AlgHS256, Secret: "secret-1"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tk, err := old.Issue(&Claims{Subject: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(tk)
+
+	// 新增 k2 并用于签发，k1 签发的 token 仍然有效
+	m, err := NewJwtManager(&JwtOption{
+		Issuer:     "ginbase",
+		Audience:   []string{"api"},
+		SigningKid: "k2",
+		Keys: []*KeyOption{
+			{Kid: "k1", Alg: AlgHS256, Secret: "secret-1"},
+			{Kid: "k2", Alg: AlgHS512, Secret: "secret-2"},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := m.Verify(tk)
+	if err != nil || c.Subject != "u1" {
+		t.Fatal("verify old token failed", err)
+	}
+
+	tk2, _ := m.Issue(&Claims{Subject: "u2"})
+	if _, err = old.Verify(tk2); err != ErrUnknownKid {
+		t.Error("old manager should not know k2", err)
+	}
+
+	if _, err = m.Verify(tk[:len(tk)-2] + "xx"); err != ErrBadSignature {
+		t.Error("tampered token should be rejected", err)
+	}
+}
+
+func TestClaimsCheck(t *testing.T) {
+	m, _ := NewJwtManager(&JwtOption{
+		Issuer:   "ginbase",
+		Audience: []string{"api"},
+		Keys:     []*KeyOption{{Kid: "k1", Alg: AlgHS256, Secret: "secret-1"}},
+	}, nil)
+
+	tk, _ := m.Issue(&Claims{Subject: "u1", ExpiresAt: time.Now().Unix() - 10})
+	if _, err := m.Verify(tk); err != ErrTokenExpired {
+		t.Error("expired token should be rejected", err)
+	}
+
+	// 没有 exp 的 token 默认拒绝
+	h, _ := json.Marshal(&header{Alg: AlgHS256, Kid: "k1", Typ: "JWT"})
+	p, _ := json.Marshal(&Claims{Subject: "u1", Issuer: "ginbase", Audience: Audience{"api"}})
+	input := b64(h) + "." + b64(p)
+	sig, _ := m.signing.sign([]byte(input))
+	noExp := input + "." + b64(sig)
+	if _, err := m.Verify(noExp); err != ErrNoExpire {
+		t.Error("token without exp should be rejected", err)
+	}
+	m.opt.AllowNoExpire = true
+	if _, err := m.Verify(noExp); err != nil {
+		t.Error("token without exp should be allowed", err)
+	}
+	m.opt.AllowNoExpire = false
+
+	tk, _ = m.Issue(&Claims{Subject: "u1", Issuer: "other"})
+	if _, err := m.Verify(tk); err != ErrBadIssuer {
+		t.Error("bad issuer should be rejected", err)
+	}
+
+	tk, _ = m.Issue(&Claims{Subject: "u1", Audience: Audience{"web"}})
+	if _, err := m.Verify(tk); err != ErrBadAudience {
+		t.Error("bad audience should be rejected", err)
+	}
+}
+
+func TestAsymmetric(t *testing.T) {
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaPem := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rk)}))
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rk.PublicKey)
+	rsaPubPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPub}))
+
+	ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDer, _ := x509.MarshalECPrivateKey(ek)
+	ecPem := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDer}))
+	ecPub, _ := x509.MarshalPKIXPublicKey(&ek.PublicKey)
+	ecPubPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ecPub}))
+
+	cases := []struct {
+		alg, pri, pub string
+	}{
+		{AlgRS256, rsaPem, rsaPubPem},
+		{AlgES256, ecPem, ecPubPem},
+	}
+	for _, cs := range cases {
+		signer, err := NewJwtManager(&JwtOption{Keys: []*KeyOption{{Kid: "a", Alg: cs.alg, PrivateKey: cs.pri}}}, nil)
+		if err != nil {
+			t.Fatal(cs.alg, err)
+		}
+		verifier, err := NewJwtManager(&JwtOption{Keys: []*KeyOption{{Kid: "a", Alg: cs.alg, PublicKey: cs.pub}}}, nil)
+		if err != nil {
+			t.Fatal(cs.alg, err)
+		}
+
+		tk, err := signer.Issue(&Claims{Subject: "u1"})
+		if err != nil {
+			t.Fatal(cs.alg, err)
+		}
+		if _, err = verifier.Verify(tk); err != nil {
+			t.Error(cs.alg, "verify failed", err)
+		}
+		if _, err = verifier.Issue(&Claims{Subject: "u1"}); err == nil {
+			t.Error(cs.alg, "public key should not sign")
+		}
+	}
+}
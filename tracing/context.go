@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	"github.com/leyle/ginbase/constant"
+)
+
+type spanCtxKey struct{}
+
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, spanCtxKey{}, s)
+}
+
+// 从 context 中读取当前 span，没有时返回 nil
+// 支持 ContextWithSpan 生成的 context，以及经过 middleware.ReqIdMiddleware 的 *gin.Context
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	if s, ok := ctx.Value(spanCtxKey{}).(*Span); ok {
+		return s
+	}
+	if s, ok := ctx.Value(constant.TraceCtxKey).(*Span); ok {
+		return s
+	}
+	return nil
+}
+
+// 以 ctx 中的 span 为 parent 开始新的 span，没有 parent 时开始新的 trace
+func Start(ctx context.Context, name, kind string) (context.Context, *Span) {
+	s := StartSpan(FromContext(ctx), "", name, kind)
+	return ContextWithSpan(ctx, s), s
+}
+
+// 只在 ctx 中有 parent 时开始新的 span，否则返回 nil span
+// 用于数据库、redis、http 等调用，避免在请求之外产生大量零散的 trace
+func StartChild(ctx context.Context, name, kind string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := StartSpan(parent, "", name, kind)
+	return ContextWithSpan(ctx, s), s
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"encoding/json"
+	. "github.com/leyle/ginbase/consolelog"
+	"math/rand"
+	"sync"
+)
+
+// 导出结束的 span，Export 在业务 goroutine 中调用，实现不应该阻塞
+type Exporter interface {
+	Export(s *Span) error
+	Close() error
+}
+
+var (
+	exporterLock sync.RWMutex
+	exporter     Exporter
+)
+
+// 新 trace 的采样百分比，0-100，只在设置了 exporter 时生效
+// 上游传入的 trace 沿用上游的采样结果
+var SampleRate float64 = 100
+
+// 设置 exporter，为 nil 时关闭追踪，只传递 id
+// 返回原来的 exporter，由调用方关闭
+func SetExporter(e Exporter) Exporter {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+	old := exporter
+	exporter = e
+	return old
+}
+
+func getExporter() Exporter {
+	exporterLock.RLock()
+	defer exporterLock.RUnlock()
+	return exporter
+}
+
+func sample() bool {
+	if getExporter() == nil {
+		return false
+	}
+	return SampleRate >= 100 || SampleRate > 0 && rand.Float64()*100 < SampleRate
+}
+
+func export(s *Span) {
+	e := getExporter()
+	if e == nil {
+		return
+	}
+	if err := e.Export(s); err != nil {
+		Logger.Warnf(s.ReqId, "导出span[%s]失败, %s", s.Name, err.Error())
+	}
+}
+
+// 每个 span 一行 json，异步写入 consolelog 的 sink
+// 比如 StdoutSink、FileSink、dbandmq.KafkaLogSink
+type SinkExporter struct {
+	w *AsyncWriter
+}
+
+func NewSinkExporter(opt *AsyncOption, sinks ...Sink) *SinkExporter {
+	return &SinkExporter{w: NewAsyncWriter(opt, sinks...)}
+}
+
+// 输出到标准输出
+func NewStdoutExporter() *SinkExporter {
+	return NewSinkExporter(nil, &StdoutSink{})
+}
+
+// 输出到文件，按 opt 切分
+func NewFileExporter(opt *FileSinkOption) (*SinkExporter, error) {
+	fs, err := NewFileSink(opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewSinkExporter(nil, fs), nil
+}
+
+func (e *SinkExporter) Export(s *Span) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+func (e *SinkExporter) Flush() {
+	e.w.Flush()
+}
+
+func (e *SinkExporter) Close() error {
+	return e.w.Close()
+}
+
+// 丢弃的 span 数
+func (e *SinkExporter) Dropped() int64 {
+	return e.w.Dropped()
+}
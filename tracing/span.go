@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/leyle/ginbase/constant"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// span 的类型
+const (
+	KindServer   = "server"
+	KindClient   = "client"
+	KindProducer = "producer"
+	KindConsumer = "consumer"
+	KindInternal = "internal"
+)
+
+// 一次操作的耗时记录，trace id 与 span id 遵循 W3C trace context，https://www.w3.org/TR/trace-context/
+// 在服务之间通过 X-Request-Id、traceparent、tracestate 三个 header 传递
+type Span struct {
+	TraceId    string                 `json:"traceId"`            // 32 位 hex
+	SpanId     string                 `json:"spanId"`             // 16 位 hex
+	ParentId   string                 `json:"parentId,omitempty"` // 16 位 hex，没有上游时为空
+	ReqId      string                 `json:"reqId,omitempty"`
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind"`
+	StartT     time.Time              `json:"start"`
+	EndT       time.Time              `json:"end"`
+	DurationMs float64                `json:"durationMs"`
+	Attrs      map[string]interface{} `json:"attrs,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+
+	Flags      string `json:"-"` // 2 位 hex，01 表示采样
+	TraceState string `json:"-"`
+
+	remote bool // 上游传入的 span，只用于生成子 span
+	lock   sync.Mutex
+	ended  bool
+}
+
+// tracestate 超过这个长度时丢弃
+const MaxTraceStateLength = 512
+
+const traceVersion = "00"
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// 系统随机数不可用时退回到时间戳
+		return fmt.Sprintf("%0*x", n*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// 小写 hex 字符串
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, ch := range s {
+		if !(ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// trace id 与 span id 全 0 无效
+func isHexId(s string, n int) bool {
+	return isHex(s, n) && strings.Trim(s, "0") != ""
+}
+
+// 解析上游的 traceparent，格式为 version-traceid-parentid-flags
+// 返回的 span 代表上游，只能作为 StartSpan 的 parent，tracestate 原样传递
+func Remote(reqId, traceParent, traceState string) (*Span, error) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("invalid traceparent [%s]", traceParent)
+	}
+	version, traceId, parentId, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isHex(version, 2) || version == "ff" {
+		return nil, fmt.Errorf("invalid traceparent version [%s]", version)
+	}
+	// 00 版本必须正好 4 段，更高的版本允许后面有扩展字段
+	if version == traceVersion && len(parts) != 4 {
+		return nil, fmt.Errorf("invalid traceparent [%s]", traceParent)
+	}
+	if !isHexId(traceId, 32) || !isHexId(parentId, 16) || !isHex(flags, 2) {
+		return nil, fmt.Errorf("invalid traceparent [%s]", traceParent)
+	}
+
+	if len(traceState) > MaxTraceStateLength {
+		traceState = ""
+	}
+
+	return &Span{
+		TraceId:    traceId,
+		SpanId:     parentId,
+		ReqId:      reqId,
+		Flags:      flags,
+		TraceState: strings.TrimSpace(traceState),
+		remote:     true,
+	}, nil
+}
+
+// 开始新的 span，parent 为 nil 时开始新的 trace，并按 SampleRate 决定是否采样
+// reqId 为空时沿用 parent 的请求号
+func StartSpan(parent *Span, reqId, name, kind string) *Span {
+	s := &Span{
+		SpanId: randomHex(8),
+		ReqId:  reqId,
+		Name:   name,
+		Kind:   kind,
+		StartT: time.Now(),
+	}
+	if parent != nil {
+		s.TraceId = parent.TraceId
+		s.ParentId = parent.SpanId
+		s.Flags = parent.Flags
+		s.TraceState = parent.TraceState
+		if s.ReqId == "" {
+			s.ReqId = parent.ReqId
+		}
+	} else {
+		s.TraceId = randomHex(16)
+		s.Flags = "00"
+		if sample() {
+			s.Flags = "01"
+		}
+	}
+	return s
+}
+
+// 是否采样，未采样的 span 只传递 id，不导出
+func (s *Span) Sampled() bool {
+	if s == nil {
+		return false
+	}
+	flags, err := strconv.ParseUint(s.Flags, 16, 8)
+	return err == nil && flags&1 == 1
+}
+
+// 以下方法 s 为 nil 时什么都不做，方便没有 parent 时省略判断
+func (s *Span) SetAttr(key string, val interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ended {
+		return
+	}
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]interface{})
+	}
+	s.Attrs[key] = val
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.ended {
+		s.Error = err.Error()
+	}
+}
+
+// 结束 span，采样的 span 交给 exporter，重复调用只生效一次
+func (s *Span) End() {
+	if s == nil || s.remote {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndT = time.Now()
+	s.DurationMs = float64(s.EndT.Sub(s.StartT)) / float64(time.Millisecond)
+	s.lock.Unlock()
+
+	if s.Sampled() {
+		export(s)
+	}
+}
+
+// 传给下游的 traceparent，parent id 为本 span 的 id
+func (s *Span) TraceParent() string {
+	return fmt.Sprintf("%s-%s-%s-%s", traceVersion, s.TraceId, s.SpanId, s.Flags)
+}
+
+// 传给下游的 header
+func (s *Span) Headers() map[string]string {
+	h := make(map[string]string)
+	s.Inject(h)
+	return h
+}
+
+// 写入到 headers 中，调用方已经设置的 header 不覆盖
+func (s *Span) Inject(headers map[string]string) {
+	if s == nil {
+		return
+	}
+	set := func(k, v string) {
+		if v == "" {
+			return
+		}
+		for hk := range headers {
+			if strings.EqualFold(hk, k) {
+				return
+			}
+		}
+		headers[k] = v
+	}
+	set(constant.XRequestIdHeaderKey, s.ReqId)
+	set(constant.TraceParentHeaderKey, s.TraceParent())
+	set(constant.TraceStateHeaderKey, s.TraceState)
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+func (m *memExporter) Export(s *Span) error {
+	m.lock.Lock()
+	m.spans = append(m.spans, s)
+	m.lock.Unlock()
+	return nil
+}
+
+func (m *memExporter) Close() error {
+	return nil
+}
+
+func TestRemote(t *testing.T) {
+	remote, err := Remote("req1", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "congo=t61rcWkgMzE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := StartSpan(remote, "", "server", KindServer)
+	if s.TraceId != remote.TraceId || s.ParentId != "00f067aa0ba902b7" || s.ReqId != "req1" || !s.Sampled() {
+		t.Error("span should continue the remote trace", s)
+	}
+	if s.Headers()["tracestate"] != "congo=t61rcWkgMzE" {
+		t.Error("tracestate should be propagated")
+	}
+
+	bad := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, tp := range bad {
+		if _, err := Remote("", tp, ""); err == nil {
+			t.Error("traceparent should be invalid", tp)
+		}
+	}
+	if _, err := Remote("", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", ""); err != nil {
+		t.Error("future version may have extra fields", err)
+	}
+}
+
+func TestSpanTree(t *testing.T) {
+	m := &memExporter{}
+	old := SetExporter(m)
+	defer SetExporter(old)
+
+	ctx, root := Start(context.Background(), "root", KindServer)
+	if !root.Sampled() {
+		t.Fatal("root should be sampled with an exporter")
+	}
+	_, child := StartChild(ctx, "child", KindClient)
+	child.SetAttr("k", "v")
+	child.SetError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	if len(m.spans) != 2 {
+		t.Fatal("each span should be exported once", len(m.spans))
+	}
+	if child.TraceId != root.TraceId || child.ParentId != root.SpanId || child.Error != "boom" {
+		t.Error("child should belong to root", child)
+	}
+
+	// 没有 parent 时不产生子 span
+	if _, s := StartChild(context.Background(), "orphan", KindClient); s != nil {
+		t.Error("StartChild without parent should return nil")
+	}
+
+	// 没有 exporter 时不采样
+	SetExporter(nil)
+	_, s := Start(context.Background(), "unsampled", KindInternal)
+	if s.Sampled() || !strings.HasSuffix(s.TraceParent(), "-00") {
+		t.Error("span should not be sampled without an exporter", s.TraceParent())
+	}
+}
+
+type bufSink struct {
+	bytes.Buffer
+}
+
+func (b *bufSink) Close() error {
+	return nil
+}
+
+func TestSinkExporter(t *testing.T) {
+	sink := &bufSink{}
+	e := NewSinkExporter(nil, sink)
+	old := SetExporter(e)
+	defer SetExporter(old)
+
+	_, s := Start(context.Background(), "op", KindInternal)
+	s.SetAttr("n", 1)
+	s.End()
+	e.Flush()
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(sink.Bytes()), &got); err != nil {
+		t.Fatal(err, sink.String())
+	}
+	if got["name"] != "op" || got["traceId"] != s.TraceId || got["spanId"] != s.SpanId {
+		t.Error("unexpected span json", sink.String())
+	}
+	_ = e.Close()
+}
@@ -0,0 +1,103 @@
+package userapp
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+	"strings"
+)
+
+// 请求中携带 token 的 header，也支持 Authorization: Bearer xxx
+var TokenHeader = "TOKEN"
+
+// 初始化，需要在 roleapp.InitRoleApp 之后调用
+// 配置了 AdminPasswd 时，确保 roleapp.AdminUserId 对应的管理员账户存在
+func InitUserApp(uo *UserOption) error {
+	if uo.AdminPasswd == "" {
+		return nil
+	}
+
+	ds := uo.Ds.CopyDs()
+	defer ds.Close()
+
+	u, err := GetUserById(ds, roleapp.AdminUserId)
+	if err != nil {
+		return err
+	}
+	if u != nil {
+		return nil
+	}
+
+	_, err = NewUser(ds, roleapp.AdminUserId, roleapp.AdminUserName, roleapp.AdminUserName, uo.AdminPasswd)
+	if err != nil {
+		return err
+	}
+	Logger.Infof("", "初始化管理员账户[%s]完成", roleapp.AdminUserName)
+	return nil
+}
+
+func GetToken(c *gin.Context) string {
+	token := c.GetHeader(TokenHeader)
+	if token != "" {
+		return token
+	}
+
+	auth := c.GetHeader("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// 只验证登录状态，不检查 api 权限
+func SessionMiddleware(uo *UserOption) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authSession(c, uo, false)
+	}
+}
+
+// 验证登录状态，并使用 roleapp.AuthUser 检查 api 权限
+func AuthMiddleware(uo *UserOption) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authSession(c, uo, true)
+	}
+}
+
+func authSession(c *gin.Context, uo *UserOption, checkApi bool) {
+	// 已经被其他方式验证过，比如 api key
+	if roleapp.GetCurUser(c) != nil {
+		c.Next()
+		return
+	}
+
+	s, err := uo.WithContext(c.Request.Context()).GetSession(GetToken(c))
+	if err == ErrInvalidSession {
+		returnfun.Return401Json(c, err.Error())
+		return
+	}
+	middleware.StopExec(err)
+
+	ds := uo.Ds.CopyDs().WithContext(c.Request.Context())
+	var ar *roleapp.AuthResult
+	if checkApi {
+		ar = roleapp.AuthUser(ds, s.UserId, c.Request.Method, c.Request.URL.Path)
+	} else {
+		ar = roleapp.LoadUser(ds, s.UserId)
+	}
+	ds.Close()
+	ar.UserName = s.LoginId
+
+	if ar.Result == roleapp.AuthResultInternalError {
+		middleware.StopExec(middleware.ErrDbExec.Append(ar.Msg))
+	}
+	if ar.Result != roleapp.AuthResultOK {
+		Logger.Warnf(middleware.GetReqId(c), "用户[%s]无权调用[%s %s]", s.LoginId, c.Request.Method, c.Request.URL.Path)
+		returnfun.Return403Json(c, ar.Msg)
+		return
+	}
+
+	roleapp.SetCurUser(c, ar)
+	c.Next()
+}
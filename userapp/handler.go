@@ -0,0 +1,261 @@
+package userapp
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/returnfun"
+	"github.com/leyle/ginbase/roleapp"
+	"strings"
+)
+
+// 发送重置密码验证码的方法，比如短信、邮件，需要使用方配置
+var ResetCodeSender func(u *User, code string) error
+
+// 注册
+type RegisterForm struct {
+	LoginId string `json:"loginId" binding:"required"`
+	Passwd  string `json:"passwd" binding:"required"`
+	Name    string `json:"name"`
+}
+
+func RegisterHandler(c *gin.Context, uo *UserOption) {
+	var form RegisterForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	ds := uo.Ds.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	u, err := NewUser(ds, "", form.LoginId, strings.TrimSpace(form.Name), form.Passwd)
+	if err == ErrLoginIdExist || err == ErrPasswdTooShort {
+		returnfun.ReturnErrJson(c, err.Error())
+		return
+	}
+	middleware.StopExec(err)
+
+	// 新用户赋予默认角色
+	err = roleapp.AddOrUpdateRoleAndRole(ds, u.Id, roleapp.DefaultRoleId, "")
+	middleware.StopExec(err)
+
+	returnfun.ReturnOKJson(c, u)
+	return
+}
+
+// 登录
+type LoginForm struct {
+	LoginId string `json:"loginId" binding:"required"`
+	Passwd  string `json:"passwd" binding:"required"`
+}
+
+func LoginHandler(c *gin.Context, uo *UserOption) {
+	var form LoginForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	loginId := normalizeLoginId(form.LoginId)
+	if uo.Limiter != nil && !uo.Limiter.Guard(c, loginId) {
+		return
+	}
+
+	ds := uo.Ds.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	u, err := VerifyLogin(ds, loginId, form.Passwd)
+	if err == ErrLoginFailed || err == ErrUserDisabled {
+		Logger.Warnf(middleware.GetReqId(c), "用户[%s]登录失败, %s", form.LoginId, err.Error())
+		if uo.Limiter != nil {
+			uo.Limiter.Report(c, loginId, false)
+		}
+		returnfun.Return401Json(c, err.Error())
+		return
+	}
+	middleware.StopExec(err)
+
+	if uo.Limiter != nil {
+		uo.Limiter.Report(c, loginId, true)
+	}
+
+	token, err := uo.WithContext(c.Request.Context()).NewSession(u)
+	middleware.StopExec(err)
+
+	roles, err := roleapp.GetUserRoles(ds, u.Id)
+	middleware.StopExec(err)
+
+	var srs []*roleapp.SimpleRole
+	for _, role := range roles {
+		srs = append(srs, &roleapp.SimpleRole{Id: role.Id, Name: role.Name})
+	}
+
+	retData := gin.H{
+		"token": token,
+		"user":  u,
+		"roles": srs,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
+
+// 注销当前 session
+func LogoutHandler(c *gin.Context, uo *UserOption) {
+	token := GetToken(c)
+	err := uo.WithContext(c.Request.Context()).DeleteSession(token)
+	if err != nil && err != ErrInvalidSession {
+		middleware.StopExec(err)
+	}
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
+
+// 读取当前用户信息
+func GetMeHandler(c *gin.Context, uo *UserOption) {
+	curUser := roleapp.GetCurUser(c)
+	if curUser == nil {
+		returnfun.Return401Json(c, ErrInvalidSession.Error())
+		return
+	}
+
+	ds := uo.Ds.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	u, err := GetUserById(ds, curUser.UserId)
+	middleware.StopExec(err)
+
+	retData := gin.H{
+		"user":     u,
+		"roles":    curUser.Roles,
+		"subRoles": curUser.SubRoles,
+	}
+	returnfun.ReturnOKJson(c, retData)
+	return
+}
+
+// 修改密码，成功后注销所有 session
+type ChangePasswdForm struct {
+	OldPasswd string `json:"oldPasswd" binding:"required"`
+	NewPasswd string `json:"newPasswd" binding:"required"`
+}
+
+func ChangePasswdHandler(c *gin.Context, uo *UserOption) {
+	var form ChangePasswdForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	curUser := roleapp.GetCurUser(c)
+	if curUser == nil {
+		returnfun.Return401Json(c, ErrInvalidSession.Error())
+		return
+	}
+
+	ds := uo.Ds.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	u, err := GetUserById(ds, curUser.UserId)
+	middleware.StopExec(err)
+	if u == nil {
+		middleware.StopExec(middleware.ErrNoIdData.Append(curUser.UserId))
+	}
+
+	if !u.CheckPasswd(form.OldPasswd) {
+		returnfun.ReturnErrJson(c, "原密码错误")
+		return
+	}
+
+	err = SetPasswd(ds, u, form.NewPasswd)
+	middleware.StopExec(err)
+
+	err = uo.WithContext(c.Request.Context()).DeleteUserSessions(u.Id)
+	middleware.StopExec(err)
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
+
+// 发送重置密码的验证码
+// 无论用户是否存在都返回成功，避免被用来探测用户
+type SendResetCodeForm struct {
+	LoginId string `json:"loginId" binding:"required"`
+}
+
+func SendResetCodeHandler(c *gin.Context, uo *UserOption) {
+	var form SendResetCodeForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	reqId := middleware.GetReqId(c)
+	if ResetCodeSender == nil {
+		Logger.Error(reqId, "未配置重置密码验证码的发送方法 userapp.ResetCodeSender")
+		returnfun.ReturnJson(c, 417, 417, "服务器未配置验证码发送方式", "")
+		return
+	}
+
+	ds := uo.Ds.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	u, err := GetUserByLoginId(ds, form.LoginId)
+	middleware.StopExec(err)
+	if u == nil || u.Disabled {
+		Logger.Warnf(reqId, "请求重置密码的用户[%s]不存在或已禁用", form.LoginId)
+		returnfun.ReturnOKJson(c, "")
+		return
+	}
+
+	code, err := uo.WithContext(c.Request.Context()).NewResetCode(u.Id)
+	middleware.StopExec(err)
+
+	err = ResetCodeSender(u, code)
+	if err != nil {
+		Logger.Errorf(reqId, "发送用户[%s]重置密码验证码失败, %s", u.LoginId, err.Error())
+		middleware.StopExec(err)
+	}
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
+
+// 使用验证码重置密码，成功后注销所有 session
+type ResetPasswdForm struct {
+	LoginId   string `json:"loginId" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+	NewPasswd string `json:"newPasswd" binding:"required"`
+}
+
+func ResetPasswdHandler(c *gin.Context, uo *UserOption) {
+	var form ResetPasswdForm
+	err := c.BindJSON(&form)
+	middleware.StopExec(err)
+
+	// 先检查新密码，避免验证码被消耗后密码不符合要求
+	err = ValidatePasswd(form.NewPasswd)
+	if err != nil {
+		returnfun.ReturnErrJson(c, err.Error())
+		return
+	}
+
+	ds := uo.Ds.CopyDs().WithContext(c.Request.Context())
+	defer ds.Close()
+
+	u, err := GetUserByLoginId(ds, form.LoginId)
+	middleware.StopExec(err)
+	if u == nil {
+		returnfun.ReturnErrJson(c, ErrInvalidResetCode.Error())
+		return
+	}
+
+	err = uo.WithContext(c.Request.Context()).CheckResetCode(u.Id, strings.TrimSpace(form.Code))
+	if err == ErrInvalidResetCode {
+		returnfun.ReturnErrJson(c, err.Error())
+		return
+	}
+	middleware.StopExec(err)
+
+	err = SetPasswd(ds, u, form.NewPasswd)
+	middleware.StopExec(err)
+
+	err = uo.WithContext(c.Request.Context()).DeleteUserSessions(u.Id)
+	middleware.StopExec(err)
+
+	returnfun.ReturnOKJson(c, "")
+	return
+}
@@ -0,0 +1,223 @@
+package userapp
+
+import (
+	"errors"
+	"github.com/go-redis/redis"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/loginlimit"
+	"github.com/leyle/ginbase/middleware"
+	"github.com/leyle/ginbase/util"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+func init() {
+	dbandmq.AddIndexKey(IKUser)
+}
+
+var DbPrefix = "user_"
+
+type UserOption struct {
+	Ds *dbandmq.Ds
+	R  *redis.Client
+
+	SessionTTL   time.Duration // session 有效期，每次访问会重新计时
+	ResetCodeTTL time.Duration // 重置密码验证码的有效期
+
+	// 管理员账户的初始密码，为空时不创建管理员账户
+	AdminPasswd string
+
+	// 登录失败限制，为空时不限制
+	Limiter *loginlimit.Limiter
+}
+
+const (
+	DefaultSessionTTL   = 7 * 24 * time.Hour
+	DefaultResetCodeTTL = 15 * time.Minute
+)
+
+// bcrypt 的计算强度
+var PasswdCost = bcrypt.DefaultCost
+
+// 密码最短长度
+var MinPasswdLen = 8
+
+var (
+	ErrLoginIdExist   = errors.New("登录名已存在")
+	ErrLoginFailed    = errors.New("登录名或密码错误")
+	ErrUserDisabled   = errors.New("用户已被禁用")
+	ErrPasswdTooShort = errors.New("密码长度不足")
+)
+
+var CollectionNameUser = DbPrefix + "user"
+
+var IKUser = &dbandmq.IndexKey{
+	Collection: CollectionNameUser,
+	SingleKey:  []string{"name", "disabled"},
+	UniqueKey:  []string{"loginId"},
+}
+
+type User struct {
+	Id       string `json:"id" bson:"_id"`
+	LoginId  string `json:"loginId" bson:"loginId"` // 统一小写
+	Name     string `json:"name" bson:"name"`
+	Passwd   string `json:"-" bson:"passwd"` // bcrypt hash
+	Disabled bool   `json:"disabled" bson:"disabled"`
+
+	LastLoginT *util.CurTime `json:"lastLoginT" bson:"lastLoginT"`
+	CreateT    *util.CurTime `json:"createT" bson:"createT"`
+	UpdateT    *util.CurTime `json:"updateT" bson:"updateT"`
+}
+
+func normalizeLoginId(loginId string) string {
+	return strings.ToLower(strings.TrimSpace(loginId))
+}
+
+// 检查新密码是否符合要求
+func ValidatePasswd(rawPasswd string) error {
+	if len(rawPasswd) < MinPasswdLen {
+		return ErrPasswdTooShort
+	}
+	return nil
+}
+
+// bcrypt 自带随机盐
+func HashPasswd(rawPasswd string) (string, error) {
+	if err := ValidatePasswd(rawPasswd); err != nil {
+		return "", err
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(rawPasswd), PasswdCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+func (u *User) CheckPasswd(rawPasswd string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(u.Passwd), []byte(rawPasswd))
+	return err == nil
+}
+
+func GetUserById(ds *dbandmq.Ds, id string) (*User, error) {
+	var u *User
+	err := ds.TC(CollectionNameUser).FindId(id).One(&u)
+	if err != nil && err != mgo.ErrNotFound {
+		Logger.Errorf("", "根据id[%s]读取用户失败, %s", id, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return u, nil
+}
+
+func GetUserByLoginId(ds *dbandmq.Ds, loginId string) (*User, error) {
+	f := bson.M{
+		"loginId": normalizeLoginId(loginId),
+	}
+
+	var u *User
+	err := ds.TC(CollectionNameUser).Find(f).One(&u)
+	if err != nil && err != mgo.ErrNotFound {
+		Logger.Errorf("", "根据loginId[%s]读取用户失败, %s", loginId, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return u, nil
+}
+
+// 新建用户，id 为空时自动生成
+func NewUser(ds *dbandmq.Ds, id, loginId, name, rawPasswd string) (*User, error) {
+	loginId = normalizeLoginId(loginId)
+	dbu, err := GetUserByLoginId(ds, loginId)
+	if err != nil {
+		return nil, err
+	}
+	if dbu != nil {
+		return nil, ErrLoginIdExist
+	}
+
+	h, err := HashPasswd(rawPasswd)
+	if err != nil {
+		return nil, err
+	}
+
+	if id == "" {
+		id = util.GenerateDataId()
+	}
+
+	u := &User{
+		Id:       id,
+		LoginId:  loginId,
+		Name:     name,
+		Passwd:   h,
+		Disabled: false,
+		CreateT:  util.GetCurTime(),
+	}
+	u.UpdateT = u.CreateT
+
+	err = ds.TC(CollectionNameUser).Insert(u)
+	if err != nil {
+		Logger.Errorf("", "新建用户[%s]失败, %s", loginId, err.Error())
+		return nil, middleware.ErrDbExec.Append(err.Error())
+	}
+	return u, nil
+}
+
+// 按登录名与密码验证用户
+func VerifyLogin(ds *dbandmq.Ds, loginId, rawPasswd string) (*User, error) {
+	u, err := GetUserByLoginId(ds, loginId)
+	if err != nil {
+		return nil, err
+	}
+
+	if u == nil {
+		// 用户不存在时也计算一次 hash，避免通过响应时间判断用户是否存在
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(rawPasswd))
+		return nil, ErrLoginFailed
+	}
+
+	if !u.CheckPasswd(rawPasswd) {
+		return nil, ErrLoginFailed
+	}
+
+	if u.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"lastLoginT": util.GetCurTime(),
+		},
+	}
+	err = ds.TC(CollectionNameUser).UpdateId(u.Id, update)
+	if err != nil {
+		Logger.Warnf("", "更新用户[%s]登录时间失败, %s", u.LoginId, err.Error())
+	}
+
+	return u, nil
+}
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-passwd"), PasswdCost)
+
+// 修改密码
+func SetPasswd(ds *dbandmq.Ds, u *User, rawPasswd string) error {
+	h, err := HashPasswd(rawPasswd)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"passwd":  h,
+			"updateT": util.GetCurTime(),
+		},
+	}
+	err = ds.TC(CollectionNameUser).UpdateId(u.Id, update)
+	if err != nil {
+		Logger.Errorf("", "修改用户[%s]密码失败, %s", u.LoginId, err.Error())
+		return middleware.ErrDbExec.Append(err.Error())
+	}
+	u.Passwd = h
+	return nil
+}
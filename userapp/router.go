@@ -0,0 +1,52 @@
+package userapp
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// 无需登录的接口
+func NoNeedAuthRouter(g *gin.RouterGroup, uo *UserOption) {
+	uR := g.Group("/user")
+	{
+		// 注册
+		uR.POST("/register", func(c *gin.Context) {
+			RegisterHandler(c, uo)
+		})
+
+		// 登录
+		uR.POST("/login", func(c *gin.Context) {
+			LoginHandler(c, uo)
+		})
+
+		// 发送重置密码验证码
+		uR.POST("/passwd/resetcode", func(c *gin.Context) {
+			SendResetCodeHandler(c, uo)
+		})
+
+		// 使用验证码重置密码
+		uR.POST("/passwd/reset", func(c *gin.Context) {
+			ResetPasswdHandler(c, uo)
+		})
+	}
+}
+
+// 需要登录的接口，g 需要配置 AuthMiddleware 或 SessionMiddleware
+func UserRouter(g *gin.RouterGroup, uo *UserOption) {
+	uR := g.Group("/user")
+	{
+		// 注销
+		uR.POST("/logout", func(c *gin.Context) {
+			LogoutHandler(c, uo)
+		})
+
+		// 当前用户信息
+		uR.GET("/me", func(c *gin.Context) {
+			GetMeHandler(c, uo)
+		})
+
+		// 修改密码
+		uR.POST("/passwd", func(c *gin.Context) {
+			ChangePasswdHandler(c, uo)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package userapp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	jsoniter "github.com/json-iterator/go"
+	. "github.com/leyle/ginbase/consolelog"
+	"github.com/leyle/ginbase/dbandmq"
+	"github.com/leyle/ginbase/util"
+	"math/big"
+	"time"
+)
+
+// 返回带有 ctx 的副本，redis 命令记录为 ctx 中 span 的子 span，handler 中传入 c.Request.Context()
+func (uo *UserOption) WithContext(ctx context.Context) *UserOption {
+	nuo := *uo
+	nuo.R = dbandmq.TraceRedis(ctx, uo.R)
+	return &nuo
+}
+
+// session 保存在 redis 中，key 是 token 的 hash，不保存明文 token
+const (
+	sessionPrefix     = "SESSION-"
+	userSessionPrefix = "USER-SESSIONS-" // 用户所有 session 的集合，修改密码时全部注销
+	resetCodePrefix   = "RESETCODE-"
+)
+
+// 验证码最多尝试次数，超过后验证码失效
+var MaxResetCodeTries = 5
+
+var (
+	ErrInvalidSession   = errors.New("登录已失效，请重新登录")
+	ErrInvalidResetCode = errors.New("验证码错误或已过期")
+)
+
+type Session struct {
+	UserId  string        `json:"userId"`
+	LoginId string        `json:"loginId"`
+	Name    string        `json:"name"`
+	CreateT *util.CurTime `json:"createT"`
+}
+
+func tokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func (uo *UserOption) sessionTTL() time.Duration {
+	if uo.SessionTTL <= 0 {
+		return DefaultSessionTTL
+	}
+	return uo.SessionTTL
+}
+
+func (uo *UserOption) resetCodeTTL() time.Duration {
+	if uo.ResetCodeTTL <= 0 {
+		return DefaultResetCodeTTL
+	}
+	return uo.ResetCodeTTL
+}
+
+// 新建 session，返回不透明的 token
+func (uo *UserOption) NewSession(u *User) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	s := &Session{
+		UserId:  u.Id,
+		LoginId: u.LoginId,
+		Name:    u.Name,
+		CreateT: util.GetCurTime(),
+	}
+	data, _ := jsoniter.MarshalToString(s)
+
+	th := tokenHash(token)
+	ttl := uo.sessionTTL()
+	userKey := userSessionPrefix + u.Id
+
+	pipe := uo.R.TxPipeline()
+	pipe.Set(sessionPrefix+th, data, ttl)
+	pipe.SAdd(userKey, th)
+	pipe.Expire(userKey, ttl)
+	_, err = pipe.Exec()
+	if err != nil {
+		Logger.Errorf("", "保存用户[%s]session失败, %s", u.LoginId, err.Error())
+		return "", err
+	}
+
+	return token, nil
+}
+
+// 读取 session，同时刷新有效期
+func (uo *UserOption) GetSession(token string) (*Session, error) {
+	if token == "" {
+		return nil, ErrInvalidSession
+	}
+
+	key := sessionPrefix + tokenHash(token)
+	data, err := uo.R.Get(key).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		Logger.Errorf("", "读取session失败, %s", err.Error())
+		return nil, err
+	}
+
+	var s *Session
+	err = jsoniter.UnmarshalFromString(data, &s)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+
+	ttl := uo.sessionTTL()
+	pipe := uo.R.Pipeline()
+	pipe.Expire(key, ttl)
+	pipe.Expire(userSessionPrefix+s.UserId, ttl)
+	_, err = pipe.Exec()
+	if err != nil {
+		Logger.Warnf("", "刷新session有效期失败, %s", err.Error())
+	}
+
+	return s, nil
+}
+
+// 注销单个 session
+func (uo *UserOption) DeleteSession(token string) error {
+	th := tokenHash(token)
+	s, err := uo.GetSession(token)
+	if err != nil {
+		return err
+	}
+
+	pipe := uo.R.TxPipeline()
+	pipe.Del(sessionPrefix + th)
+	pipe.SRem(userSessionPrefix+s.UserId, th)
+	_, err = pipe.Exec()
+	return err
+}
+
+// 注销用户的全部 session
+func (uo *UserOption) DeleteUserSessions(uid string) error {
+	userKey := userSessionPrefix + uid
+	ths, err := uo.R.SMembers(userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userKey}
+	for _, th := range ths {
+		keys = append(keys, sessionPrefix+th)
+	}
+	return uo.R.Del(keys...).Err()
+}
+
+// 生成 6 位数字验证码，redis 中保存 hash 与尝试次数
+func (uo *UserOption) NewResetCode(uid string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	key := resetCodePrefix + uid
+	pipe := uo.R.TxPipeline()
+	pipe.Del(key)
+	pipe.HSet(key, "code", tokenHash(code))
+	pipe.HSet(key, "tries", 0)
+	pipe.Expire(key, uo.resetCodeTTL())
+	_, err = pipe.Exec()
+	if err != nil {
+		Logger.Errorf("", "保存用户[%s]验证码失败, %s", uid, err.Error())
+		return "", err
+	}
+	return code, nil
+}
+
+// 比较、计数与删除在同一个脚本中执行，并发请求不会重复使用验证码
+// KEYS[1] 验证码，ARGV[1] 提交的验证码的 hash，ARGV[2] 最多尝试次数
+// 返回 1 验证通过，0 验证码错误，-1 验证码不存在
+var checkResetCodeScript = redis.NewScript(`
+local code = redis.call('HGET', KEYS[1], 'code')
+if not code then
+	return -1
+end
+if code == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+local tries = redis.call('HINCRBY', KEYS[1], 'tries', 1)
+if tries >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// 验证码只能使用一次，错误次数过多也会失效
+func (uo *UserOption) CheckResetCode(uid, code string) error {
+	key := resetCodePrefix + uid
+	ret, err := checkResetCodeScript.Run(uo.R, []string{key}, tokenHash(code), MaxResetCodeTries).Int64()
+	if err != nil {
+		return err
+	}
+	if ret != 1 {
+		return ErrInvalidResetCode
+	}
+	return nil
+}
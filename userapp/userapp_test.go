@@ -0,0 +1,27 @@
+package userapp
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestHashPasswd(t *testing.T) {
+	PasswdCost = bcrypt.MinCost
+
+	if _, err := HashPasswd("short"); err != ErrPasswdTooShort {
+		t.Error("short passwd should be rejected")
+	}
+
+	h, err := HashPasswd("some-long-passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &User{Passwd: h}
+	if !u.CheckPasswd("some-long-passwd") {
+		t.Error("passwd should match")
+	}
+	if u.CheckPasswd("other-long-passwd") {
+		t.Error("passwd should not match")
+	}
+}
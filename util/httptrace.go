@@ -0,0 +1,51 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"github.com/leyle/ginbase/tracing"
+	"net/http"
+	"net/url"
+)
+
+// 可选的 ctx 中有 span 时，开始 client span，并把 trace 信息写入 headers 的副本中
+func startHttpSpan(method, reqUrl string, headers map[string]string, ctx []context.Context) (*tracing.Span, map[string]string) {
+	if len(ctx) == 0 {
+		return nil, headers
+	}
+	host := reqUrl
+	if u, err := url.Parse(reqUrl); err == nil {
+		host = u.Host
+		// query 中可能有敏感参数，不记录
+		u.RawQuery = ""
+		reqUrl = u.String()
+	}
+
+	_, span := tracing.StartChild(ctx[0], fmt.Sprintf("HTTP %s %s", method, host), tracing.KindClient)
+	if span == nil {
+		return nil, headers
+	}
+	span.SetAttr("http.method", method)
+	span.SetAttr("http.url", reqUrl)
+
+	ret := make(map[string]string, len(headers)+3)
+	for k, v := range headers {
+		ret[k] = v
+	}
+	span.Inject(ret)
+	return span, ret
+}
+
+func endHttpSpan(span *tracing.Span, resp *http.Response, err error) {
+	if span == nil {
+		return
+	}
+	if resp != nil {
+		span.SetAttr("http.status", resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("HTTP %d", resp.StatusCode))
+		}
+	}
+	span.SetError(err)
+	span.End()
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
@@ -79,6 +80,7 @@ func GenerateDataId() string {
 	return id
 }
 
+// Deprecated: 单次 sha256 不适合保存密码，新代码请使用 userapp.HashPasswd
 func GenerateHashPasswd(loginId, rawPasswd string) string {
 	d := strings.ToLower(loginId) + rawPasswd
 	h := Sha256(d)
@@ -87,6 +89,8 @@ func GenerateHashPasswd(loginId, rawPasswd string) string {
 
 // 生成 token
 // userid + curtimesec 然后 sha256 hash 值
+//
+// Deprecated: 可预测，不适合作为登录凭证，新代码请使用 userapp 的 session
 func GenerateToken(userId string) string {
 	d := fmt.Sprintf("%s%d", userId, time.Now().Nanosecond())
 	h := Md5(d)
@@ -94,19 +98,24 @@ func GenerateToken(userId string) string {
 	return h
 }
 
-func HttpPost(reqUrl string, data []byte, headers map[string]string) (*http.Response, error) {
-	return httpRequest(http.MethodPost, reqUrl, data, headers)
+// 可选的 ctx 传入 *gin.Context 或者带有 span 的 context 时，记录 client span，
+// 并自动在请求中带上 X-Request-Id 与 traceparent/tracestate，ctx 不控制超时与取消
+func HttpPost(reqUrl string, data []byte, headers map[string]string, ctx ...context.Context) (*http.Response, error) {
+	return httpRequest(http.MethodPost, reqUrl, data, headers, ctx)
 }
 
-func HttpPut(reqUrl string, data []byte, headers map[string]string) (*http.Response, error) {
-	return httpRequest(http.MethodPut, reqUrl, data, headers)
+func HttpPut(reqUrl string, data []byte, headers map[string]string, ctx ...context.Context) (*http.Response, error) {
+	return httpRequest(http.MethodPut, reqUrl, data, headers, ctx)
 }
 
-func HttpDelete(reqUrl string, data []byte, headers map[string]string) (*http.Response, error) {
-	return httpRequest(http.MethodDelete, reqUrl, data, headers)
+func HttpDelete(reqUrl string, data []byte, headers map[string]string, ctx ...context.Context) (*http.Response, error) {
+	return httpRequest(http.MethodDelete, reqUrl, data, headers, ctx)
 }
 
-func httpRequest(method, reqUrl string, data []byte, headers map[string]string) (*http.Response, error) {
+func httpRequest(method, reqUrl string, data []byte, headers map[string]string, ctx []context.Context) (resp *http.Response, err error) {
+	span, headers := startHttpSpan(method, reqUrl, headers, ctx)
+	defer func() { endHttpSpan(span, resp, err) }()
+
 	req, err := http.NewRequest(method, reqUrl, bytes.NewBuffer(data))
 	if err != nil {
 		Logger.Errorf("", "[%s %s] 创建失败, %s", method, reqUrl, err.Error())
@@ -121,7 +130,7 @@ func httpRequest(method, reqUrl string, data []byte, headers map[string]string)
 		Timeout: HTTP_POST_TIMEOUT * time.Second,
 	}
 
-	resp, err := client.Do(req)
+	resp, err = client.Do(req)
 	if err != nil {
 		Logger.Errorf("", "对 [%s %s] 发起 client.Do() 操作失败, %s", method, reqUrl, err.Error())
 		return nil, err
@@ -130,7 +139,11 @@ func httpRequest(method, reqUrl string, data []byte, headers map[string]string)
 	return resp, nil
 }
 
-func HttpGet(reqUrl string, values map[string][]string, headers map[string]string) (*http.Response, error) {
+// ctx 的用法与 HttpPost 相同
+func HttpGet(reqUrl string, values map[string][]string, headers map[string]string, ctx ...context.Context) (resp *http.Response, err error) {
+	span, headers := startHttpSpan(http.MethodGet, reqUrl, headers, ctx)
+	defer func() { endHttpSpan(span, resp, err) }()
+
 	// url query paramaters
 	// https://golang.org/pkg/net/url/#Values
 	urlV := url.Values{}
@@ -159,7 +172,7 @@ func HttpGet(reqUrl string, values map[string][]string, headers map[string]strin
 		Timeout: HTTP_GET_TIMEOUT * time.Second,
 	}
 
-	resp, err := client.Do(req)
+	resp, err = client.Do(req)
 	if err != nil {
 		Logger.Errorf("", "发起get请求do[%s]失败, %s", reqUrl, err.Error())
 		return nil, err